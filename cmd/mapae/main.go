@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,11 +14,16 @@ import (
 	"mapae/internal/auth"
 	"mapae/internal/config"
 	"mapae/internal/logging"
+	"mapae/internal/metrics"
+	"mapae/internal/ratelimit"
 	"mapae/internal/storage"
 	"mapae/internal/storage/memory"
 	"mapae/internal/storage/redis"
+	"mapae/internal/storage/sql"
+	"mapae/internal/tenant"
 	httpapi "mapae/internal/transport/http"
 	"mapae/internal/transport/smtp"
+	"mapae/internal/webhook"
 )
 
 // @title           Mapae API
@@ -25,23 +31,66 @@ import (
 // @description     MAPAE API Docs
 // @host            localhost:8000
 // @BasePath        /
+//
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+// @description                 CLIENTS_FILE에 등록된 클라이언트의 API 키
 
 func main() {
 	settings := config.Load()
 	logger := logging.New("mapae: ", settings.Debug)
 
+	registry := metrics.NewRegistry()
 	var store storage.Store
 	redisURL := strings.TrimSpace(settings.RedisURL)
-	if settings.UseInMemoryStore || redisURL == "" {
-		memStore, err := memory.New()
+	databaseURL := strings.TrimSpace(settings.DatabaseURL)
+	useRedis := redisURL != "" || settings.RedisSentinelMaster != "" || len(settings.RedisClusterAddrs) > 0
+	switch {
+	case settings.UseInMemoryStore || (!useRedis && databaseURL == ""):
+		memStore, err := memory.NewWithOptions(memory.Options{
+			SnapshotPath:     settings.MemorySnapshotPath,
+			SnapshotInterval: time.Duration(settings.MemorySnapshotIntervalSeconds) * time.Second,
+			AOFSyncAlways:    settings.MemoryAOFSyncAlways,
+			MaxEntries:       settings.MemoryMaxEntries,
+			// 묘비는 세션보다 오래 남으므로 가득 찼을 때 먼저 내보내 진행 중인 세션과 nonce를 지킴
+			EvictFirst: []string{storage.NamespacedKey(settings.StoreNamespace, auth.TombstoneKeyPrefix)},
+		})
 		if err != nil {
 			logger.Printf("Failed to initialize in-memory store: %v", err)
 			os.Exit(1)
 		}
 		store = memStore
+		registry.NewGaugeFunc("mapae_memory_store_entries", "Number of entries held by the in-memory store, including expired ones not yet swept.", func() float64 {
+			return float64(memStore.Stats().Entries)
+		})
+		registry.NewCounterFunc("mapae_memory_store_expired_total", "Entries removed from the in-memory store after expiring.", func() float64 {
+			return float64(memStore.Stats().Expired)
+		})
+		registry.NewCounterFunc("mapae_memory_store_evicted_total", "Entries evicted from the in-memory store before expiring because MEMORY_MAX_ENTRIES was reached.", func() float64 {
+			return float64(memStore.Stats().Evicted)
+		})
+		registry.NewCounterFunc("mapae_memory_store_aof_errors_total", "Failed writes and fsyncs of the in-memory store's append-only log.", func() float64 {
+			return float64(memStore.Stats().AOFWriteErrors)
+		})
 		logger.Printf("Using in-memory store")
-	} else {
-		redisClient, err := redis.New(redisURL)
+	case databaseURL != "":
+		sqlStore, err := sql.New(databaseURL)
+		if err != nil {
+			logger.Printf("Failed to initialize SQL store: %v", err)
+			os.Exit(1)
+		}
+		store = sqlStore
+		logger.Printf("Using SQL store")
+	default:
+		redisClient, err := redis.NewWithOptions(redis.Options{
+			URL:              redisURL,
+			SentinelMaster:   settings.RedisSentinelMaster,
+			SentinelAddrs:    settings.RedisSentinelAddrs,
+			SentinelPassword: settings.RedisSentinelPassword,
+			ClusterAddrs:     settings.RedisClusterAddrs,
+			HashTag:          clusterHashTag(settings.StoreNamespace),
+		})
 		if err != nil {
 			logger.Printf("Failed to initialize Redis client: %v", err)
 			os.Exit(1)
@@ -49,18 +98,77 @@ func main() {
 		store = redisClient
 		logger.Printf("Using Redis store")
 	}
-	authService, err := auth.New(store, settings)
+	// 재시도마다 지연 시간이 기록되도록 Instrumented를 Resilient 안쪽에 둠
+	authStore := storage.Resilient(
+		storage.Instrumented(storage.Namespaced(store, settings.StoreNamespace), registry),
+		storage.ResilientOptions{
+			RetryAttempts:    settings.StoreRetryAttempts,
+			RetryBaseDelay:   time.Duration(settings.StoreRetryBaseDelayMs) * time.Millisecond,
+			FailureThreshold: settings.StoreBreakerFailures,
+			OpenTimeout:      time.Duration(settings.StoreBreakerOpenSeconds) * time.Second,
+		},
+	)
+	registry.NewGaugeFunc("mapae_store_breaker_open", "1 if the storage circuit breaker is open, 0 otherwise.", func() float64 {
+		if authStore.BreakerState() == storage.BreakerOpen {
+			return 1
+		}
+		return 0
+	})
+	authService, err := auth.New(authStore, settings)
 	if err != nil {
 		logger.Printf("Failed to initialize auth service: %v", err)
 		os.Exit(1)
 	}
 
+	var clients *tenant.Registry
+	if settings.ClientsFile != "" {
+		if clients, err = tenant.Load(settings.ClientsFile); err != nil {
+			logger.Printf("Failed to load clients: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	var dispatcher *webhook.Dispatcher
+	var clientSecrets map[string][]string
+	if clients != nil {
+		clientSecrets = clients.WebhookSecrets()
+	}
+	if len(settings.WebhookSecrets) > 0 || len(clientSecrets) > 0 {
+		dispatcher = newWebhookDispatcher(logger, authStore, settings, clientSecrets, authService.WebhookCodec())
+		authService.UseWebhooks(dispatcher)
+	}
+
 	httpServer := httpapi.NewServer(settings, authService, logger)
+	if len(settings.TrustedProxies) > 0 {
+		if err := httpServer.TrustProxies(settings.TrustedProxies); err != nil {
+			logger.Printf("Failed to configure trusted proxies: %v", err)
+			os.Exit(1)
+		}
+	}
+	if clients != nil {
+		// 클라이언트의 웹훅 주소를 확인하므로 웹훅을 켠 뒤에 등록
+		if err := authService.UseTenants(clients); err != nil {
+			logger.Printf("Failed to configure clients: %v", err)
+			os.Exit(1)
+		}
+		httpServer.RequireClients(clients)
+		logger.Printf("Loaded %d clients; API keys are required", len(clients.Clients()))
+	}
 	smtpServer := smtp.NewServer(settings, authService, logger)
+	if settings.HTTPInitRateLimit > 0 {
+		httpServer.LimitInit(newRateLimiter(logger, authStore, settings, "http_init", settings.HTTPInitRateLimit, settings.HTTPInitRateWindowSeconds))
+	}
+	if settings.SMTPSenderRateLimit > 0 {
+		smtpServer.LimitSenders(newRateLimiter(logger, authStore, settings, "smtp_sender", settings.SMTPSenderRateLimit, settings.SMTPSenderRateWindowSeconds))
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if dispatcher != nil {
+		go dispatcher.Run(ctx)
+	}
+
 	go func() {
 		if err := smtpServer.Run(ctx); err != nil {
 			logger.Printf("SMTP server stopped: %v", err)
@@ -87,6 +195,23 @@ func main() {
 		}
 	}()
 
+	var metricsServer *http.Server
+	if settings.MetricsAddr != "" {
+		metricsServer = &http.Server{
+			Addr:              settings.MetricsAddr,
+			Handler:           httpapi.MetricsHandler(registry),
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      15 * time.Second,
+		}
+		go func() {
+			logger.Printf("Metrics server listening on %s", settings.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Printf("Metrics server error: %v", err)
+				cancel()
+			}
+		}()
+	}
+
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 	<-signalCh
@@ -95,4 +220,62 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 	_ = server.Shutdown(shutdownCtx)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Printf("Failed to close store: %v", err)
+		}
+	}
+}
+
+// newRateLimiter는 저장소 카운터를 공유하는 요청 제한기를 만들며, 설정이 잘못되었으면 종료
+func newRateLimiter(logger *logging.Logger, store storage.Store, settings *config.Settings, name string, limit, windowSeconds int) ratelimit.Limiter {
+	limiter, err := ratelimit.New(store, ratelimit.Options{
+		Name:      name,
+		Algorithm: ratelimit.Algorithm(settings.RateLimitAlgorithm),
+		Limit:     limit,
+		Window:    time.Duration(windowSeconds) * time.Second,
+	})
+	if err != nil {
+		logger.Printf("Failed to initialize %s rate limiter: %v", name, err)
+		os.Exit(1)
+	}
+	return limiter
+}
+
+// clusterHashTag는 Redis Cluster에서 저장소 키(namespace 포함)의 해시 태그
+// 한 세션의 키와 한 카운터의 윈도 키만 같은 슬롯에 두고 나머지는 슬롯 전체에 흩음
+func clusterHashTag(namespace string) func(string) string {
+	prefix := storage.NamespacedKey(namespace, "")
+	return func(key string) string {
+		key = strings.TrimPrefix(key, prefix)
+		if tag := auth.KeyHashTag(key); tag != "" {
+			return tag
+		}
+		return ratelimit.KeyHashTag(key)
+	}
+}
+
+// newWebhookDispatcher는 저장소 outbox로 웹훅을 보내는 Dispatcher를 만들며, 설정이 잘못되었으면 종료
+func newWebhookDispatcher(logger *logging.Logger, store storage.Store, settings *config.Settings, clientSecrets map[string][]string, codec webhook.Codec) *webhook.Dispatcher {
+	dispatcher, err := webhook.New(store, webhook.Options{
+		URL:                settings.WebhookURL,
+		AllowedURLPrefixes: settings.WebhookAllowedURLPrefixes,
+		Secrets:            settings.WebhookSecrets,
+		ClientSecrets:      clientSecrets,
+		Timeout:            time.Duration(settings.WebhookTimeoutSeconds) * time.Second,
+		MaxAttempts:        settings.WebhookMaxAttempts,
+		RetryBase:          time.Duration(settings.WebhookRetryBaseSeconds) * time.Second,
+		RetryMax:           time.Duration(settings.WebhookRetryMaxSeconds) * time.Second,
+		LogTTL:             time.Duration(settings.WebhookLogTTLSeconds) * time.Second,
+		Codec:              codec,
+	}, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize webhook dispatcher: %v", err)
+		os.Exit(1)
+	}
+	logger.Printf("Webhooks enabled")
+	return dispatcher
 }
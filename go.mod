@@ -4,11 +4,14 @@ go 1.25.7
 
 require (
 	blitiri.com.ar/go/spf v1.5.1
-	github.com/allegro/bigcache/v3 v3.1.0
+	github.com/alicebob/miniredis/v2 v2.37.0
 	github.com/emersion/go-smtp v0.24.0
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/labstack/echo/v4 v4.15.0
+	github.com/lib/pq v1.9.0
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/redis/go-redis/v9 v9.17.3
+	golang.org/x/text v0.33.0
 )
 
 require (
@@ -20,9 +23,9 @@ require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/crypto v0.47.0 // indirect
 	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
-	golang.org/x/text v0.33.0 // indirect
 	golang.org/x/time v0.14.0 // indirect
 )
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 클라이언트 정보 크기 한도. 세션 기록과 JWT에 그대로 들어가므로 작게 유지
+const (
+	MaxStateLength           = 512
+	MaxClientReferenceLength = 128
+	MaxMetadataEntries       = 16
+	MaxMetadataKeyLength     = 40
+	MaxMetadataValueLength   = 256
+)
+
+// ErrInvalidClientData는 /auth/init에 넘긴 클라이언트 정보가 한도를 넘거나 형식이 맞지 않을 때 반환
+var ErrInvalidClientData = errors.New("invalid_client_data")
+
+// ClientData는 클라이언트가 인증 요청에 붙이는 값으로, 서버는 해석하지 않고 세션 기록에 보관했다가
+// 상태 조회 응답과 JWT에 그대로 돌려줌
+type ClientData struct {
+	// State는 클라이언트 세션과 인증 결과를 잇는 값(예: CSRF 방지용 임의 문자열)
+	State string `json:"state,omitempty"`
+	// ClientReference는 클라이언트 쪽 식별자(예: 회원 ID, 주문 번호)
+	ClientReference string            `json:"client_reference,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// Validate는 길이 한도와 문자를 확인. 길이는 UTF-8 바이트 수
+func (d *ClientData) Validate() error {
+	if d == nil {
+		return nil
+	}
+	if err := validateClientValue("state", d.State, MaxStateLength); err != nil {
+		return err
+	}
+	if err := validateClientValue("client_reference", d.ClientReference, MaxClientReferenceLength); err != nil {
+		return err
+	}
+	if len(d.Metadata) > MaxMetadataEntries {
+		return fmt.Errorf("%w: metadata has %d entries, limit is %d", ErrInvalidClientData, len(d.Metadata), MaxMetadataEntries)
+	}
+	for key, value := range d.Metadata {
+		if key == "" {
+			return fmt.Errorf("%w: empty metadata key", ErrInvalidClientData)
+		}
+		if err := validateClientValue("metadata key", key, MaxMetadataKeyLength); err != nil {
+			return err
+		}
+		if err := validateClientValue("metadata."+key, value, MaxMetadataValueLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// empty는 저장하거나 돌려줄 값이 없는지 여부
+func (d *ClientData) empty() bool {
+	return d == nil || (d.State == "" && d.ClientReference == "" && len(d.Metadata) == 0)
+}
+
+// validateClientValue는 길이와 함께, 로그나 클라이언트 쪽에서 문제가 되지 않도록 제어 문자를 거부
+func validateClientValue(name, value string, limit int) error {
+	if len(value) > limit {
+		return fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrInvalidClientData, name, len(value), limit)
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%w: %s is not valid UTF-8", ErrInvalidClientData, name)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: %s contains a control character", ErrInvalidClientData, name)
+		}
+	}
+	return nil
+}
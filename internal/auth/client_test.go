@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClientDataValidate(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i <= MaxMetadataEntries; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	cases := map[string]*ClientData{
+		"long state":          {State: strings.Repeat("s", MaxStateLength+1)},
+		"long reference":      {ClientReference: strings.Repeat("r", MaxClientReferenceLength+1)},
+		"too many entries":    {Metadata: tooMany},
+		"empty key":           {Metadata: map[string]string{"": "v"}},
+		"long key":            {Metadata: map[string]string{strings.Repeat("k", MaxMetadataKeyLength+1): "v"}},
+		"long value":          {Metadata: map[string]string{"k": strings.Repeat("v", MaxMetadataValueLength+1)}},
+		"control character":   {State: "a\nb"},
+		"invalid utf-8 value": {Metadata: map[string]string{"k": "\xff"}},
+	}
+	for name, data := range cases {
+		if err := data.Validate(); !errors.Is(err, ErrInvalidClientData) {
+			t.Fatalf("%s: Validate() error = %v, want ErrInvalidClientData", name, err)
+		}
+	}
+
+	var none *ClientData
+	if err := none.Validate(); err != nil {
+		t.Fatalf("nil Validate() error = %v", err)
+	}
+	ok := &ClientData{
+		State:           strings.Repeat("s", MaxStateLength),
+		ClientReference: "회원-42",
+		Metadata:        map[string]string{"plan": "pro"},
+	}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 type jwtSigner struct {
 	priv ed25519.PrivateKey
 	iss  string
+	aud  string
 	exp  time.Duration
 }
 
@@ -58,7 +59,7 @@ func newJWTSigner(settings *config.Settings) (*jwtSigner, error) {
 	if ttl <= 0 {
 		ttl = time.Hour
 	}
-	return &jwtSigner{priv: key, iss: settings.JWTIssuer, exp: ttl}, nil
+	return &jwtSigner{priv: key, iss: settings.JWTIssuer, aud: settings.JWTAudience, exp: ttl}, nil
 }
 
 func normalizePEMString(raw string) string {
@@ -91,7 +92,8 @@ func normalizePEMString(raw string) string {
 	return replacer.Replace(value)
 }
 
-func (s *jwtSigner) Sign(authID, phoneNumber, carrier, jti string) (string, error) {
+// Sign은 인증 결과 JWT를 만듦. client가 있으면 state, client_reference, metadata 클레임을 추가
+func (s *jwtSigner) Sign(authID, phoneNumber, carrier, jti string, client *ClientData) (string, error) {
 	now := time.Now().UTC()
 	claims := jwt.MapClaims{
 		"iss":          s.iss,
@@ -103,6 +105,20 @@ func (s *jwtSigner) Sign(authID, phoneNumber, carrier, jti string) (string, erro
 		"carrier":      carrier,
 		"jti":          jti,
 	}
+	if s.aud != "" {
+		claims["aud"] = s.aud
+	}
+	if client != nil {
+		if client.State != "" {
+			claims["state"] = client.State
+		}
+		if client.ClientReference != "" {
+			claims["client_reference"] = client.ClientReference
+		}
+		if len(client.Metadata) > 0 {
+			claims["metadata"] = client.Metadata
+		}
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
 	return token.SignedString(s.priv)
 }
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidExpectedPhone은 /auth/init에 넘긴 예상 번호나 그 해시의 형식이 맞지 않을 때 반환
+	ErrInvalidExpectedPhone = errors.New("invalid_expected_phone")
+	// ErrPhoneMismatch는 예상 번호와 다른 번호에서 nonce가 와서 failed(phone_mismatch)로 기록했을 때 반환
+	// nonce는 이미 소비되었으므로 같은 메시지를 다시 보내도 인증되지 않음
+	ErrPhoneMismatch = errors.New("phone_mismatch")
+)
+
+// NormalizePhone은 휴대폰 번호를 SMTP 파서가 발신 주소에서 읽는 형식(숫자만)으로 바꿈
+// 하이픈과 공백은 무시하고 국가 번호 +82는 0으로 바꾸며, 숫자가 9~13자리가 아니면 ok=false
+func NormalizePhone(value string) (string, bool) {
+	value = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(value))
+	if rest, ok := strings.CutPrefix(value, "+82"); ok {
+		value = "0" + strings.TrimPrefix(rest, "0")
+	}
+	if len(value) < 9 || len(value) > 13 {
+		return "", false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// PhoneHash는 정규형 번호의 SHA-256(소문자 16진수). 클라이언트가 번호 대신 넘길 수 있는 값
+// 번호 공간이 작아 역산을 막지는 못하므로, 번호를 평문으로 주고받거나 저장하지 않기 위한 용도
+func PhoneHash(phone string) string {
+	sum := sha256.Sum256([]byte(phone))
+	return hex.EncodeToString(sum[:])
+}
+
+// expectedPhoneHash는 InitOptions의 예상 번호 또는 해시를 저장할 해시로 바꾸며, 둘 다 비어 있으면 빈 문자열
+func expectedPhoneHash(phone, hash string) (string, error) {
+	switch {
+	case phone != "" && hash != "":
+		return "", fmt.Errorf("%w: set either expected_phone or expected_phone_hash", ErrInvalidExpectedPhone)
+	case phone != "":
+		normalized, ok := NormalizePhone(phone)
+		if !ok {
+			return "", fmt.Errorf("%w: %q is not a phone number", ErrInvalidExpectedPhone, phone)
+		}
+		return PhoneHash(normalized), nil
+	case hash != "":
+		decoded, err := hex.DecodeString(hash)
+		if err != nil || len(decoded) != sha256.Size {
+			return "", fmt.Errorf("%w: expected_phone_hash must be a hex SHA-256 digest", ErrInvalidExpectedPhone)
+		}
+		return hex.EncodeToString(decoded), nil
+	default:
+		return "", nil
+	}
+}
+
+// phoneMatches는 발신 번호가 예상 번호 해시와 같은지 여부. 예상 번호가 없으면 항상 true
+func phoneMatches(expectedHash string, phone *string) bool {
+	if expectedHash == "" {
+		return true
+	}
+	if phone == nil {
+		return false
+	}
+	normalized, ok := NormalizePhone(*phone)
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PhoneHash(normalized)), []byte(expectedHash)) == 1
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"01012345678":      "01012345678",
+		"010-1234-5678":    "01012345678",
+		" 010 1234 5678 ":  "01012345678",
+		"+82 10-1234-5678": "01012345678",
+		"+82010-1234-5678": "01012345678",
+	}
+	for in, want := range cases {
+		if got, ok := NormalizePhone(in); !ok || got != want {
+			t.Fatalf("NormalizePhone(%q) = (%q,%t), want (%q,true)", in, got, ok, want)
+		}
+	}
+	for _, bad := range []string{"", "0101234", "010-1234-567a", strings.Repeat("1", 14)} {
+		if got, ok := NormalizePhone(bad); ok {
+			t.Fatalf("NormalizePhone(%q) = %q, want failure", bad, got)
+		}
+	}
+}
+
+func TestExpectedPhoneHash(t *testing.T) {
+	want := PhoneHash("01012345678")
+	if got, err := expectedPhoneHash("010-1234-5678", ""); err != nil || got != want {
+		t.Fatalf("expectedPhoneHash(phone) = (%q,%v), want %q", got, err, want)
+	}
+	if got, err := expectedPhoneHash("", strings.ToUpper(want)); err != nil || got != want {
+		t.Fatalf("expectedPhoneHash(hash) = (%q,%v), want %q", got, err, want)
+	}
+	if got, err := expectedPhoneHash("", ""); err != nil || got != "" {
+		t.Fatalf("expectedPhoneHash() = (%q,%v), want empty", got, err)
+	}
+	for name, tc := range map[string][2]string{
+		"both":       {"01012345678", want},
+		"bad phone":  {"12", ""},
+		"short hash": {"", want[:62]},
+		"not hex":    {"", strings.Repeat("z", 64)},
+	} {
+		if _, err := expectedPhoneHash(tc[0], tc[1]); !errors.Is(err, ErrInvalidExpectedPhone) {
+			t.Fatalf("%s: expectedPhoneHash() error = %v, want ErrInvalidExpectedPhone", name, err)
+		}
+	}
+
+	phone := "010-1234-5678"
+	other := "01099998888"
+	if !phoneMatches("", nil) || !phoneMatches(want, &phone) || phoneMatches(want, &other) || phoneMatches(want, nil) {
+		t.Fatalf("phoneMatches() gave an unexpected result")
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix는 암호화된 저장 값의 접두사. 형식: enc:v1:<key id>:<base64url(nonce || ciphertext)>
+const sealedPrefix = "enc:v1:"
+
+var ErrUnknownKeyID = errors.New("unknown_encryption_key_id")
+
+// ErrUnsealedValue는 암호화를 켰는데 암호화되지 않은 평문 값을 읽을 때 반환
+var ErrUnsealedValue = errors.New("unsealed_value")
+
+// sealer는 저장소에 쓰는 값을 AES-GCM으로 암호화
+//
+// 첫 번째 키로 암호화하고, 나머지 키는 복호화에만 사용하므로
+// 새 키를 앞에 추가하고 이전 키를 뒤에 남겨두면 진행 중인 세션을 무효화하지 않고 교체할 수 있음
+// 평문 값은 allowLegacy일 때만 읽으므로, 저장소에 값을 쓸 수 있는 쪽이 평문을 넣어 위조할 수 없음
+type sealer struct {
+	activeID    string
+	aeads       map[string]cipher.AEAD
+	allowLegacy bool
+}
+
+// newSealer는 "<key id>:<base64 key>" 목록으로 sealer를 만들며, 목록이 비어 있으면 nil을 반환
+// 키는 16/24/32바이트(AES-128/192/256). allowLegacy는 암호화 도입 전 기록이 남아 있는 동안만 켬
+func newSealer(specs []string, allowLegacy bool) (*sealer, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	s := &sealer{aeads: make(map[string]cipher.AEAD, len(specs)), allowLegacy: allowLegacy}
+	for i, spec := range specs {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid encryption key #%d: expected <key id>:<base64 key>", i+1)
+		}
+		if _, dup := s.aeads[id]; dup {
+			return nil, fmt.Errorf("duplicate encryption key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			s.activeID = id
+		}
+		s.aeads[id] = aead
+	}
+	return s, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+	return base64.RawURLEncoding.DecodeString(encoded)
+}
+
+// seal은 value를 암호화하며, family(auth, nonce, webhook)와 저장 키를 추가 인증 데이터로 묶어
+// 다른 용도의 값이나 다른 세션의 값과 바꿔치기할 수 없게 함. sealer가 없으면 value를 그대로 반환
+func (s *sealer) seal(family, key, value string) (string, error) {
+	if s == nil {
+		return value, nil
+	}
+	aead := s.aeads[s.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), additionalData(family, s.activeID, key))
+	return sealedPrefix + s.activeID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open은 key에 저장된 값을 seal과 같은 family로 복호화
+// sealer가 없으면 평문을 그대로 반환하며, 있으면 평문은 allowLegacy일 때만 읽음
+func (s *sealer) open(family, key, value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		if s != nil && !s.allowLegacy {
+			return "", ErrUnsealedValue
+		}
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("malformed sealed value")
+	}
+	if s == nil {
+		return "", ErrUnknownKeyID
+	}
+	aead, ok := s.aeads[id]
+	if !ok {
+		return "", ErrUnknownKeyID
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed sealed value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed sealed value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, additionalData(family, id, key))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func additionalData(family, keyID, key string) []byte {
+	return []byte("mapae:" + family + ":" + keyID + ":" + key)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestSealerRoundTripAndRotation(t *testing.T) {
+	old, err := newSealer([]string{"k1:" + testKey('a')}, false)
+	if err != nil {
+		t.Fatalf("newSealer() error = %v", err)
+	}
+	sealed, err := old.seal("auth", "auth:a", `{"status":"pending"}`)
+	if err != nil {
+		t.Fatalf("seal() error = %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:k1:") || strings.Contains(sealed, "pending") {
+		t.Fatalf("sealed value = %q", sealed)
+	}
+
+	// 새 키를 앞에 추가해도 이전 키로 암호화된 값을 읽을 수 있어야 함
+	rotated, err := newSealer([]string{"k2:" + testKey('b'), "k1:" + testKey('a')}, false)
+	if err != nil {
+		t.Fatalf("newSealer() rotated error = %v", err)
+	}
+	plain, err := rotated.open("auth", "auth:a", sealed)
+	if err != nil || plain != `{"status":"pending"}` {
+		t.Fatalf("open() = (%q,%v)", plain, err)
+	}
+	resealed, _ := rotated.seal("auth", "auth:a", "x")
+	if !strings.HasPrefix(resealed, "enc:v1:k2:") {
+		t.Fatalf("rotated sealer should use the first key, got %q", resealed)
+	}
+
+	if _, err := rotated.open("nonce", "auth:a", sealed); err == nil {
+		t.Fatalf("open() with a different family should fail")
+	}
+	// 다른 세션의 키로 옮긴 값은 읽지 않아야 함
+	if _, err := rotated.open("auth", "auth:b", sealed); err == nil {
+		t.Fatalf("open() under a different key should fail")
+	}
+	retired, _ := newSealer([]string{"k2:" + testKey('b')}, false)
+	if _, err := retired.open("auth", "auth:a", sealed); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("open() with retired key error = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestSealerLegacyValues(t *testing.T) {
+	var none *sealer
+	if got, err := none.seal("auth", "auth:a", "plain"); err != nil || got != "plain" {
+		t.Fatalf("nil seal() = (%q,%v)", got, err)
+	}
+	if got, err := none.open("auth", "auth:a", "plain"); err != nil || got != "plain" {
+		t.Fatalf("nil open() = (%q,%v)", got, err)
+	}
+	if _, err := none.open("auth", "auth:a", "enc:v1:k1:AAAA"); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("nil open() sealed error = %v, want ErrUnknownKeyID", err)
+	}
+
+	// 암호화를 켰으면 평문은 이전 기록을 옮기는 동안(allowLegacy)에만 읽음
+	strict, _ := newSealer([]string{"k1:" + testKey('a')}, false)
+	if _, err := strict.open("auth", "auth:a", `{"status":"verified"}`); !errors.Is(err, ErrUnsealedValue) {
+		t.Fatalf("open() plaintext error = %v, want ErrUnsealedValue", err)
+	}
+	migrating, _ := newSealer([]string{"k1:" + testKey('a')}, true)
+	if got, err := migrating.open("auth", "auth:a", `{"status":"verified"}`); err != nil || got != `{"status":"verified"}` {
+		t.Fatalf("open() plaintext while migrating = (%q,%v)", got, err)
+	}
+}
+
+func TestNewSealerRejectsInvalidKeys(t *testing.T) {
+	cases := map[string][]string{
+		"missing id":   {testKey('a')},
+		"bad base64":   {"k1:***"},
+		"bad length":   {"k1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		"duplicate id": {"k1:" + testKey('a'), "k1:" + testKey('b')},
+	}
+	for name, specs := range cases {
+		if _, err := newSealer(specs, false); err == nil {
+			t.Fatalf("newSealer(%s) should fail", name)
+		}
+	}
+}
@@ -3,176 +3,711 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
+	"strings"
 	"time"
 
 	"mapae/internal/config"
+	"mapae/internal/nonce"
 	"mapae/internal/storage"
+	"mapae/internal/webhook"
 )
 
 type Service struct {
 	store    storage.Store
+	sessions *sessionRepository
 	settings *config.Settings
 	signer   *jwtSigner
+	sealer   *sealer
+	nonces   *nonce.Format
+	bodies   *smsBodies
+	webhooks *webhook.Dispatcher
+	// expiredWebhookDelay는 만료 이벤트를 세션 TTL보다 늦게 보내는 시간
+	expiredWebhookDelay time.Duration
+	// tenants는 등록된 클라이언트의 구성이며, tenant는 ForTenant로 만든 서비스의 클라이언트
+	tenants map[string]*tenantConfig
+	tenant  *tenantConfig
 }
 
 type AuthInitResponse struct {
-	AuthID     string `json:"auth_id"`
-	SMSBody    string `json:"sms_body"`
+	AuthID  string `json:"auth_id"`
+	SMSBody string `json:"sms_body"`
+	// Locale은 SMS 본문에 쓴 템플릿의 언어
+	Locale     string `json:"locale"`
 	Link       string `json:"link"`
 	TTLSeconds int    `json:"ttl_seconds"`
 }
 
-type AuthPayload struct {
-	Status    string `json:"status"`
-	Timestamp string `json:"timestamp"`
+// InitOptions는 인증 요청별 설정
+type InitOptions struct {
+	// Locale은 SMS 본문 언어. 언어 태그(ko, en-US) 또는 Accept-Language 값이며, 비어 있으면 기본 언어
+	Locale string
+	// Client는 세션 기록에 보관했다가 상태 조회 응답과 JWT에 돌려줄 클라이언트 정보
+	Client *ClientData
+	// ExpectedPhone 또는 ExpectedPhoneHash(PhoneHash 값)를 주면 그 번호에서 온 문자만 인증하고, 다른 번호면 failed(phone_mismatch)로 기록
+	ExpectedPhone     string
+	ExpectedPhoneHash string
+	// WebhookURL은 이 세션의 결과를 받을 주소. 비어 있으면 클라이언트의 주소, 그것도 없으면 기본 주소(WEBHOOK_URL)를 사용
+	WebhookURL string
 }
 
-type VerifiedPayload struct {
-	Status    string `json:"status"`
-	Phone     string `json:"phone,omitempty"`
-	Carrier   string `json:"carrier,omitempty"`
-	Timestamp string `json:"timestamp"`
-}
+// 상태 조회 응답의 status 값. 세션 상태와 같되 pending은 waiting으로 알림
+const (
+	StatusWaiting   = "waiting"
+	StatusVerified  = "verified"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusConsumed  = "consumed"
+	// StatusExpired는 발급한 적 있는 세션의 기록이 TTL로 사라진 경우
+	StatusExpired = "expired"
+	// StatusUnknown은 발급한 적 없거나 묘비까지 사라진 auth_id
+	StatusUnknown = "unknown"
+)
 
 type AuthCheckResponse struct {
-	Status    string `json:"status"`
+	Status string `json:"status"`
+	// Reason은 failed 상태의 원인(spf_fail, unknown_carrier, phone_mismatch 등)
+	Reason    string `json:"reason,omitempty"`
 	Phone     string `json:"phone,omitempty"`
 	Carrier   string `json:"carrier,omitempty"`
 	Timestamp string `json:"timestamp,omitempty"`
 	Token     string `json:"token,omitempty"`
+	// ExpiresIn/ExpiresAt은 대기 중이거나 인증 완료된 기록이 만료되기까지 남은 시간(초)과 만료 시각(RFC3339)
+	ExpiresIn int    `json:"expires_in,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// State/ClientReference/Metadata는 /auth/init에서 받은 클라이언트 정보
+	State           string            `json:"state,omitempty"`
+	ClientReference string            `json:"client_reference,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
 }
 
 var authIDRe = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
 var ErrInvalidAuthID = errors.New("invalid_auth_id")
 var ErrJWKSUnavailable = errors.New("jwks_unavailable")
 
+// ErrNotCancellable은 대기 중이 아닌 세션을 취소하려 할 때 반환
+var ErrNotCancellable = errors.New("not_cancellable")
+
+// maxNonceAttempts는 짧은 코드가 이미 쓰이고 있을 때 새 코드로 다시 시도하는 최대 횟수
+const maxNonceAttempts = 5
+
 func New(store storage.Store, settings *config.Settings) (*Service, error) {
-	svc := &Service{store: store, settings: settings}
+	svc := &Service{store: store, settings: settings, expiredWebhookDelay: defaultExpiredWebhookDelay}
 	signer, err := newJWTSigner(settings)
 	if err != nil {
 		return nil, err
 	}
 	svc.signer = signer
+	sealer, err := newSealer(settings.StoreEncryptionKeys, settings.StoreEncryptionAllowLegacy)
+	if err != nil {
+		return nil, err
+	}
+	if settings.StoreEncryptNonces && sealer == nil {
+		return nil, errors.New("STORE_ENCRYPT_NONCES requires STORE_ENCRYPTION_KEYS")
+	}
+	svc.sealer = sealer
+	svc.sessions = &sessionRepository{store: store, sealer: sealer}
+	nonces, err := nonce.New(settings.NonceFormat, settings.NonceTag, settings.NonceLength)
+	if err != nil {
+		return nil, err
+	}
+	svc.nonces = nonces
+	if svc.bodies, err = newSMSBodies(settings, nonces); err != nil {
+		return nil, err
+	}
 	return svc, nil
 }
 
+// NonceFormat은 SMS 본문의 nonce 형식(SMTP 파서가 같은 형식으로 nonce를 찾음)
+func (s *Service) NonceFormat() *nonce.Format {
+	return s.nonces
+}
+
 func (s *Service) InitAuth(ctx context.Context) (*AuthInitResponse, error) {
-	nonce, err := randomHex(32)
-	if err != nil {
+	return s.InitAuthWithOptions(ctx, InitOptions{})
+}
+
+func (s *Service) InitAuthWithOptions(ctx context.Context, opts InitOptions) (*AuthInitResponse, error) {
+	if err := opts.Client.Validate(); err != nil {
 		return nil, err
 	}
-	authID, err := randomHex(16)
+	var client *ClientData
+	if !opts.Client.empty() {
+		client = opts.Client
+	}
+	phoneHash, err := expectedPhoneHash(opts.ExpectedPhone, opts.ExpectedPhoneHash)
 	if err != nil {
 		return nil, err
 	}
-	payload := AuthPayload{
-		Status:    "pending",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-	}
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
+	if err := s.validateWebhookURL(opts.WebhookURL); err != nil {
 		return nil, err
 	}
-	authKey := fmt.Sprintf("auth:%s", authID)
-	nonceKey := fmt.Sprintf("nonce:%s", nonce)
-	if err := s.store.SetEx(ctx, authKey, string(payloadJSON), s.settings.AuthTTLSeconds); err != nil {
+	webhookURL := opts.WebhookURL
+	if webhookURL == "" && s.tenant != nil {
+		webhookURL = s.tenant.webhookURL
+	}
+	rec := SessionRecord{
+		Status:            SessionPending,
+		Timestamp:         time.Now(),
+		Client:            client,
+		ExpectedPhoneHash: phoneHash,
+		WebhookURL:        webhookURL,
+		Tenant:            s.tenantID(),
+	}
+	var authID, code string
+	if s.nonces.Codec.Short() {
+		authID, code, err = s.initShortNonce(ctx, rec)
+	} else {
+		authID, code, err = s.initNonce(ctx, rec)
+	}
+	if err != nil {
 		return nil, err
 	}
-	if err := s.store.SetEx(ctx, nonceKey, authID, s.settings.AuthTTLSeconds); err != nil {
+	smsBody, locale, err := s.bodies.render(opts.Locale, code)
+	if err != nil {
 		return nil, err
 	}
-	smsBody := fmt.Sprintf("[MAPAE:%s]", nonce)
+	s.scheduleExpiredWebhook(ctx, authID, &rec)
 	return &AuthInitResponse{
 		AuthID:     authID,
 		SMSBody:    smsBody,
-		Link:       fmt.Sprintf("sms:%s?body=%s", s.settings.SMSInboundAddress, smsBody),
+		Locale:     locale,
+		Link:       smsLink(s.settings.SMSInboundAddress, smsBody),
 		TTLSeconds: s.settings.AuthTTLSeconds,
 	}, nil
 }
 
+// nonceValue는 nonce 키에 쓸 값(auth_id)이며, STORE_ENCRYPT_NONCES이면 그 nonce 키에 묶어 암호화
+func (s *Service) nonceValue(code, authID string) (string, error) {
+	if !s.settings.StoreEncryptNonces {
+		return authID, nil
+	}
+	return s.sealer.seal("nonce", nonceKey(code), authID)
+}
+
+// initNonce는 세션, nonce, 묘비를 한 번에 기록해 nonce 없는 대기 세션이 남지 않도록 함
+func (s *Service) initNonce(ctx context.Context, rec SessionRecord) (string, string, error) {
+	code, err := s.nonces.Codec.Generate()
+	if err != nil {
+		return "", "", err
+	}
+	authID, err := newAuthID(code)
+	if err != nil {
+		return "", "", err
+	}
+	rec.Nonce = code
+	entries, err := s.pendingEntries(authID, rec)
+	if err != nil {
+		return "", "", err
+	}
+	nonceValue, err := s.nonceValue(code, authID)
+	if err != nil {
+		return "", "", err
+	}
+	entries = append(entries, storage.Entry{Key: nonceKey(code), Value: nonceValue, TTLSeconds: s.settings.AuthTTLSeconds})
+	if err := s.store.MSetEx(ctx, entries...); err != nil {
+		return "", "", err
+	}
+	return authID, code, nil
+}
+
+// initShortNonce는 AddEx로 아직 쓰이지 않은 코드를 차지한 뒤 세션과 묘비를 기록
+// 짧은 코드는 다른 세션의 코드와 겹칠 수 있어 MSetEx로 덮어쓰지 않고, 겹치면 새 코드로 다시 시도
+func (s *Service) initShortNonce(ctx context.Context, rec SessionRecord) (string, string, error) {
+	for attempt := 0; attempt < maxNonceAttempts; attempt++ {
+		code, err := s.nonces.Codec.Generate()
+		if err != nil {
+			return "", "", err
+		}
+		authID, err := newAuthID(code)
+		if err != nil {
+			return "", "", err
+		}
+		rec.Nonce = code
+		entries, err := s.pendingEntries(authID, rec)
+		if err != nil {
+			return "", "", err
+		}
+		nonceValue, err := s.nonceValue(code, authID)
+		if err != nil {
+			return "", "", err
+		}
+		added, err := s.store.AddEx(ctx, nonceKey(code), nonceValue, s.settings.AuthTTLSeconds)
+		if err != nil {
+			return "", "", err
+		}
+		if !added {
+			continue
+		}
+		if err := s.store.MSetEx(ctx, entries...); err != nil {
+			// 코드가 사용자에게 전달되지 않으므로 되돌리지 못해도 TTL 뒤에 사라짐
+			_, _, _ = s.store.Take(ctx, nonceKey(code))
+			return "", "", err
+		}
+		return authID, code, nil
+	}
+	return "", "", fmt.Errorf("no unused %s nonce after %d attempts", s.nonces.Codec.Name(), maxNonceAttempts)
+}
+
+// pendingEntries는 대기 세션 기록과, 설정되어 있으면 묘비
+// 묘비 값은 세션을 만든 클라이언트 ID(없으면 "1")이며, 기록이 사라진 뒤에도 다른 클라이언트에는 unknown으로 응답하는 데 씀
+func (s *Service) pendingEntries(authID string, rec SessionRecord) ([]storage.Entry, error) {
+	value, err := s.sessions.encode(authID, rec)
+	if err != nil {
+		return nil, err
+	}
+	entries := []storage.Entry{{Key: sessionKey(authID), Value: value, TTLSeconds: s.settings.AuthTTLSeconds}}
+	if s.settings.SessionTombstoneTTLSeconds > 0 {
+		tombstone := "1"
+		if rec.Tenant != "" {
+			tombstone = rec.Tenant
+		}
+		entries = append(entries, storage.Entry{Key: tombstoneKey(authID), Value: tombstone, TTLSeconds: s.settings.SessionTombstoneTTLSeconds})
+	}
+	return entries, nil
+}
+
+func nonceKey(code string) string {
+	return fmt.Sprintf("nonce:%s", code)
+}
+
+// newAuthID는 code로 만들 세션의 auth_id. 앞 네 자리를 slotTag(code)로 두어 세션과 nonce 키가 같은 해시 태그를 가짐
+func newAuthID(code string) (string, error) {
+	random, err := randomHex(14)
+	if err != nil {
+		return "", err
+	}
+	return slotTag(code) + random, nil
+}
+
+// slotTag는 code에서 얻는 16진수 네 자리
+func slotTag(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:2])
+}
+
+// KeyHashTag는 Redis Cluster에서 key를 둘 슬롯의 해시 태그이며, 이 패키지의 키가 아니면 빈 문자열
+// 한 세션의 기록, 묘비, nonce는 같은 태그를 가지므로 함께 다루는 작업이 한 슬롯 안에서 원자적이고, 세션끼리는 슬롯이 흩어짐
+func KeyHashTag(key string) string {
+	for _, prefix := range []string{"auth:", TombstoneKeyPrefix} {
+		if authID, ok := strings.CutPrefix(key, prefix); ok && len(authID) >= 4 {
+			return authID[:4]
+		}
+	}
+	if code, ok := strings.CutPrefix(key, "nonce:"); ok {
+		return slotTag(code)
+	}
+	return ""
+}
+
+// TombstoneKeyPrefix는 묘비 키의 접두사. 용량이 정해진 저장소는 이 키를 먼저 내보내야 진행 중인 세션이 남음
+const TombstoneKeyPrefix = "tomb:"
+
+// tombstoneKey는 발급한 auth_id를 기록보다 오래 기억하는 키. 기록이 사라진 뒤 expired와 unknown을 구분하는 데 씀
+func tombstoneKey(authID string) string {
+	return TombstoneKeyPrefix + authID
+}
+
 func (s *Service) CheckAuth(ctx context.Context, authID string) (*AuthCheckResponse, error) {
 	if !authIDRe.MatchString(authID) {
 		return nil, ErrInvalidAuthID
 	}
-	value, ok, err := s.store.Get(ctx, fmt.Sprintf("auth:%s", authID))
+	rec, ok, err := s.sessions.Load(ctx, authID)
 	if err != nil {
 		return nil, err
 	}
 	if !ok {
-		return &AuthCheckResponse{Status: "expired"}, nil
+		return s.missingResponse(ctx, authID)
+	}
+	if !s.visible(rec) {
+		return &AuthCheckResponse{Status: StatusUnknown}, nil
+	}
+	return s.withExpiry(ctx, authID, recordResponse(rec))
+}
+
+// missingResponse는 기록이 없는 auth_id의 응답. 묘비가 남아 있으면 expired, 없으면 unknown
+// 다른 클라이언트의 묘비도 unknown이며, 묘비를 쓰지 않도록 설정했으면 이전처럼 expired
+func (s *Service) missingResponse(ctx context.Context, authID string) (*AuthCheckResponse, error) {
+	if s.settings.SessionTombstoneTTLSeconds <= 0 {
+		return &AuthCheckResponse{Status: StatusExpired}, nil
+	}
+	tombstone, ok, err := s.store.Get(ctx, tombstoneKey(authID))
+	if err != nil {
+		return nil, err
+	}
+	if !ok || (s.tenant != nil && tombstone != s.tenant.id) {
+		return &AuthCheckResponse{Status: StatusUnknown}, nil
+	}
+	return &AuthCheckResponse{Status: StatusExpired}, nil
+}
+
+// recordResponse는 기록 상태의 응답. 대기 중이면 클라이언트 정보만, 그 밖에는 결과와 사유를 담음
+func recordResponse(rec *SessionRecord) *AuthCheckResponse {
+	if rec.Status == SessionPending {
+		resp := &AuthCheckResponse{Status: StatusWaiting}
+		resp.setClient(rec.Client)
+		return resp
 	}
-	var decoded AuthCheckResponse
-	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
-		return &AuthCheckResponse{Status: "waiting"}, nil
+	resp := &AuthCheckResponse{Status: string(rec.Status), Reason: string(rec.Reason), Phone: rec.Phone, Carrier: rec.Carrier}
+	if !rec.Timestamp.IsZero() {
+		resp.Timestamp = rec.Timestamp.UTC().Format(time.RFC3339)
 	}
-	if decoded.Status == "verified" {
-		return &decoded, nil
+	resp.setClient(rec.Client)
+	return resp
+}
+
+func (r *AuthCheckResponse) setClient(client *ClientData) {
+	if client == nil {
+		return
 	}
-	return &AuthCheckResponse{Status: "waiting"}, nil
+	r.State = client.State
+	r.ClientReference = client.ClientReference
+	r.Metadata = client.Metadata
 }
 
-func (s *Service) ConsumeAuthIDByNonce(ctx context.Context, nonce string) (string, bool, error) {
-	return s.store.Take(ctx, fmt.Sprintf("nonce:%s", nonce))
+// withExpiry는 auth 기록의 남은 TTL로 resp의 ExpiresIn/ExpiresAt을 채움
+// 조회 직후 만료되었으면 expired 응답을 반환
+func (s *Service) withExpiry(ctx context.Context, authID string, resp *AuthCheckResponse) (*AuthCheckResponse, error) {
+	ttl, ok, err := s.sessions.TTL(ctx, authID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return s.missingResponse(ctx, authID)
+	}
+	// 1초 미만이 남아도 0으로 내려가지 않도록 올림
+	resp.ExpiresIn = int(math.Ceil(ttl.Seconds()))
+	resp.ExpiresAt = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	return resp, nil
 }
 
 func (s *Service) Ping(ctx context.Context) error {
 	return s.store.Ping(ctx)
 }
 
-func (s *Service) StoreVerified(ctx context.Context, authID string, phone, carrier *string) error {
-	payload := VerifiedPayload{
-		Status:    "verified",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+// StorageBreakerState는 저장소 회로 차단기 상태를 반환하며, 차단기가 없으면 빈 문자열
+func (s *Service) StorageBreakerState() storage.BreakerState {
+	if reporter, ok := s.store.(storage.BreakerReporter); ok {
+		return reporter.BreakerState()
 	}
-	if phone != nil {
-		payload.Phone = *phone
+	return ""
+}
+
+// NonceResult는 nonce로 찾아 종료한 세션
+type NonceResult struct {
+	AuthID string
+	// Tenant는 세션을 만든 클라이언트 ID이며, 클라이언트를 등록하지 않았으면 빈 문자열
+	Tenant string
+}
+
+// VerifyByNonce는 nonce 소비와 인증 완료 기록을 저장소의 단일 원자 연산으로 처리
+// 기록에 실패하면 nonce가 소비되지 않으므로 같은 메시지를 재전송해 다시 시도할 수 있음
+// code는 정규형이 아니어도 되며, 형식에 맞지 않으면 찾지 못한 것으로 처리
+// 예상 번호와 다른 번호면 nonce를 소비하고 failed로 기록한 뒤 세션, true와 함께 ErrPhoneMismatch를 반환
+func (s *Service) VerifyByNonce(ctx context.Context, code string, phone, carrier *string) (NonceResult, bool, error) {
+	result, rec, ok, err := s.finishByNonce(ctx, code, func(pending *SessionRecord) SessionRecord {
+		return completedSession(pending, phone, carrier)
+	})
+	if err != nil || !ok {
+		return result, ok, err
 	}
-	if carrier != nil {
-		payload.Carrier = *carrier
+	if rec.Reason == FailurePhoneMismatch {
+		return result, true, ErrPhoneMismatch
+	}
+	return result, true, nil
+}
+
+// FailByNonce는 SMTP 단계에서 거부한 문자의 nonce로 세션을 찾아 failed와 사유를 기록
+// 사용자가 만료까지 기다리지 않고 실패를 알 수 있으며, nonce는 소비되므로 새 인증을 시작해야 함
+func (s *Service) FailByNonce(ctx context.Context, code string, reason FailureReason) (NonceResult, bool, error) {
+	result, _, ok, err := s.finishByNonce(ctx, code, func(pending *SessionRecord) SessionRecord {
+		return failedSession(pending, reason)
+	})
+	return result, ok, err
+}
+
+// CancelAuth는 대기 중인 세션을 취소하고 nonce를 지움
+// 대기 중이 아니면 현재 상태와 함께 ErrNotCancellable을 반환하며, 기록이 없으면 expired/unknown 응답과 ErrNotCancellable
+func (s *Service) CancelAuth(ctx context.Context, authID string) (*AuthCheckResponse, error) {
+	if !authIDRe.MatchString(authID) {
+		return nil, ErrInvalidAuthID
+	}
+	rec, ok, err := s.sessions.Load(ctx, authID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		resp, err := s.missingResponse(ctx, authID)
+		if err != nil {
+			return nil, err
+		}
+		return resp, ErrNotCancellable
+	}
+	if !s.visible(rec) {
+		return &AuthCheckResponse{Status: StatusUnknown}, ErrNotCancellable
 	}
-	payloadJSON, err := json.Marshal(payload)
+	if !rec.Status.CanTransition(SessionCancelled) {
+		resp, err := s.withExpiry(ctx, authID, recordResponse(rec))
+		if err != nil {
+			return nil, err
+		}
+		return resp, ErrNotCancellable
+	}
+	if rec.Nonce != "" {
+		// nonce를 먼저 지워 취소와 인증이 겹쳐도 하나만 기록되게 함
+		if _, taken, err := s.store.Take(ctx, nonceKey(rec.Nonce)); err != nil {
+			return nil, err
+		} else if !taken {
+			// 그사이 인증되었거나 실패했으면 그 결과를 알림
+			current, ok, err := s.sessions.Load(ctx, authID)
+			if err != nil {
+				return nil, err
+			}
+			if ok && current.Status != SessionPending {
+				resp, err := s.withExpiry(ctx, authID, recordResponse(current))
+				if err != nil {
+					return nil, err
+				}
+				return resp, ErrNotCancellable
+			}
+		}
+	}
+	cancelled := SessionRecord{
+		Status:            SessionCancelled,
+		Timestamp:         time.Now(),
+		Client:            rec.Client,
+		ExpectedPhoneHash: rec.ExpectedPhoneHash,
+		Tenant:            rec.Tenant,
+	}
+	if err := s.sessions.Save(ctx, authID, cancelled, s.settingsFor(&cancelled).VerifiedTTLSeconds); err != nil {
+		return nil, err
+	}
+	s.notifyAuth(ctx, authID, string(SessionCancelled))
+	s.cancelExpiredWebhook(ctx, authID, rec)
+	return s.withExpiry(ctx, authID, recordResponse(&cancelled))
+}
+
+// finishByNonce는 nonce를 소비하고 대기 중인 기록을 build가 만든 종료 기록으로 바꾼 뒤 새 상태를 발행
+// nonce가 없거나, 기록이 이미 대기 중이 아니면 ok=false
+func (s *Service) finishByNonce(ctx context.Context, code string, build func(pending *SessionRecord) SessionRecord) (NonceResult, SessionRecord, bool, error) {
+	code, valid := s.nonces.Codec.Normalize(code)
+	if !valid {
+		return NonceResult{}, SessionRecord{}, false, nil
+	}
+	key := nonceKey(code)
+	var authID string
+	var rec SessionRecord
+	var ok bool
+	var err error
+	if s.settings.StoreEncryptNonces {
+		authID, rec, ok, err = s.finishBySealedNonce(ctx, key, build)
+	} else {
+		authID, rec, ok, err = s.finishByPlainNonce(ctx, key, build)
+	}
+	if err != nil || !ok {
+		return NonceResult{}, rec, ok, err
+	}
+	s.notifyAuth(ctx, authID, string(rec.Status))
+	s.emitWebhook(ctx, authID, &rec)
+	return NonceResult{AuthID: authID, Tenant: rec.Tenant}, rec, true, nil
+}
+
+// finishByPlainNonce는 nonce 값(auth_id)으로 대기 중인 기록을 먼저 읽어 클라이언트 정보와 예상 번호를 확인한 뒤
+// TakeAndSetEx로 nonce가 여전히 그 auth_id를 가리킬 때만 nonce 소비와 기록을 원자적으로 처리
+// 읽은 뒤 nonce가 소비되었거나 같은 짧은 코드가 다른 세션에 다시 발급되었으면, 메시지는 그 세션의 것이 아니므로 찾지 못한 것으로 처리
+func (s *Service) finishByPlainNonce(ctx context.Context, nonceKey string, build func(*SessionRecord) SessionRecord) (string, SessionRecord, bool, error) {
+	authID, ok, err := s.store.Get(ctx, nonceKey)
+	if err != nil || !ok {
+		return "", SessionRecord{}, false, err
+	}
+	pending, err := s.pendingSession(ctx, authID)
+	if err != nil {
+		return "", SessionRecord{}, false, err
+	}
+	if pending != nil && pending.Status != SessionPending {
+		// nonce를 지우지 못한 채 종료된 기록(nonce 필드가 없는 이전 기록의 취소 등). 남은 nonce만 버림
+		_, _, err := s.store.Take(ctx, nonceKey)
+		return "", SessionRecord{}, false, err
+	}
+	rec := build(pending)
+	record, err := s.sessions.encode(authID, rec)
 	if err != nil {
-		return err
+		return "", SessionRecord{}, false, err
 	}
-	key := fmt.Sprintf("auth:%s", authID)
-	return s.store.SetEx(ctx, key, string(payloadJSON), s.settings.VerifiedTTLSeconds)
+	ok, err = s.store.TakeAndSetEx(ctx, nonceKey, authID, sessionKey(authID), record, s.settingsFor(&rec).VerifiedTTLSeconds)
+	if err != nil || !ok {
+		return "", SessionRecord{}, false, err
+	}
+	return authID, rec, true, nil
+}
+
+// finishBySealedNonce는 nonce 값이 암호화되어 저장소가 대상 키를 만들 수 없을 때 사용
+// nonce를 가져와 복호화한 뒤 기록하며, 기록에 실패하면 남은 TTL로 nonce를 되돌려 재전송으로 복구할 수 있게 함
+func (s *Service) finishBySealedNonce(ctx context.Context, nonceKey string, build func(*SessionRecord) SessionRecord) (string, SessionRecord, bool, error) {
+	ttl, ok, err := s.store.TTL(ctx, nonceKey)
+	if err != nil || !ok {
+		return "", SessionRecord{}, false, err
+	}
+	sealedID, ok, err := s.store.Take(ctx, nonceKey)
+	if err != nil || !ok {
+		return "", SessionRecord{}, false, err
+	}
+	authID, err := s.sealer.open("nonce", nonceKey, sealedID)
+	if err != nil {
+		return "", SessionRecord{}, false, fmt.Errorf("open nonce record: %w", err)
+	}
+	var rec SessionRecord
+	pending, err := s.pendingSession(ctx, authID)
+	if err == nil && pending != nil && pending.Status != SessionPending {
+		// 이미 종료된 세션에 남아 있던 nonce는 되돌리지 않고 버림
+		return "", SessionRecord{}, false, nil
+	}
+	if err == nil {
+		rec = build(pending)
+		err = s.sessions.Save(ctx, authID, rec, s.settingsFor(&rec).VerifiedTTLSeconds)
+	}
+	if err != nil {
+		if restoreTTL := int(math.Ceil(ttl.Seconds())); restoreTTL > 0 {
+			_ = s.store.SetEx(ctx, nonceKey, sealedID, restoreTTL)
+		}
+		return "", SessionRecord{}, false, err
+	}
+	return authID, rec, true, nil
+}
+
+// SubscribeAuth는 auth_id의 상태가 바뀔 때마다 새 상태(예: verified)를 받는 채널을 반환
+// 알림은 유실될 수 있으므로 수신 후 CheckAuth로 실제 상태를 확인해야 함
+func (s *Service) SubscribeAuth(ctx context.Context, authID string) (<-chan string, error) {
+	if !authIDRe.MatchString(authID) {
+		return nil, ErrInvalidAuthID
+	}
+	return s.store.Subscribe(ctx, fmt.Sprintf("auth:%s", authID))
+}
+
+// notifyAuth는 auth_id 상태 변경을 발행
+// 기록은 이미 끝났고 구독자는 조회로 상태를 확인할 수 있으므로 발행 실패는 무시
+func (s *Service) notifyAuth(ctx context.Context, authID, status string) {
+	_ = s.store.Publish(ctx, fmt.Sprintf("auth:%s", authID), status)
+}
+
+// pendingSession은 종료 전의 기록이며, 기록이 없으면 nil
+func (s *Service) pendingSession(ctx context.Context, authID string) (*SessionRecord, error) {
+	rec, ok, err := s.sessions.Load(ctx, authID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// completedSession은 pending 기록에 발신 번호를 반영한 기록
+// 예상 번호와 같으면(또는 예상 번호가 없으면) verified, 다르면 발신 번호를 빼고 failed(phone_mismatch)
+// 클라이언트 정보와 예상 번호, 웹훅 주소, 클라이언트 ID는 이어받음
+func completedSession(pending *SessionRecord, phone, carrier *string) SessionRecord {
+	rec := SessionRecord{Status: SessionVerified, Timestamp: time.Now()}
+	if pending != nil {
+		rec.Client = pending.Client
+		rec.ExpectedPhoneHash = pending.ExpectedPhoneHash
+		rec.WebhookURL = pending.WebhookURL
+		rec.Tenant = pending.Tenant
+	}
+	if carrier != nil {
+		rec.Carrier = *carrier
+	}
+	if !phoneMatches(rec.ExpectedPhoneHash, phone) {
+		rec.Status, rec.Reason = SessionFailed, FailurePhoneMismatch
+		return rec
+	}
+	if phone != nil {
+		rec.Phone = *phone
+	}
+	return rec
+}
+
+// failedSession은 pending 기록을 reason으로 실패 처리한 기록. 거부한 문자의 발신 정보는 믿을 수 없으므로 남기지 않음
+func failedSession(pending *SessionRecord, reason FailureReason) SessionRecord {
+	rec := SessionRecord{Status: SessionFailed, Reason: reason, Timestamp: time.Now()}
+	if pending != nil {
+		rec.Client = pending.Client
+		rec.ExpectedPhoneHash = pending.ExpectedPhoneHash
+		rec.WebhookURL = pending.WebhookURL
+		rec.Tenant = pending.Tenant
+	}
+	return rec
 }
 
 func (s *Service) CheckSigned(ctx context.Context, authID string) (*AuthCheckResponse, error) {
 	if !authIDRe.MatchString(authID) {
 		return nil, ErrInvalidAuthID
 	}
-	value, ok, err := s.store.Get(ctx, fmt.Sprintf("auth:%s", authID))
+	rec, ok, err := s.sessions.Load(ctx, authID)
 	if err != nil {
 		return nil, err
 	}
 	if !ok {
-		return &AuthCheckResponse{Status: "expired"}, nil
+		return s.missingResponse(ctx, authID)
 	}
-	var decoded AuthCheckResponse
-	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
-		return &AuthCheckResponse{Status: "waiting"}, nil
+	if !s.visible(rec) {
+		return &AuthCheckResponse{Status: StatusUnknown}, nil
 	}
-	if decoded.Status != "verified" {
-		return &AuthCheckResponse{Status: "waiting"}, nil
+	if rec.Status != SessionVerified {
+		// 토큰을 발급하지 않고 상태만 알림
+		return s.withExpiry(ctx, authID, recordResponse(rec))
 	}
 	if s.signer == nil {
 		return nil, ErrJWKSUnavailable
 	}
-	if decoded.Phone == "" {
-		return &AuthCheckResponse{Status: "waiting"}, nil
+	if rec.Phone == "" {
+		resp := &AuthCheckResponse{Status: StatusWaiting}
+		resp.setClient(rec.Client)
+		return s.withExpiry(ctx, authID, resp)
+	}
+	// jti는 발급마다 새로 만들어 토큰을 서로 구분할 수 있게 함
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.signer.Sign(authID, rec.Phone, rec.Carrier, jti, rec.Client)
+	if err != nil {
+		return nil, err
 	}
-	token, err := s.signer.Sign(authID, decoded.Phone, decoded.Carrier, authID)
+	if s.settings.SignedResultSingleUse {
+		return s.consumeSigned(ctx, authID, token)
+	}
+	resp := recordResponse(rec)
+	resp.Token = token
+	return s.withExpiry(ctx, authID, resp)
+}
+
+// consumeSigned는 인증 완료 기록을 Take로 가져와 consumed 기록으로 바꾸고 token과 함께 결과를 돌려줌
+// 동시에 요청해도 기록을 가져간 요청만 토큰을 받으며, 나머지는 그 뒤의 상태를 토큰 없이 받음
+func (s *Service) consumeSigned(ctx context.Context, authID, token string) (*AuthCheckResponse, error) {
+	rec, ok, err := s.sessions.Take(ctx, authID)
 	if err != nil {
 		return nil, err
 	}
-	decoded.Token = token
-	return &decoded, nil
+	if !ok {
+		return s.CheckAuth(ctx, authID)
+	}
+	if !rec.Status.CanTransition(SessionConsumed) {
+		// 읽은 뒤 다른 요청이 먼저 소비해 consumed 기록을 가져온 경우. 되돌려 놓고 그 상태를 알림
+		if err := s.sessions.Save(ctx, authID, *rec, s.settingsFor(rec).VerifiedTTLSeconds); err != nil {
+			return nil, err
+		}
+		return s.withExpiry(ctx, authID, recordResponse(rec))
+	}
+	resp := recordResponse(rec)
+	resp.Token = token
+	consumed := SessionRecord{Status: SessionConsumed, Timestamp: time.Now(), Client: rec.Client, Tenant: rec.Tenant}
+	// 결과는 이미 가져갔으므로 consumed 기록을 쓰지 못해도 토큰은 돌려줌(이후 조회는 expired)
+	if err := s.sessions.Save(ctx, authID, consumed, s.settingsFor(&consumed).VerifiedTTLSeconds); err == nil {
+		s.notifyAuth(ctx, authID, string(SessionConsumed))
+	}
+	return resp, nil
 }
 
 func (s *Service) JWKS() ([]byte, error) {
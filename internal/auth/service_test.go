@@ -6,14 +6,17 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 
 	"mapae/internal/config"
+	"mapae/internal/storage"
 	"mapae/internal/storage/memory"
 )
 
@@ -57,6 +60,26 @@ func newService(t *testing.T, withSigner bool) (*Service, *memory.Client, ed2551
 	return svc, store, pub
 }
 
+// verifyInit는 initResp의 SMS 본문에 담긴 nonce로 세션을 인증
+func verifyInit(t *testing.T, svc *Service, initResp *AuthInitResponse, phone, carrier *string) {
+	t.Helper()
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	if _, ok, err := svc.VerifyByNonce(context.Background(), nonce, phone, carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v), want (true, nil)", ok, err)
+	}
+}
+
+// verifiedSession은 새 세션을 만들어 인증한 뒤 auth_id를 반환
+func verifiedSession(t *testing.T, svc *Service, phone, carrier *string) string {
+	t.Helper()
+	initResp, err := svc.InitAuth(context.Background())
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	verifyInit(t, svc, initResp, phone, carrier)
+	return initResp.AuthID
+}
+
 func TestRandomHex(t *testing.T) {
 	value, err := randomHex(16)
 	if err != nil {
@@ -98,8 +121,8 @@ func TestInitAuthAndVerifyFlow(t *testing.T) {
 	if ok, _ := regexp.MatchString(`^[0-9a-f]{32}$`, initResp.AuthID); !ok {
 		t.Fatalf("AuthID has unexpected format: %q", initResp.AuthID)
 	}
-	if !strings.HasPrefix(initResp.SMSBody, "[MAPAE:") {
-		t.Fatalf("unexpected SMS body: %q", initResp.SMSBody)
+	if !strings.Contains(initResp.SMSBody, "[MAPAE:") || initResp.Locale != "ko" {
+		t.Fatalf("unexpected SMS body: %q (%s)", initResp.SMSBody, initResp.Locale)
 	}
 	if initResp.TTLSeconds != 60 {
 		t.Fatalf("TTLSeconds = %d, want 60", initResp.TTLSeconds)
@@ -119,28 +142,24 @@ func TestInitAuthAndVerifyFlow(t *testing.T) {
 		t.Fatalf("failed to parse nonce from SMS body: %q", initResp.SMSBody)
 	}
 
-	authIDByNonce, ok, err := svc.ConsumeAuthIDByNonce(ctx, match[1])
+	phone := "01012345678"
+	carrier := "KT"
+	finished, ok, err := svc.VerifyByNonce(ctx, match[1], &phone, &carrier)
 	if err != nil {
-		t.Fatalf("ConsumeAuthIDByNonce() error = %v", err)
+		t.Fatalf("VerifyByNonce() error = %v", err)
 	}
-	if !ok || authIDByNonce != initResp.AuthID {
-		t.Fatalf("ConsumeAuthIDByNonce() = (%q,%t), want (%q,true)", authIDByNonce, ok, initResp.AuthID)
+	if !ok || finished.AuthID != initResp.AuthID {
+		t.Fatalf("VerifyByNonce() = (%q,%t), want (%q,true)", finished.AuthID, ok, initResp.AuthID)
 	}
 
-	_, ok, err = svc.ConsumeAuthIDByNonce(ctx, match[1])
+	_, ok, err = svc.VerifyByNonce(ctx, match[1], &phone, &carrier)
 	if err != nil {
-		t.Fatalf("ConsumeAuthIDByNonce(second) error = %v", err)
+		t.Fatalf("VerifyByNonce(second) error = %v", err)
 	}
 	if ok {
 		t.Fatalf("nonce should be one-time consumable")
 	}
 
-	phone := "01012345678"
-	carrier := "KT"
-	if err := svc.StoreVerified(ctx, initResp.AuthID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
-	}
-
 	check, err = svc.CheckAuth(ctx, initResp.AuthID)
 	if err != nil {
 		t.Fatalf("CheckAuth() after verify error = %v", err)
@@ -150,7 +169,7 @@ func TestInitAuthAndVerifyFlow(t *testing.T) {
 	}
 }
 
-func TestCheckAuthValidationAndFallbacks(t *testing.T) {
+func TestCheckAuthValidationAndCorruptRecords(t *testing.T) {
 	svc, store, _ := newService(t, false)
 	ctx := context.Background()
 
@@ -171,24 +190,21 @@ func TestCheckAuthValidationAndFallbacks(t *testing.T) {
 	if err := store.SetEx(ctx, "auth:"+brokenID, "not-json", 60); err != nil {
 		t.Fatalf("SetEx() error = %v", err)
 	}
-	resp, err = svc.CheckAuth(ctx, brokenID)
-	if err != nil {
-		t.Fatalf("CheckAuth broken payload error = %v", err)
+	// 해석할 수 없는 기록을 대기 중으로 보지 않고 오류로 드러냄
+	if _, err := svc.CheckAuth(ctx, brokenID); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("CheckAuth broken payload error = %v, want ErrCorruptRecord", err)
 	}
-	if resp.Status != "waiting" {
-		t.Fatalf("broken payload should map to waiting, got %q", resp.Status)
+	if _, err := svc.CheckSigned(ctx, brokenID); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("CheckSigned broken payload error = %v, want ErrCorruptRecord", err)
 	}
 }
 
 func TestCheckSignedWithoutSignerAndJWKSUnavailable(t *testing.T) {
 	svc, _, _ := newService(t, false)
 	ctx := context.Background()
-	authID := strings.Repeat("c", 32)
 	phone := "01011112222"
 	carrier := "SKT"
-	if err := svc.StoreVerified(ctx, authID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
-	}
+	authID := verifiedSession(t, svc, &phone, &carrier)
 
 	if _, err := svc.CheckSigned(ctx, authID); err != ErrJWKSUnavailable {
 		t.Fatalf("CheckSigned() error = %v, want ErrJWKSUnavailable", err)
@@ -201,12 +217,9 @@ func TestCheckSignedWithoutSignerAndJWKSUnavailable(t *testing.T) {
 func TestCheckSignedWithSignerIssuesTokenAndJWKS(t *testing.T) {
 	svc, _, pub := newService(t, true)
 	ctx := context.Background()
-	authID := strings.Repeat("d", 32)
 	phone := "01099998888"
 	carrier := "LGU+"
-	if err := svc.StoreVerified(ctx, authID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
-	}
+	authID := verifiedSession(t, svc, &phone, &carrier)
 
 	resp, err := svc.CheckSigned(ctx, authID)
 	if err != nil {
@@ -252,11 +265,7 @@ func TestCheckSignedWithSignerIssuesTokenAndJWKS(t *testing.T) {
 func TestCheckSignedWaitingWhenPhoneMissing(t *testing.T) {
 	svc, _, _ := newService(t, true)
 	ctx := context.Background()
-	authID := strings.Repeat("e", 32)
-
-	if err := svc.StoreVerified(ctx, authID, nil, nil); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
-	}
+	authID := verifiedSession(t, svc, nil, nil)
 
 	resp, err := svc.CheckSigned(ctx, authID)
 	if err != nil {
@@ -267,16 +276,12 @@ func TestCheckSignedWaitingWhenPhoneMissing(t *testing.T) {
 	}
 }
 
-func TestStoreVerifiedWritesRFC3339Timestamp(t *testing.T) {
+func TestVerifyByNonceWritesRFC3339Timestamp(t *testing.T) {
 	svc, _, _ := newService(t, false)
 	ctx := context.Background()
-	authID := strings.Repeat("f", 32)
 	phone := "01012344321"
 	carrier := "KT"
-
-	if err := svc.StoreVerified(ctx, authID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
-	}
+	authID := verifiedSession(t, svc, &phone, &carrier)
 
 	resp, err := svc.CheckAuth(ctx, authID)
 	if err != nil {
@@ -286,3 +291,749 @@ func TestStoreVerifiedWritesRFC3339Timestamp(t *testing.T) {
 		t.Fatalf("timestamp %q is not RFC3339: %v", resp.Timestamp, err)
 	}
 }
+
+func TestVerifyByNonceConsumesAndStoresAtomically(t *testing.T) {
+	svc, store, _ := newService(t, false)
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+
+	phone := "01012345678"
+	carrier := "KT"
+	finished, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier)
+	if err != nil || !ok || finished.AuthID != initResp.AuthID {
+		t.Fatalf("VerifyByNonce() = (%q,%t,%v), want (%q,true,nil)", finished.AuthID, ok, err, initResp.AuthID)
+	}
+	if _, ok, _ := store.Get(ctx, "nonce:"+nonce); ok {
+		t.Fatalf("nonce should be consumed")
+	}
+
+	check, err := svc.CheckAuth(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("CheckAuth() error = %v", err)
+	}
+	if check.Status != "verified" || check.Phone != phone || check.Carrier != carrier {
+		t.Fatalf("unexpected verified response: %#v", check)
+	}
+
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || ok {
+		t.Fatalf("second VerifyByNonce() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+// reissuingStore는 첫 TakeAndSetEx 직전에 reissue를 실행해 nonce가 다른 세션에 다시 발급된 상황을 만듦
+type reissuingStore struct {
+	*memory.Client
+	reissue func()
+}
+
+func (s *reissuingStore) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	if s.reissue != nil {
+		s.reissue()
+		s.reissue = nil
+	}
+	return s.Client.TakeAndSetEx(ctx, key, expected, target, value, ttlSeconds)
+}
+
+func TestVerifyByNonceIgnoresStaleMessageForReissuedCode(t *testing.T) {
+	settings, _ := makeSettings(t, false)
+	backend, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	store := &reissuingStore{Client: backend}
+	svc, err := New(store, settings)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	first, nonce := initNonce(t, svc, InitOptions{})
+	second, _ := initNonce(t, svc, InitOptions{Client: &ClientData{ClientReference: "user-42"}})
+	// 첫 세션이 nonce를 읽은 뒤 취소되고 같은 코드가 두 번째 세션에 발급된 상황
+	store.reissue = func() {
+		_, _, _ = backend.Take(ctx, "nonce:"+nonce)
+		_ = backend.SetEx(ctx, "nonce:"+nonce, second, 60)
+	}
+
+	// 첫 세션에 보낸 메시지이므로 두 번째 세션을 건드리지 않고 찾지 못한 것으로 처리
+	phone, carrier := "01012345678", "KT"
+	if finished, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || ok {
+		t.Fatalf("VerifyByNonce() = (%q,%t,%v), want not found", finished.AuthID, ok, err)
+	}
+	check, err := svc.CheckAuth(ctx, second)
+	if err != nil || check.Status != StatusWaiting || check.ClientReference != "user-42" {
+		t.Fatalf("reissued CheckAuth() = (%#v, %v), want waiting with its client data", check, err)
+	}
+	if got, ok, _ := backend.Get(ctx, "nonce:"+nonce); !ok || got != second {
+		t.Fatalf("reissued nonce = (%q,%t), want (%q,true)", got, ok, second)
+	}
+	if check, err := svc.CheckAuth(ctx, first); err != nil || check.Status != StatusWaiting {
+		t.Fatalf("first CheckAuth() = (%#v, %v), want waiting", check, err)
+	}
+}
+
+func TestCheckReportsRemainingTTL(t *testing.T) {
+	svc, _, _ := newService(t, true)
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	check, err := svc.CheckAuth(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("CheckAuth() error = %v", err)
+	}
+	if check.Status != "waiting" || check.ExpiresIn <= 0 || check.ExpiresIn > 60 {
+		t.Fatalf("pending expires_in = %d, want (0,60]", check.ExpiresIn)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, check.ExpiresAt)
+	if err != nil {
+		t.Fatalf("expires_at %q is not RFC3339: %v", check.ExpiresAt, err)
+	}
+	if d := time.Until(expiresAt); d < 55*time.Second || d > 61*time.Second {
+		t.Fatalf("expires_at is %s from now, want about 60s", d)
+	}
+
+	phone := "01012345678"
+	carrier := "SKT"
+	verifyInit(t, svc, initResp, &phone, &carrier)
+	signed, err := svc.CheckSigned(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("CheckSigned() error = %v", err)
+	}
+	if signed.Status != "verified" || signed.ExpiresIn <= 0 || signed.ExpiresIn > 30 || signed.ExpiresAt == "" {
+		t.Fatalf("verified expiry = (%d,%q), want (0,30]", signed.ExpiresIn, signed.ExpiresAt)
+	}
+
+	expired, err := svc.CheckAuth(ctx, strings.Repeat("c", 32))
+	if err != nil {
+		t.Fatalf("CheckAuth() expired error = %v", err)
+	}
+	if expired.ExpiresIn != 0 || expired.ExpiresAt != "" {
+		t.Fatalf("expired response should not carry expiry: %#v", expired)
+	}
+}
+
+func TestVerifyPublishesToSubscribers(t *testing.T) {
+	svc, _, _ := newService(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	if _, err := svc.SubscribeAuth(ctx, "bad-id"); err != ErrInvalidAuthID {
+		t.Fatalf("SubscribeAuth() invalid id error = %v, want ErrInvalidAuthID", err)
+	}
+	events, err := svc.SubscribeAuth(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("SubscribeAuth() error = %v", err)
+	}
+
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	phone := "01012345678"
+	carrier := "LGU+"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	select {
+	case status := <-events:
+		if status != "verified" {
+			t.Fatalf("event = %q, want verified", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscriber was not notified")
+	}
+}
+
+func TestEncryptedRecordsAreTransparent(t *testing.T) {
+	settings, _ := makeSettings(t, false)
+	settings.StoreEncryptionKeys = []string{"k1:" + testKey('a')}
+	settings.StoreEncryptNonces = true
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	svc, err := New(store, settings)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	rawNonce, _, _ := store.Get(ctx, "nonce:"+nonce)
+	if !strings.HasPrefix(rawNonce, sealedPrefix) || strings.Contains(rawNonce, initResp.AuthID) {
+		t.Fatalf("nonce value should be sealed, got %q", rawNonce)
+	}
+
+	phone := "01012345678"
+	carrier := "SKT"
+	finished, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier)
+	if err != nil || !ok || finished.AuthID != initResp.AuthID {
+		t.Fatalf("VerifyByNonce() = (%q,%t,%v), want (%q,true,nil)", finished.AuthID, ok, err, initResp.AuthID)
+	}
+	rawAuth, _, _ := store.Get(ctx, "auth:"+finished.AuthID)
+	if !strings.HasPrefix(rawAuth, sealedPrefix) || strings.Contains(rawAuth, phone) {
+		t.Fatalf("auth record should be sealed, got %q", rawAuth)
+	}
+	check, err := svc.CheckAuth(ctx, finished.AuthID)
+	if err != nil || check.Status != "verified" || check.Phone != phone {
+		t.Fatalf("CheckAuth() = (%#v,%v)", check, err)
+	}
+
+	// 암호화된 기록을 다른 auth_id로 옮기면 읽지 않아야 함
+	movedID := strings.Repeat("e", 32)
+	if err := store.SetEx(ctx, "auth:"+movedID, rawAuth, 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if _, err := svc.CheckAuth(ctx, movedID); err == nil {
+		t.Fatal("CheckAuth() of a record moved from another auth_id error = nil")
+	}
+
+	// 평문 세션은 STORE_ENCRYPTION_ALLOW_LEGACY를 켠 동안에만 읽음
+	legacyID := strings.Repeat("d", 32)
+	if err := store.SetEx(ctx, "auth:"+legacyID, `{"status":"pending"}`, 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if _, err := svc.CheckAuth(ctx, legacyID); !errors.Is(err, ErrUnsealedValue) {
+		t.Fatalf("CheckAuth() legacy error = %v, want ErrUnsealedValue", err)
+	}
+	settings.StoreEncryptionAllowLegacy = true
+	migrating, err := New(store, settings)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if legacy, err := migrating.CheckAuth(ctx, legacyID); err != nil || legacy.Status != "waiting" {
+		t.Fatalf("CheckAuth() legacy while migrating = (%#v,%v)", legacy, err)
+	}
+}
+
+func TestEncryptNoncesRequiresKeys(t *testing.T) {
+	settings, _ := makeSettings(t, false)
+	settings.StoreEncryptNonces = true
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	if _, err := New(store, settings); err == nil {
+		t.Fatalf("New() should fail when nonce encryption has no keys")
+	}
+}
+
+// countingStore는 쓰기 호출 횟수를 셈
+type countingStore struct {
+	*memory.Client
+	setEx, msetEx int
+}
+
+func (s *countingStore) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	s.setEx++
+	return s.Client.SetEx(ctx, key, value, ttlSeconds)
+}
+
+func (s *countingStore) MSetEx(ctx context.Context, entries ...storage.Entry) error {
+	s.msetEx++
+	return s.Client.MSetEx(ctx, entries...)
+}
+
+func TestInitAuthWritesSessionAndNonceInOneCall(t *testing.T) {
+	settings, _ := makeSettings(t, false)
+	backend, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	store := &countingStore{Client: backend}
+	svc, err := New(store, settings)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	if store.msetEx != 1 || store.setEx != 0 {
+		t.Fatalf("InitAuth() made %d MSetEx and %d SetEx calls, want 1 and 0", store.msetEx, store.setEx)
+	}
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	if got, ok, _ := backend.Get(ctx, "nonce:"+nonce); !ok || got != initResp.AuthID {
+		t.Fatalf("nonce record = (%q,%t), want (%q,true)", got, ok, initResp.AuthID)
+	}
+	if _, ok, _ := backend.Get(ctx, "auth:"+initResp.AuthID); !ok {
+		t.Fatalf("session record missing")
+	}
+}
+
+// collidingStore는 처음 collisions번의 AddEx를 이미 쓰이는 코드처럼 거절
+type collidingStore struct {
+	*memory.Client
+	collisions, addEx int
+}
+
+func (s *collidingStore) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	s.addEx++
+	if s.collisions > 0 {
+		s.collisions--
+		return false, nil
+	}
+	return s.Client.AddEx(ctx, key, value, ttlSeconds)
+}
+
+func TestInitAuthShortNonceRetriesOnCollision(t *testing.T) {
+	settings, _ := makeSettings(t, false)
+	settings.NonceFormat = "base32"
+	settings.NonceTag = "OTP"
+	backend, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	store := &collidingStore{Client: backend, collisions: 2}
+	svc, err := New(store, settings)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	if store.addEx != 3 {
+		t.Fatalf("InitAuth() made %d AddEx calls, want 3", store.addEx)
+	}
+	match := regexp.MustCompile(`\[OTP:([0-9A-Z]{9})\]$`).FindStringSubmatch(initResp.SMSBody)
+	if match == nil {
+		t.Fatalf("SMS body = %q, want [OTP:<9 characters>]", initResp.SMSBody)
+	}
+
+	// 손으로 입력한 형태(소문자, 구분자)도 같은 nonce로 인증
+	typed := strings.ToLower(match[1][:4] + "-" + match[1][4:])
+	phone, carrier := "01012345678", "KT"
+	finished, ok, err := svc.VerifyByNonce(ctx, typed, &phone, &carrier)
+	if err != nil || !ok || finished.AuthID != initResp.AuthID {
+		t.Fatalf("VerifyByNonce(%q) = (%q,%t,%v), want (%q,true,nil)", typed, finished.AuthID, ok, err, initResp.AuthID)
+	}
+
+	store.collisions = maxNonceAttempts
+	if _, err := svc.InitAuth(ctx); err == nil {
+		t.Fatalf("InitAuth() should fail when every code collides")
+	}
+}
+
+// keyRecordingStore는 AddEx와 MSetEx가 한 번에 쓴 키 묶음을 기록
+type keyRecordingStore struct {
+	*memory.Client
+	writes [][]string
+}
+
+func (s *keyRecordingStore) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	s.writes = append(s.writes, []string{key})
+	return s.Client.AddEx(ctx, key, value, ttlSeconds)
+}
+
+func (s *keyRecordingStore) MSetEx(ctx context.Context, entries ...storage.Entry) error {
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	s.writes = append(s.writes, keys)
+	return s.Client.MSetEx(ctx, entries...)
+}
+
+func TestKeyHashTagGroupsKeysPerSession(t *testing.T) {
+	for _, format := range []string{"hex64", "base32"} {
+		t.Run(format, func(t *testing.T) {
+			settings, _ := makeSettings(t, false)
+			settings.NonceFormat = format
+			settings.SessionTombstoneTTLSeconds = 600
+			backend, err := memory.New()
+			if err != nil {
+				t.Fatalf("memory.New() error = %v", err)
+			}
+			store := &keyRecordingStore{Client: backend}
+			svc, err := New(store, settings)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			ctx := context.Background()
+
+			tags := map[string]bool{}
+			for i := 0; i < 8; i++ {
+				store.writes = nil
+				initResp, err := svc.InitAuth(ctx)
+				if err != nil {
+					t.Fatalf("InitAuth() error = %v", err)
+				}
+				tag := KeyHashTag(sessionKey(initResp.AuthID))
+				if tag == "" {
+					t.Fatalf("KeyHashTag(%q) is empty", sessionKey(initResp.AuthID))
+				}
+				for _, keys := range store.writes {
+					for _, key := range keys {
+						if got := KeyHashTag(key); got != tag {
+							t.Fatalf("KeyHashTag(%q) = %q, want %q like the session key", key, got, tag)
+						}
+					}
+				}
+				tags[tag] = true
+			}
+			// 세션마다 태그가 달라 클러스터의 슬롯에 흩어짐(8개가 모두 겹칠 확률은 무시할 만함)
+			if len(tags) < 2 {
+				t.Fatalf("8 sessions share hash tags %v, want them spread", tags)
+			}
+		})
+	}
+}
+
+func TestClientDataFlowsToCheckAndToken(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		settings, pub := makeSettings(t, true)
+		if encrypt {
+			settings.StoreEncryptionKeys = []string{"k1:" + testKey('a')}
+			settings.StoreEncryptNonces = true
+		}
+		store, err := memory.New()
+		if err != nil {
+			t.Fatalf("memory.New() error = %v", err)
+		}
+		svc, err := New(store, settings)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		ctx := context.Background()
+
+		client := &ClientData{State: "xyz", ClientReference: "user-42", Metadata: map[string]string{"plan": "pro"}}
+		initResp, err := svc.InitAuthWithOptions(ctx, InitOptions{Client: client})
+		if err != nil {
+			t.Fatalf("InitAuthWithOptions() error = %v", err)
+		}
+		check, err := svc.CheckAuth(ctx, initResp.AuthID)
+		if err != nil || check.Status != "waiting" || check.State != "xyz" || check.ClientReference != "user-42" || check.Metadata["plan"] != "pro" {
+			t.Fatalf("encrypt=%t: waiting CheckAuth() = (%#v, %v)", encrypt, check, err)
+		}
+
+		nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+		phone := "01012345678"
+		carrier := "KT"
+		if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok {
+			t.Fatalf("encrypt=%t: VerifyByNonce() = (ok=%t, err=%v)", encrypt, ok, err)
+		}
+		signed, err := svc.CheckSigned(ctx, initResp.AuthID)
+		if err != nil || signed.Status != "verified" || signed.State != "xyz" || signed.ClientReference != "user-42" {
+			t.Fatalf("encrypt=%t: CheckSigned() = (%#v, %v)", encrypt, signed, err)
+		}
+		parsed, err := jwt.Parse(signed.Token, func(*jwt.Token) (interface{}, error) { return pub, nil })
+		if err != nil {
+			t.Fatalf("jwt.Parse() error = %v", err)
+		}
+		claims := parsed.Claims.(jwt.MapClaims)
+		metadata, _ := claims["metadata"].(map[string]interface{})
+		if claims["state"] != "xyz" || claims["client_reference"] != "user-42" || metadata["plan"] != "pro" {
+			t.Fatalf("encrypt=%t: unexpected claims: %#v", encrypt, claims)
+		}
+	}
+}
+
+func TestInitAuthRejectsInvalidClientData(t *testing.T) {
+	svc, _, _ := newService(t, false)
+
+	_, err := svc.InitAuthWithOptions(context.Background(), InitOptions{Client: &ClientData{State: strings.Repeat("s", MaxStateLength+1)}})
+	if !errors.Is(err, ErrInvalidClientData) {
+		t.Fatalf("InitAuthWithOptions() error = %v, want ErrInvalidClientData", err)
+	}
+}
+
+func TestTokenOmitsClientClaimsWithoutClientData(t *testing.T) {
+	svc, _, pub := newService(t, true)
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuthWithOptions(ctx, InitOptions{Client: &ClientData{}})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	phone := "01012345678"
+	carrier := "KT"
+	verifyInit(t, svc, initResp, &phone, &carrier)
+	signed, err := svc.CheckSigned(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("CheckSigned() error = %v", err)
+	}
+	parsed, err := jwt.Parse(signed.Token, func(*jwt.Token) (interface{}, error) { return pub, nil })
+	if err != nil {
+		t.Fatalf("jwt.Parse() error = %v", err)
+	}
+	for _, name := range []string{"state", "client_reference", "metadata"} {
+		if _, ok := parsed.Claims.(jwt.MapClaims)[name]; ok {
+			t.Fatalf("token should not carry %q claim without client data", name)
+		}
+	}
+}
+
+func TestExpectedPhoneBinding(t *testing.T) {
+	svc, _, _ := newService(t, true)
+	ctx := context.Background()
+	nonceRe := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`)
+	carrier := "KT"
+
+	matching, err := svc.InitAuthWithOptions(ctx, InitOptions{ExpectedPhone: "010-1234-5678"})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	phone := "01012345678"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonceRe.FindStringSubmatch(matching.SMSBody)[1], &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce(expected phone) = (ok=%t, err=%v)", ok, err)
+	}
+	if check, err := svc.CheckSigned(ctx, matching.AuthID); err != nil || check.Status != "verified" || check.Token == "" {
+		t.Fatalf("CheckSigned(expected phone) = (%#v, %v)", check, err)
+	}
+
+	mismatched, err := svc.InitAuthWithOptions(ctx, InitOptions{ExpectedPhoneHash: PhoneHash("01099998888")})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	nonce := nonceRe.FindStringSubmatch(mismatched.SMSBody)[1]
+	finished, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier)
+	if !errors.Is(err, ErrPhoneMismatch) || !ok || finished.AuthID != mismatched.AuthID {
+		t.Fatalf("VerifyByNonce(other phone) = (%q,%t,%v), want (%q,true,ErrPhoneMismatch)", finished.AuthID, ok, err, mismatched.AuthID)
+	}
+	check, err := svc.CheckSigned(ctx, mismatched.AuthID)
+	if err != nil || check.Status != StatusFailed || check.Reason != string(FailurePhoneMismatch) || check.Phone != "" || check.Token != "" || check.Carrier != carrier {
+		t.Fatalf("CheckSigned(mismatch) = (%#v, %v), want failed phone_mismatch without phone and token", check, err)
+	}
+	// nonce는 소비되었으므로 올바른 번호로 다시 보내도 인증되지 않음
+	expected := "01099998888"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &expected, &carrier); err != nil || ok {
+		t.Fatalf("VerifyByNonce(after mismatch) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+
+	if _, err := svc.InitAuthWithOptions(ctx, InitOptions{ExpectedPhone: "not-a-phone"}); !errors.Is(err, ErrInvalidExpectedPhone) {
+		t.Fatalf("InitAuthWithOptions(bad phone) error = %v, want ErrInvalidExpectedPhone", err)
+	}
+}
+
+func TestCheckDistinguishesExpiredFromUnknown(t *testing.T) {
+	svc, store, _ := newService(t, false)
+	svc.settings.SessionTombstoneTTLSeconds = 3600
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	// 대기 기록이 TTL로 사라진 상황
+	if _, _, err := store.Take(ctx, "auth:"+initResp.AuthID); err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if check, err := svc.CheckAuth(ctx, initResp.AuthID); err != nil || check.Status != StatusExpired {
+		t.Fatalf("CheckAuth(expired) = (%#v, %v), want expired", check, err)
+	}
+	if check, err := svc.CheckSigned(ctx, strings.Repeat("d", 32)); err != nil || check.Status != StatusUnknown {
+		t.Fatalf("CheckSigned(unknown) = (%#v, %v), want unknown", check, err)
+	}
+}
+
+func TestCancelAuth(t *testing.T) {
+	svc, store, _ := newService(t, false)
+	ctx := context.Background()
+
+	initResp, err := svc.InitAuthWithOptions(ctx, InitOptions{Client: &ClientData{State: "xyz"}})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	events, err := svc.SubscribeAuth(ctx, initResp.AuthID)
+	if err != nil {
+		t.Fatalf("SubscribeAuth() error = %v", err)
+	}
+	resp, err := svc.CancelAuth(ctx, initResp.AuthID)
+	if err != nil || resp.Status != StatusCancelled || resp.State != "xyz" {
+		t.Fatalf("CancelAuth() = (%#v, %v), want cancelled", resp, err)
+	}
+	select {
+	case status := <-events:
+		if status != StatusCancelled {
+			t.Fatalf("event = %q, want cancelled", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscriber was not notified")
+	}
+
+	// 취소한 세션의 nonce는 지워져 인증할 수 없음
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	if _, ok, _ := store.Get(ctx, "nonce:"+nonce); ok {
+		t.Fatalf("nonce should be removed on cancel")
+	}
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || ok {
+		t.Fatalf("VerifyByNonce(cancelled) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	resp, err = svc.CancelAuth(ctx, initResp.AuthID)
+	if !errors.Is(err, ErrNotCancellable) || resp.Status != StatusCancelled {
+		t.Fatalf("second CancelAuth() = (%#v, %v), want cancelled with ErrNotCancellable", resp, err)
+	}
+
+	verified, err := svc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	verifyInit(t, svc, verified, &phone, &carrier)
+	if resp, err := svc.CancelAuth(ctx, verified.AuthID); !errors.Is(err, ErrNotCancellable) || resp.Status != StatusVerified {
+		t.Fatalf("CancelAuth(verified) = (%#v, %v), want verified with ErrNotCancellable", resp, err)
+	}
+	if _, err := svc.CancelAuth(ctx, "bad-id"); err != ErrInvalidAuthID {
+		t.Fatalf("CancelAuth(bad-id) error = %v, want ErrInvalidAuthID", err)
+	}
+}
+
+func TestFailByNonceRecordsReason(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		settings, _ := makeSettings(t, false)
+		if encrypt {
+			settings.StoreEncryptionKeys = []string{"k1:" + testKey('a')}
+			settings.StoreEncryptNonces = true
+		}
+		store, err := memory.New()
+		if err != nil {
+			t.Fatalf("memory.New() error = %v", err)
+		}
+		svc, err := New(store, settings)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		ctx := context.Background()
+
+		initResp, err := svc.InitAuthWithOptions(ctx, InitOptions{Client: &ClientData{ClientReference: "user-42"}})
+		if err != nil {
+			t.Fatalf("InitAuthWithOptions() error = %v", err)
+		}
+		nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+		finished, ok, err := svc.FailByNonce(ctx, nonce, FailureSPF)
+		if err != nil || !ok || finished.AuthID != initResp.AuthID {
+			t.Fatalf("encrypt=%t: FailByNonce() = (%q,%t,%v), want (%q,true,nil)", encrypt, finished.AuthID, ok, err, initResp.AuthID)
+		}
+		check, err := svc.CheckAuth(ctx, initResp.AuthID)
+		if err != nil || check.Status != StatusFailed || check.Reason != string(FailureSPF) || check.ClientReference != "user-42" {
+			t.Fatalf("encrypt=%t: CheckAuth() = (%#v, %v), want failed spf_fail", encrypt, check, err)
+		}
+		// 실패한 세션은 같은 nonce로 인증할 수 없음
+		phone, carrier := "01012345678", "KT"
+		if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || ok {
+			t.Fatalf("encrypt=%t: VerifyByNonce(failed) = (ok=%t, err=%v), want (false, nil)", encrypt, ok, err)
+		}
+	}
+}
+
+func TestCheckSignedIssuesUniqueJTI(t *testing.T) {
+	svc, _, pub := newService(t, true)
+	ctx := context.Background()
+	phone, carrier := "01012345678", "KT"
+	authID := verifiedSession(t, svc, &phone, &carrier)
+
+	seen := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		signed, err := svc.CheckSigned(ctx, authID)
+		if err != nil || signed.Status != StatusVerified || signed.Token == "" {
+			t.Fatalf("CheckSigned() = (%#v, %v), want verified with token", signed, err)
+		}
+		parsed, err := jwt.Parse(signed.Token, func(*jwt.Token) (interface{}, error) { return pub, nil })
+		if err != nil {
+			t.Fatalf("jwt.Parse() error = %v", err)
+		}
+		jti := parsed.Claims.(jwt.MapClaims)["jti"]
+		if jti == authID || seen[jti] {
+			t.Fatalf("jti = %v, want a new value per token", jti)
+		}
+		seen[jti] = true
+	}
+}
+
+func TestSingleUseSignedResult(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		settings, _ := makeSettings(t, true)
+		settings.SignedResultSingleUse = true
+		if encrypt {
+			settings.StoreEncryptionKeys = []string{"k1:" + testKey('a')}
+		}
+		store, err := memory.New()
+		if err != nil {
+			t.Fatalf("memory.New() error = %v", err)
+		}
+		svc, err := New(store, settings)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		ctx := context.Background()
+
+		initResp, err := svc.InitAuthWithOptions(ctx, InitOptions{Client: &ClientData{State: "xyz"}})
+		if err != nil {
+			t.Fatalf("InitAuthWithOptions() error = %v", err)
+		}
+		// 대기 중인 세션은 소비하지 않음
+		if check, err := svc.CheckSigned(ctx, initResp.AuthID); err != nil || check.Status != StatusWaiting {
+			t.Fatalf("encrypt=%t: CheckSigned(waiting) = (%#v, %v)", encrypt, check, err)
+		}
+		phone, carrier := "01012345678", "KT"
+		verifyInit(t, svc, initResp, &phone, &carrier)
+		events, err := svc.SubscribeAuth(ctx, initResp.AuthID)
+		if err != nil {
+			t.Fatalf("SubscribeAuth() error = %v", err)
+		}
+
+		// 동시에 요청해도 토큰은 한 번만 발급
+		results := make(chan *AuthCheckResponse, 8)
+		var wg sync.WaitGroup
+		for i := 0; i < cap(results); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := svc.CheckSigned(ctx, initResp.AuthID)
+				if err != nil {
+					t.Errorf("encrypt=%t: CheckSigned() error = %v", encrypt, err)
+					return
+				}
+				results <- resp
+			}()
+		}
+		wg.Wait()
+		close(results)
+		tokens := 0
+		for resp := range results {
+			if resp.Token == "" {
+				continue
+			}
+			tokens++
+			if resp.Status != StatusVerified || resp.Phone != phone || resp.State != "xyz" {
+				t.Fatalf("encrypt=%t: consuming response = %#v", encrypt, resp)
+			}
+		}
+		if tokens != 1 {
+			t.Fatalf("encrypt=%t: %d responses carried a token, want 1", encrypt, tokens)
+		}
+		select {
+		case status := <-events:
+			if status != StatusConsumed {
+				t.Fatalf("event = %q, want consumed", status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber was not notified")
+		}
+
+		for _, check := range []func(context.Context, string) (*AuthCheckResponse, error){svc.CheckSigned, svc.CheckAuth} {
+			resp, err := check(ctx, initResp.AuthID)
+			if err != nil || resp.Status != StatusConsumed || resp.Token != "" || resp.Phone != "" || resp.State != "xyz" || resp.ExpiresIn <= 0 {
+				t.Fatalf("encrypt=%t: check after consume = (%#v, %v), want consumed without result", encrypt, resp, err)
+			}
+		}
+	}
+}
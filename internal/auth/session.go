@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"mapae/internal/storage"
+)
+
+// SessionSchemaVersion은 이 버전이 기록하는 세션 기록의 스키마 버전
+//
+// 배포 중에는 이전 버전과 새 버전이 같은 기록을 번갈아 읽으므로 스키마는 필드 추가로만 바꿈
+// 기존 필드의 이름과 의미를 유지하면 이전 버전은 모르는 필드를 무시하고 새 기록을 읽을 수 있음
+//
+//   - v1: 버전 필드가 없는 {"status","timestamp","phone","carrier"}
+//   - v2: "v" 필드 추가
+//   - v3: 클라이언트 정보 "state", "client_reference", "metadata" 추가
+//   - v4: 예상 번호 "expected_phone_hash" 추가. 다른 번호에서 온 문자는 failed(phone_mismatch)로 기록
+//   - v5: 상태 "failed", "cancelled", "consumed"와 실패 사유 "reason", 취소용 "nonce" 추가
+//   - v6: 세션별 웹훅 주소 "webhook_url" 추가
+//   - v7: 세션을 만든 클라이언트 "tenant" 추가
+const SessionSchemaVersion = 7
+
+var (
+	// ErrCorruptRecord는 세션 기록을 해석할 수 없을 때 반환(JSON 오류, 상태 누락, 잘못된 시각 등)
+	ErrCorruptRecord = errors.New("corrupt_session_record")
+	// ErrUnsupportedRecord는 더 새로운 버전이 기록한 세션에 이 버전이 모르는 상태가 있을 때 반환
+	ErrUnsupportedRecord = errors.New("unsupported_session_record")
+)
+
+// SessionStatus는 세션 상태
+//
+//	pending ─┬─> verified ──> consumed
+//	         ├─> failed
+//	         └─> cancelled
+//
+// 어느 상태든 기록이 TTL로 사라지면 expired이며, 기록에는 남지 않음
+type SessionStatus string
+
+const (
+	SessionPending  SessionStatus = "pending"
+	SessionVerified SessionStatus = "verified"
+	// SessionFailed는 SMTP 단계에서 문자를 거부한 세션. 사유는 Reason
+	SessionFailed SessionStatus = "failed"
+	// SessionCancelled는 클라이언트가 취소한 세션
+	SessionCancelled SessionStatus = "cancelled"
+	// SessionConsumed는 인증 결과를 가져가 더 읽을 수 없는 세션
+	SessionConsumed SessionStatus = "consumed"
+)
+
+// sessionTransitions는 허용하는 상태 전이. 여기에 없는 상태는 종료 상태
+var sessionTransitions = map[SessionStatus][]SessionStatus{
+	SessionPending:  {SessionVerified, SessionFailed, SessionCancelled},
+	SessionVerified: {SessionConsumed},
+}
+
+func (s SessionStatus) known() bool {
+	switch s {
+	case SessionPending, SessionVerified, SessionFailed, SessionCancelled, SessionConsumed:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTransition은 s에서 to로 바꿀 수 있는지 여부
+func (s SessionStatus) CanTransition(to SessionStatus) bool {
+	for _, next := range sessionTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FailureReason은 failed 세션의 원인
+type FailureReason string
+
+const (
+	// FailureSPF는 발신 서버가 SPF 검사를 통과하지 못한 경우
+	FailureSPF FailureReason = "spf_fail"
+	// FailureUnknownCarrier는 발신 주소가 알려진 통신사 도메인이 아닌 경우
+	FailureUnknownCarrier FailureReason = "unknown_carrier"
+	// FailurePhoneMismatch는 예상 번호와 다른 번호에서 nonce가 온 경우
+	FailurePhoneMismatch FailureReason = "phone_mismatch"
+)
+
+// SessionRecord는 auth:<auth_id>에 저장되는 세션 기록
+type SessionRecord struct {
+	// Version은 기록을 쓴 스키마 버전(읽은 기록에만 채워지며, 쓸 때는 SessionSchemaVersion을 사용)
+	Version int
+	Status  SessionStatus
+	Phone   string
+	Carrier string
+	// Timestamp는 pending이면 세션 생성 시각, 그 밖에는 상태가 바뀐 시각
+	Timestamp time.Time
+	// Reason은 failed 세션의 원인
+	Reason FailureReason
+	// Nonce는 취소할 때 함께 지울 nonce 코드(정규형)
+	Nonce string
+	// Client는 /auth/init에서 받은 클라이언트 정보이며, 없으면 nil
+	Client *ClientData
+	// ExpectedPhoneHash는 인증할 수 있는 번호의 PhoneHash이며, 비어 있으면 어느 번호든 허용
+	ExpectedPhoneHash string
+	// WebhookURL은 결과를 알릴 세션별 주소이며, 비어 있으면 기본 주소
+	WebhookURL string
+	// Tenant는 세션을 만든 클라이언트 ID이며, 클라이언트를 등록하지 않았으면 비어 있음
+	Tenant string
+}
+
+// sessionRecordJSON은 저장 형식. v1 필드 이름을 그대로 유지해야 함
+type sessionRecordJSON struct {
+	Version   int    `json:"v,omitempty"`
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Carrier   string `json:"carrier,omitempty"`
+	// v3
+	State           string            `json:"state,omitempty"`
+	ClientReference string            `json:"client_reference,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	// v4
+	ExpectedPhoneHash string `json:"expected_phone_hash,omitempty"`
+	// v5
+	Reason string `json:"reason,omitempty"`
+	Nonce  string `json:"nonce,omitempty"`
+	// v6
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// v7
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func encodeSessionRecord(rec SessionRecord) (string, error) {
+	if !rec.Status.known() {
+		return "", fmt.Errorf("unknown session status %q", rec.Status)
+	}
+	wire := sessionRecordJSON{
+		Version: SessionSchemaVersion,
+		Status:  string(rec.Status),
+		Phone:   rec.Phone,
+		Carrier: rec.Carrier,
+
+		ExpectedPhoneHash: rec.ExpectedPhoneHash,
+		Reason:            string(rec.Reason),
+		Nonce:             rec.Nonce,
+		WebhookURL:        rec.WebhookURL,
+		Tenant:            rec.Tenant,
+	}
+	if rec.Client != nil {
+		wire.State = rec.Client.State
+		wire.ClientReference = rec.Client.ClientReference
+		wire.Metadata = rec.Client.Metadata
+	}
+	if !rec.Timestamp.IsZero() {
+		wire.Timestamp = rec.Timestamp.UTC().Format(time.RFC3339)
+	}
+	data, err := json.Marshal(wire)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeSessionRecord는 v1부터 현재 버전까지의 기록을 읽음
+// 더 새로운 버전의 기록은 아는 필드만 읽으며, 모르는 상태가 있으면 ErrUnsupportedRecord
+func decodeSessionRecord(data string) (*SessionRecord, error) {
+	var wire sessionRecordJSON
+	if err := json.Unmarshal([]byte(data), &wire); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+	}
+	version := wire.Version
+	switch {
+	case version == 0:
+		// 버전 필드가 없는 기록은 v1
+		version = 1
+	case version < 0:
+		return nil, fmt.Errorf("%w: invalid version %d", ErrCorruptRecord, version)
+	}
+	rec := &SessionRecord{
+		Version: version,
+		Status:  SessionStatus(wire.Status),
+		Phone:   wire.Phone,
+		Carrier: wire.Carrier,
+
+		ExpectedPhoneHash: wire.ExpectedPhoneHash,
+		Reason:            FailureReason(wire.Reason),
+		Nonce:             wire.Nonce,
+		WebhookURL:        wire.WebhookURL,
+		Tenant:            wire.Tenant,
+	}
+	if client := (&ClientData{State: wire.State, ClientReference: wire.ClientReference, Metadata: wire.Metadata}); !client.empty() {
+		rec.Client = client
+	}
+	if rec.Status == "" {
+		return nil, fmt.Errorf("%w: missing status", ErrCorruptRecord)
+	}
+	if !rec.Status.known() {
+		if version > SessionSchemaVersion {
+			return nil, fmt.Errorf("%w: status %q from schema v%d", ErrUnsupportedRecord, rec.Status, version)
+		}
+		return nil, fmt.Errorf("%w: unknown status %q", ErrCorruptRecord, rec.Status)
+	}
+	if wire.Timestamp != "" {
+		ts, err := time.Parse(time.RFC3339, wire.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid timestamp %q", ErrCorruptRecord, wire.Timestamp)
+		}
+		rec.Timestamp = ts
+	}
+	return rec, nil
+}
+
+// sessionRepository는 세션 기록을 버전이 붙은 형식으로 인코딩하고(암호화 설정 시 암호화) 저장소에 읽고 씀
+type sessionRepository struct {
+	store  storage.Store
+	sealer *sealer
+}
+
+func sessionKey(authID string) string {
+	return fmt.Sprintf("auth:%s", authID)
+}
+
+// encode는 저장소에 그대로 쓸 값을 만듦(TakeAndSetEx처럼 Save를 거치지 않고 기록하는 경우에 사용)
+func (r *sessionRepository) encode(authID string, rec SessionRecord) (string, error) {
+	data, err := encodeSessionRecord(rec)
+	if err != nil {
+		return "", err
+	}
+	return r.sealer.seal("auth", sessionKey(authID), data)
+}
+
+func (r *sessionRepository) Save(ctx context.Context, authID string, rec SessionRecord, ttlSeconds int) error {
+	value, err := r.encode(authID, rec)
+	if err != nil {
+		return err
+	}
+	return r.store.SetEx(ctx, sessionKey(authID), value, ttlSeconds)
+}
+
+// Load는 세션 기록을 읽으며, 기록이 없거나 만료되었으면 ok=false
+// 해석할 수 없는 기록은 대기 중으로 취급하지 않고 ErrCorruptRecord/ErrUnsupportedRecord를 반환
+func (r *sessionRepository) Load(ctx context.Context, authID string) (*SessionRecord, bool, error) {
+	value, ok, err := r.store.Get(ctx, sessionKey(authID))
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return r.decode(authID, value)
+}
+
+// Take는 세션 기록을 읽고 원자적으로 지움. 동시에 호출해도 한 호출만 ok=true
+func (r *sessionRepository) Take(ctx context.Context, authID string) (*SessionRecord, bool, error) {
+	value, ok, err := r.store.Take(ctx, sessionKey(authID))
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return r.decode(authID, value)
+}
+
+func (r *sessionRepository) decode(authID, value string) (*SessionRecord, bool, error) {
+	plain, err := r.sealer.open("auth", sessionKey(authID), value)
+	if err != nil {
+		return nil, false, fmt.Errorf("open auth record: %w", err)
+	}
+	rec, err := decodeSessionRecord(plain)
+	if err != nil {
+		return nil, false, fmt.Errorf("auth record %s: %w", authID, err)
+	}
+	return rec, true, nil
+}
+
+func (r *sessionRepository) TTL(ctx context.Context, authID string) (time.Duration, bool, error) {
+	return r.store.TTL(ctx, sessionKey(authID))
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mapae/internal/storage/memory"
+)
+
+func TestDecodeSessionRecordAcrossVersions(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want SessionRecord
+	}{
+		{
+			// 버전 필드 도입 전 기록
+			name: "v1 pending",
+			data: `{"status":"pending","timestamp":"2026-01-02T03:04:05Z"}`,
+			want: SessionRecord{Version: 1, Status: SessionPending, Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			name: "v1 without timestamp",
+			data: `{"status":"pending"}`,
+			want: SessionRecord{Version: 1, Status: SessionPending},
+		},
+		{
+			name: "v2 verified",
+			data: `{"v":2,"status":"verified","timestamp":"2026-01-02T03:04:05Z","phone":"01012345678","carrier":"KT"}`,
+			want: SessionRecord{Version: 2, Status: SessionVerified, Phone: "01012345678", Carrier: "KT", Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			// 이후 버전이 필드를 추가해도 아는 필드는 그대로 읽음
+			name: "newer version with unknown fields",
+			data: fmt.Sprintf(`{"v":%d,"status":"verified","phone":"01012345678","carrier":"SKT","device":{"name":"phone"}}`, SessionSchemaVersion+1),
+			want: SessionRecord{Version: SessionSchemaVersion + 1, Status: SessionVerified, Phone: "01012345678", Carrier: "SKT"},
+		},
+	}
+	for _, tc := range cases {
+		got, err := decodeSessionRecord(tc.data)
+		if err != nil {
+			t.Fatalf("%s: decodeSessionRecord() error = %v", tc.name, err)
+		}
+		if *got != tc.want {
+			t.Fatalf("%s: decodeSessionRecord() = %#v, want %#v", tc.name, *got, tc.want)
+		}
+	}
+}
+
+func TestDecodeSessionRecordRejectsCorruptRecords(t *testing.T) {
+	cases := map[string]string{
+		"not json":          "not-json",
+		"truncated":         `{"v":2,"status":"verif`,
+		"missing status":    `{"v":2,"timestamp":"2026-01-02T03:04:05Z"}`,
+		"unknown status":    `{"v":2,"status":"done"}`,
+		"negative version":  `{"v":-1,"status":"pending"}`,
+		"invalid timestamp": `{"v":2,"status":"pending","timestamp":"yesterday"}`,
+		"wrong type":        `{"v":"2","status":"pending"}`,
+	}
+	for name, data := range cases {
+		if _, err := decodeSessionRecord(data); !errors.Is(err, ErrCorruptRecord) {
+			t.Fatalf("%s: decodeSessionRecord() error = %v, want ErrCorruptRecord", name, err)
+		}
+	}
+	if _, err := decodeSessionRecord(fmt.Sprintf(`{"v":%d,"status":"archived"}`, SessionSchemaVersion+1)); !errors.Is(err, ErrUnsupportedRecord) {
+		t.Fatalf("decodeSessionRecord() future status error = %v, want ErrUnsupportedRecord", err)
+	}
+}
+
+func TestEncodedSessionRecordIsReadableByV1Readers(t *testing.T) {
+	data, err := encodeSessionRecord(SessionRecord{
+		Status:    SessionVerified,
+		Phone:     "01012345678",
+		Carrier:   "KT",
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("KST", 9*60*60)),
+	})
+	if err != nil {
+		t.Fatalf("encodeSessionRecord() error = %v", err)
+	}
+	// v1은 AuthCheckResponse로 바로 읽었으므로 같은 필드 이름이 유지되어야 함
+	var v1 AuthCheckResponse
+	if err := json.Unmarshal([]byte(data), &v1); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if v1.Status != "verified" || v1.Phone != "01012345678" || v1.Carrier != "KT" || v1.Timestamp != "2026-01-01T18:04:05Z" {
+		t.Fatalf("v1 view = %#v", v1)
+	}
+	if !strings.Contains(data, fmt.Sprintf(`"v":%d`, SessionSchemaVersion)) {
+		t.Fatalf("encoded record %s has no schema version", data)
+	}
+
+	if _, err := encodeSessionRecord(SessionRecord{Status: "done"}); err == nil {
+		t.Fatalf("encodeSessionRecord() should reject unknown status")
+	}
+}
+
+func TestSessionRepositoryRoundTripWithSealer(t *testing.T) {
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	s, err := newSealer([]string{"k1:" + testKey('a')}, false)
+	if err != nil {
+		t.Fatalf("newSealer() error = %v", err)
+	}
+	repo := &sessionRepository{store: store, sealer: s}
+	ctx := context.Background()
+	authID := strings.Repeat("a", 32)
+
+	if _, ok, err := repo.Load(ctx, authID); err != nil || ok {
+		t.Fatalf("Load() missing = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	want := SessionRecord{Status: SessionVerified, Phone: "01012345678", Carrier: "LGU+", Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := repo.Save(ctx, authID, want, 60); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	raw, _, _ := store.Get(ctx, "auth:"+authID)
+	if !strings.HasPrefix(raw, sealedPrefix) {
+		t.Fatalf("stored record should be sealed, got %q", raw)
+	}
+	got, ok, err := repo.Load(ctx, authID)
+	if err != nil || !ok {
+		t.Fatalf("Load() = (ok=%t, err=%v)", ok, err)
+	}
+	want.Version = SessionSchemaVersion
+	if *got != want {
+		t.Fatalf("Load() = %#v, want %#v", *got, want)
+	}
+}
+
+func TestSessionRecordKeepsClientData(t *testing.T) {
+	want := SessionRecord{
+		Version: SessionSchemaVersion,
+		Status:  SessionPending,
+		Client:  &ClientData{State: "s-1", ClientReference: "user-42", Metadata: map[string]string{"plan": "pro"}},
+		// v6
+		WebhookURL: "https://api.example/hooks/mapae",
+		// v7
+		Tenant: "shop",
+	}
+	data, err := encodeSessionRecord(want)
+	if err != nil {
+		t.Fatalf("encodeSessionRecord() error = %v", err)
+	}
+	got, err := decodeSessionRecord(data)
+	if err != nil {
+		t.Fatalf("decodeSessionRecord() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("decodeSessionRecord() = %#v, want %#v", *got, want)
+	}
+	// 클라이언트 정보가 없는 v2 기록은 Client가 nil
+	got, err = decodeSessionRecord(`{"v":2,"status":"pending"}`)
+	if err != nil || got.Client != nil {
+		t.Fatalf("decodeSessionRecord(v2) = (%#v, %v), want no client", got, err)
+	}
+}
+
+func TestSessionTransitions(t *testing.T) {
+	allowed := map[[2]SessionStatus]bool{
+		{SessionPending, SessionVerified}:  true,
+		{SessionPending, SessionFailed}:    true,
+		{SessionPending, SessionCancelled}: true,
+		{SessionVerified, SessionConsumed}: true,
+	}
+	all := []SessionStatus{SessionPending, SessionVerified, SessionFailed, SessionCancelled, SessionConsumed}
+	for _, from := range all {
+		for _, to := range all {
+			if got := from.CanTransition(to); got != allowed[[2]SessionStatus{from, to}] {
+				t.Fatalf("%s.CanTransition(%s) = %t", from, to, got)
+			}
+		}
+	}
+}
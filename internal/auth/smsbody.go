@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/language"
+
+	"mapae/internal/config"
+	"mapae/internal/nonce"
+)
+
+// 통신사 문자 길이 한도(바이트). 넘으면 단문(SMS)은 장문(LMS)으로, 장문은 전송 실패
+const (
+	SMSMaxBytes = 90
+	LMSMaxBytes = 2000
+)
+
+// defaultSMSTemplates는 SMS_TEMPLATE_DIR에 같은 언어의 파일이 없을 때 쓰는 템플릿
+var defaultSMSTemplates = map[string]string{
+	"ko": "본인 확인 문자입니다. 수정하지 말고 보내 주세요. {{.Nonce}}",
+	"en": "Send this message as is to verify your phone. {{.Nonce}}",
+}
+
+// smsTemplateData는 SMS 본문 템플릿에 넘기는 값
+type smsTemplateData struct {
+	// Nonce는 파서가 찾는 "[<태그>:<코드>]" 전체. 모든 템플릿에 그대로 들어가야 함
+	Nonce string
+	Code  string
+	// TTLMinutes는 인증 요청 유효 시간(분, 올림)
+	TTLMinutes int
+}
+
+// smsBodies는 언어별 SMS 본문 템플릿. 시작할 때 표본 코드로 렌더링해 길이 한도와 nonce 추출을 확인
+type smsBodies struct {
+	format    *nonce.Format
+	templates []*template.Template
+	// tags[i]는 templates[i]의 언어이며, 첫 번째가 기본 언어
+	tags       []language.Tag
+	matcher    language.Matcher
+	maxBytes   int
+	ttlMinutes int
+}
+
+func newSMSBodies(settings *config.Settings, format *nonce.Format) (*smsBodies, error) {
+	sources := make(map[string]string, len(defaultSMSTemplates))
+	for locale, text := range defaultSMSTemplates {
+		sources[locale] = text
+	}
+	if settings.SMSTemplateDir != "" {
+		paths, err := filepath.Glob(filepath.Join(settings.SMSTemplateDir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			// 편집기가 붙이는 마지막 줄바꿈은 본문에 넣지 않음
+			sources[strings.TrimSuffix(filepath.Base(path), ".tmpl")] = strings.TrimRight(string(data), "\r\n")
+		}
+	}
+
+	b := &smsBodies{format: format, ttlMinutes: (settings.AuthTTLSeconds + 59) / 60}
+	switch strings.ToLower(settings.SMSBodyLimit) {
+	case "lms", "":
+		b.maxBytes = LMSMaxBytes
+	case "sms":
+		b.maxBytes = SMSMaxBytes
+	default:
+		return nil, fmt.Errorf("unknown SMS body limit %q (want sms or lms)", settings.SMSBodyLimit)
+	}
+
+	defaultLocale := settings.SMSDefaultLocale
+	if defaultLocale == "" {
+		defaultLocale = "ko"
+	}
+	if _, ok := sources[defaultLocale]; !ok {
+		return nil, fmt.Errorf("no SMS template for default locale %q", defaultLocale)
+	}
+	locales := []string{defaultLocale}
+	for locale := range sources {
+		if locale != defaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales[1:])
+
+	sample, err := format.Codec.Generate()
+	if err != nil {
+		return nil, err
+	}
+	for _, locale := range locales {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("SMS template locale %q: %w", locale, err)
+		}
+		tmpl, err := template.New(locale).Option("missingkey=error").Parse(sources[locale])
+		if err != nil {
+			return nil, fmt.Errorf("SMS template %q: %w", locale, err)
+		}
+		b.tags = append(b.tags, tag)
+		b.templates = append(b.templates, tmpl)
+		if _, err := b.execute(len(b.templates)-1, sample); err != nil {
+			return nil, fmt.Errorf("SMS template %q: %w", locale, err)
+		}
+	}
+	b.matcher = language.NewMatcher(b.tags)
+	return b, nil
+}
+
+// render는 locale(언어 태그 또는 Accept-Language 값)에 가장 가까운 템플릿으로 본문을 만들고 고른 언어를 반환
+// 맞는 언어가 없으면 기본 언어이며, 매처가 낮은 신뢰도로 고른 언어(예: fr → en)도 맞지 않는 것으로 봄
+func (b *smsBodies) render(locale, code string) (string, string, error) {
+	index := 0
+	if prefs, _, err := language.ParseAcceptLanguage(locale); err == nil && len(prefs) > 0 {
+		if _, matched, confidence := b.matcher.Match(prefs...); confidence >= language.High {
+			index = matched
+		}
+	}
+	body, err := b.execute(index, code)
+	if err != nil {
+		return "", "", err
+	}
+	return body, b.templates[index].Name(), nil
+}
+
+func (b *smsBodies) execute(index int, code string) (string, error) {
+	var buf bytes.Buffer
+	data := smsTemplateData{Nonce: b.format.Body(code), Code: code, TTLMinutes: b.ttlMinutes}
+	if err := b.templates[index].Execute(&buf, data); err != nil {
+		return "", err
+	}
+	body := buf.String()
+	if found := b.format.Find(body); found != code {
+		return "", fmt.Errorf("rendered body does not carry the nonce as %s", b.format.Body("<code>"))
+	}
+	eucKR, utf8Len, err := smsBodyBytes(body)
+	if err != nil {
+		return "", err
+	}
+	if eucKR > b.maxBytes || utf8Len > b.maxBytes {
+		return "", fmt.Errorf("rendered body is %d bytes in EUC-KR and %d bytes in UTF-8, limit is %d", eucKR, utf8Len, b.maxBytes)
+	}
+	return body, nil
+}
+
+// smsBodyBytes는 본문을 EUC-KR(확장 완성형)과 UTF-8로 보낼 때의 바이트 수
+// 휴대폰마다 인코딩이 다르므로 두 길이가 모두 한도 안에 있어야 하며, EUC-KR로 표현할 수 없는 문자(이모지 등)는 오류
+func smsBodyBytes(body string) (int, int, error) {
+	encoded, err := korean.EUCKR.NewEncoder().String(body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("body is not representable in EUC-KR: %w", err)
+	}
+	return len(encoded), len(body), nil
+}
+
+// smsLink는 본문을 채운 sms: 링크. 일부 기기는 '+'를 공백으로 읽지 않으므로 공백은 %20으로 인코딩
+func smsLink(address, body string) string {
+	return fmt.Sprintf("sms:%s?body=%s", address, strings.ReplaceAll(url.QueryEscape(body), "+", "%20"))
+}
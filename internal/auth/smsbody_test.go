@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mapae/internal/config"
+	"mapae/internal/nonce"
+)
+
+func newTestSMSBodies(t *testing.T, settings *config.Settings, format string) (*smsBodies, *nonce.Format) {
+	t.Helper()
+	f, err := nonce.New(format, "", 0)
+	if err != nil {
+		t.Fatalf("nonce.New() error = %v", err)
+	}
+	b, err := newSMSBodies(settings, f)
+	if err != nil {
+		t.Fatalf("newSMSBodies() error = %v", err)
+	}
+	return b, f
+}
+
+func TestSMSBodyLocaleSelection(t *testing.T) {
+	b, f := newTestSMSBodies(t, &config.Settings{AuthTTLSeconds: 600}, nonce.Hex64)
+	code, _ := f.Codec.Generate()
+	cases := map[string]string{
+		"":                        "ko",
+		"en":                      "en",
+		"en-US,en;q=0.9,ko;q=0.8": "en",
+		"ko-KR,ko;q=0.9,en;q=0.8": "ko",
+		"fr-FR":                   "ko",
+		"not a locale;;":          "ko",
+	}
+	for pref, want := range cases {
+		body, locale, err := b.render(pref, code)
+		if err != nil {
+			t.Fatalf("render(%q) error = %v", pref, err)
+		}
+		if locale != want || !strings.Contains(body, f.Body(code)) {
+			t.Fatalf("render(%q) = (%q, %s), want %s body with the nonce", pref, body, locale, want)
+		}
+	}
+}
+
+func TestDefaultSMSTemplatesFitSingleSMSWithShortCodes(t *testing.T) {
+	b, f := newTestSMSBodies(t, &config.Settings{SMSBodyLimit: "sms"}, nonce.Base32)
+	code, _ := f.Codec.Generate()
+	for _, locale := range []string{"ko", "en"} {
+		body, _, err := b.render(locale, code)
+		if err != nil {
+			t.Fatalf("render(%s) error = %v", locale, err)
+		}
+		eucKR, utf8Len, err := smsBodyBytes(body)
+		if err != nil || eucKR > SMSMaxBytes || utf8Len > SMSMaxBytes {
+			t.Fatalf("%s body %q is (%d, %d) bytes, err = %v", locale, body, eucKR, utf8Len, err)
+		}
+	}
+
+	// 64자리 16진수 코드로는 한국어 본문이 단문 한도를 넘음
+	f, _ = nonce.New(nonce.Hex64, "", 0)
+	if _, err := newSMSBodies(&config.Settings{SMSBodyLimit: "sms"}, f); err == nil {
+		t.Fatalf("newSMSBodies() should reject templates longer than a single SMS")
+	}
+}
+
+func TestSMSBodyBytes(t *testing.T) {
+	eucKR, utf8Len, err := smsBodyBytes("인증 [MAPAE:1]")
+	if err != nil || eucKR != 14 || utf8Len != 16 {
+		t.Fatalf("smsBodyBytes() = (%d, %d, %v), want (14, 16, nil)", eucKR, utf8Len, err)
+	}
+	if _, _, err := smsBodyBytes("인증 😀"); err == nil {
+		t.Fatalf("smsBodyBytes() should reject characters outside EUC-KR")
+	}
+}
+
+func TestSMSTemplateDirOverridesAndValidates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	write("ko.tmpl", "{{.TTLMinutes}}분 안에 보내 주세요 {{.Nonce}}\n")
+	write("ja.tmpl", "{{.Nonce}} を送信してください")
+	b, f := newTestSMSBodies(t, &config.Settings{SMSTemplateDir: dir, AuthTTLSeconds: 90}, nonce.Hex64)
+	code, _ := f.Codec.Generate()
+	if body, _, err := b.render("ko", code); err != nil || body != "2분 안에 보내 주세요 "+f.Body(code) {
+		t.Fatalf("render(ko) = (%q, %v)", body, err)
+	}
+	if body, locale, err := b.render("ja-JP", code); err != nil || locale != "ja" || !strings.HasPrefix(body, f.Body(code)) {
+		t.Fatalf("render(ja-JP) = (%q, %s, %v)", body, locale, err)
+	}
+
+	invalid := map[string]string{
+		"no nonce":      "코드는 {{.Code}} 입니다",
+		"broken nonce":  "[MAPAE: {{.Code}}]",
+		"unknown field": "{{.Phone}} {{.Nonce}}",
+		"emoji":         "😀 {{.Nonce}}",
+		"too long":      strings.Repeat("가", LMSMaxBytes/2) + "{{.Nonce}}",
+		"syntax":        "{{.Nonce",
+	}
+	for name, text := range invalid {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "en.tmpl"), []byte(text), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		f, _ := nonce.New(nonce.Hex64, "", 0)
+		if _, err := newSMSBodies(&config.Settings{SMSTemplateDir: dir}, f); err == nil {
+			t.Fatalf("%s: newSMSBodies() should fail", name)
+		}
+	}
+	f, _ = nonce.New(nonce.Hex64, "", 0)
+	if _, err := newSMSBodies(&config.Settings{SMSDefaultLocale: "de"}, f); err == nil {
+		t.Fatalf("newSMSBodies() should fail without a template for the default locale")
+	}
+}
+
+func TestSMSLinkEscapesBody(t *testing.T) {
+	body := "본인 확인 문자입니다. [MAPAE:abc+def]"
+	link := smsLink("verify@example.com", body)
+	if strings.ContainsAny(link, " +") || !strings.HasPrefix(link, "sms:verify@example.com?body=") {
+		t.Fatalf("smsLink() = %q", link)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if got := parsed.Query().Get("body"); got != body {
+		t.Fatalf("link body = %q, want %q", got, body)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mapae/internal/config"
+	"mapae/internal/tenant"
+)
+
+// ErrUnknownTenant는 등록하지 않은 클라이언트의 서비스를 찾을 때 반환
+var ErrUnknownTenant = errors.New("unknown_tenant")
+
+// tenantConfig는 클라이언트 설정을 덮어쓴 서비스 구성
+type tenantConfig struct {
+	id       string
+	settings *config.Settings
+	signer   *jwtSigner
+	bodies   *smsBodies
+	// webhookURL은 세션별 주소가 없을 때 쓰는 클라이언트의 웹훅 주소이며, 비어 있으면 기본 주소
+	webhookURL string
+}
+
+// UseTenants는 등록된 클라이언트마다 JWT 서명기와 SMS 템플릿을 만들어 ForTenant로 쓸 수 있게 함
+func (s *Service) UseTenants(registry *tenant.Registry) error {
+	tenants := make(map[string]*tenantConfig, len(registry.Clients()))
+	for _, client := range registry.Clients() {
+		if client.WebhookURL != "" && (s.webhooks == nil || s.webhooks.Target(client.ID, client.WebhookURL) == "") {
+			return fmt.Errorf("client %s: webhook_url requires webhook_secrets", client.ID)
+		}
+		settings := client.Settings(s.settings)
+		signer, err := newJWTSigner(settings)
+		if err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		bodies, err := newSMSBodies(settings, s.nonces)
+		if err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		tenants[client.ID] = &tenantConfig{id: client.ID, settings: settings, signer: signer, bodies: bodies, webhookURL: client.WebhookURL}
+	}
+	s.tenants = tenants
+	return nil
+}
+
+// ForTenant는 클라이언트 id의 설정으로 세션을 만들고, 그 클라이언트의 세션만 조회하는(나머지는 unknown) 서비스
+func (s *Service) ForTenant(id string) (*Service, error) {
+	cfg, ok := s.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, id)
+	}
+	scoped := *s
+	scoped.settings = cfg.settings
+	scoped.signer = cfg.signer
+	scoped.bodies = cfg.bodies
+	scoped.tenant = cfg
+	return &scoped, nil
+}
+
+// tenantID는 서비스의 클라이언트 ID이며, ForTenant로 만든 서비스가 아니면 빈 문자열
+func (s *Service) tenantID() string {
+	if s.tenant == nil {
+		return ""
+	}
+	return s.tenant.id
+}
+
+// visible은 rec를 이 서비스가 조회할 수 있는지 여부. 클라이언트를 정하지 않은 서비스(SMTP 등)는 모든 세션을 봄
+func (s *Service) visible(rec *SessionRecord) bool {
+	return s.tenant == nil || rec.Tenant == s.tenant.id
+}
+
+// owns는 auth_id 세션을 이 서비스가 조회할 수 있는지 여부. 기록이 사라졌으면 묘비의 클라이언트로 판단
+func (s *Service) owns(ctx context.Context, authID string) (bool, error) {
+	if s.tenant == nil {
+		return true, nil
+	}
+	rec, ok, err := s.sessions.Load(ctx, authID)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return s.visible(rec), nil
+	}
+	tombstone, ok, err := s.store.Get(ctx, tombstoneKey(authID))
+	if err != nil {
+		return false, err
+	}
+	return ok && tombstone == s.tenant.id, nil
+}
+
+// settingsFor는 rec를 만든 클라이언트의 설정이며, 클라이언트가 없거나 더는 등록되어 있지 않으면 전역 설정
+func (s *Service) settingsFor(rec *SessionRecord) *config.Settings {
+	if rec != nil {
+		if cfg, ok := s.tenants[rec.Tenant]; ok {
+			return cfg.settings
+		}
+	}
+	return s.settings
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"mapae/internal/tenant"
+)
+
+func newTenantRegistry(t *testing.T, clients ...tenant.Client) *tenant.Registry {
+	t.Helper()
+	for i := range clients {
+		clients[i].APIKeyHashes = []string{tenant.HashAPIKey(clients[i].ID + "-key")}
+	}
+	registry, err := tenant.New(clients)
+	if err != nil {
+		t.Fatalf("tenant.New() error = %v", err)
+	}
+	return registry
+}
+
+func TestTenantSettingsAndIsolation(t *testing.T) {
+	svc, store, pub := newService(t, true)
+	svc.settings.SessionTombstoneTTLSeconds = 3600
+	templates := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templates, "ko.tmpl"), []byte("샵 본인 확인 {{.Nonce}}\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	registry := newTenantRegistry(t,
+		tenant.Client{ID: "shop", JWTIssuer: "https://shop.example", JWTAudience: "shop-app", AuthTTLSeconds: 120, VerifiedTTLSeconds: 45, SMSTemplateDir: templates},
+		tenant.Client{ID: "bank"},
+	)
+	if err := svc.UseTenants(registry); err != nil {
+		t.Fatalf("UseTenants() error = %v", err)
+	}
+	shop, err := svc.ForTenant("shop")
+	if err != nil {
+		t.Fatalf("ForTenant(shop) error = %v", err)
+	}
+	bank, err := svc.ForTenant("bank")
+	if err != nil {
+		t.Fatalf("ForTenant(bank) error = %v", err)
+	}
+	if _, err := svc.ForTenant("other"); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("ForTenant(other) error = %v, want ErrUnknownTenant", err)
+	}
+
+	ctx := context.Background()
+	initResp, err := shop.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	if initResp.TTLSeconds != 120 || !strings.HasPrefix(initResp.SMSBody, "샵 본인 확인 ") {
+		t.Fatalf("InitAuth() = %#v, want the shop TTL and template", initResp)
+	}
+	authID := initResp.AuthID
+	if resp, err := bank.CheckAuth(ctx, authID); err != nil || resp.Status != StatusUnknown {
+		t.Fatalf("bank CheckAuth() = (%#v, %v), want unknown", resp, err)
+	}
+	if resp, err := bank.CancelAuth(ctx, authID); !errors.Is(err, ErrNotCancellable) || resp.Status != StatusUnknown {
+		t.Fatalf("bank CancelAuth() = (%#v, %v), want unknown", resp, err)
+	}
+
+	// SMTP는 클라이언트를 정하지 않은 서비스로 인증하지만 TTL은 세션을 만든 클라이언트를 따름
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	phone, carrier := "01012345678", "KT"
+	if finished, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok || finished != (NonceResult{AuthID: authID, Tenant: "shop"}) {
+		t.Fatalf("VerifyByNonce() = (%+v, %t, %v), want the shop session", finished, ok, err)
+	}
+	if ttl, ok, err := store.TTL(ctx, sessionKey(authID)); err != nil || !ok || ttl <= 30*time.Second || ttl > 45*time.Second {
+		t.Fatalf("verified record TTL = (%s, %t, %v), want the shop verified TTL", ttl, ok, err)
+	}
+	if resp, err := bank.CheckSigned(ctx, authID); err != nil || resp.Status != StatusUnknown || resp.Token != "" {
+		t.Fatalf("bank CheckSigned() = (%#v, %v), want unknown", resp, err)
+	}
+	signed, err := shop.CheckSigned(ctx, authID)
+	if err != nil || signed.Status != StatusVerified {
+		t.Fatalf("shop CheckSigned() = (%#v, %v)", signed, err)
+	}
+	parsed, err := jwt.Parse(signed.Token, func(*jwt.Token) (interface{}, error) { return pub, nil })
+	if err != nil {
+		t.Fatalf("jwt.Parse() error = %v", err)
+	}
+	claims := parsed.Claims.(jwt.MapClaims)
+	if claims["iss"] != "https://shop.example" || claims["aud"] != "shop-app" {
+		t.Fatalf("unexpected claims: %#v", claims)
+	}
+
+	// 기록이 사라진 뒤에는 묘비로 구분
+	if _, _, err := store.Take(ctx, sessionKey(authID)); err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if resp, err := shop.CheckAuth(ctx, authID); err != nil || resp.Status != StatusExpired {
+		t.Fatalf("shop CheckAuth() after expiry = (%#v, %v), want expired", resp, err)
+	}
+	if resp, err := bank.CheckAuth(ctx, authID); err != nil || resp.Status != StatusUnknown {
+		t.Fatalf("bank CheckAuth() after expiry = (%#v, %v), want unknown", resp, err)
+	}
+}
+
+func TestUseTenantsValidatesClients(t *testing.T) {
+	svc, _, _ := newService(t, false)
+	if err := svc.UseTenants(newTenantRegistry(t, tenant.Client{ID: "shop", WebhookURL: "https://shop.example/hook"})); err == nil {
+		t.Fatal("UseTenants() with a webhook URL but no webhooks error = nil")
+	}
+	if err := svc.UseTenants(newTenantRegistry(t, tenant.Client{ID: "shop", SMSDefaultLocale: "fr"})); err == nil {
+		t.Fatal("UseTenants() with a locale that has no template error = nil")
+	}
+}
+
+func TestTenantWebhookURL(t *testing.T) {
+	svc, events, serverURL := newWebhookService(t, "/default")
+	if err := svc.UseTenants(newTenantRegistry(t, tenant.Client{ID: "shop", WebhookURL: serverURL + "/shop"}, tenant.Client{ID: "bank"}, tenant.Client{ID: "other"})); err != nil {
+		t.Fatalf("UseTenants() error = %v", err)
+	}
+	shop, err := svc.ForTenant("shop")
+	if err != nil {
+		t.Fatalf("ForTenant() error = %v", err)
+	}
+	bank, err := svc.ForTenant("bank")
+	if err != nil {
+		t.Fatalf("ForTenant() error = %v", err)
+	}
+	other, err := svc.ForTenant("other")
+	if err != nil {
+		t.Fatalf("ForTenant() error = %v", err)
+	}
+	// 서명 키가 없는 클라이언트는 세션별 주소도 받지 않음
+	if _, err := other.InitAuthWithOptions(context.Background(), InitOptions{WebhookURL: serverURL + "/session/hook"}); !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Fatalf("InitAuthWithOptions() without client secrets error = %v, want ErrInvalidWebhookURL", err)
+	}
+	// 클라이언트의 세션은 주소가 없으면 기본 주소(WEBHOOK_URL)로 보내지 않음
+	_, bankNonce := initNonce(t, bank, InitOptions{})
+	if _, ok, err := svc.FailByNonce(context.Background(), bankNonce, FailureSPF); err != nil || !ok {
+		t.Fatalf("FailByNonce(bank) = (ok=%t, err=%v)", ok, err)
+	}
+	expectNoEvent(t, events, 100*time.Millisecond)
+
+	// 수신 서버는 /shop 이벤트를 shop의 키로만 확인
+	authID, nonce := initNonce(t, shop, InitOptions{})
+	if _, ok, err := svc.FailByNonce(context.Background(), nonce, FailureSPF); err != nil || !ok {
+		t.Fatalf("FailByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	if got := waitEvent(t, events); got.path != "/shop" || got.data["auth_id"] != authID {
+		t.Fatalf("received %s %+v", got.path, got.event)
+	}
+	// 전송 기록은 수신 서버가 응답한 뒤에 남음
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		log, err := shop.WebhookLog(context.Background(), authID)
+		if err != nil {
+			t.Fatalf("WebhookLog() error = %v", err)
+		}
+		if len(log) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("WebhookLog() = %+v, want one attempt", log)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 클라이언트를 정하지 않은 서비스가 세션을 바꿔도 세션을 만든 클라이언트의 TTL을 따름
+func TestTenantVerifiedTTLOnCancelAndConsume(t *testing.T) {
+	svc, store, _ := newService(t, true)
+	svc.settings.SignedResultSingleUse = true
+	if err := svc.UseTenants(newTenantRegistry(t, tenant.Client{ID: "shop", VerifiedTTLSeconds: 45})); err != nil {
+		t.Fatalf("UseTenants() error = %v", err)
+	}
+	shop, err := svc.ForTenant("shop")
+	if err != nil {
+		t.Fatalf("ForTenant() error = %v", err)
+	}
+	ctx := context.Background()
+	assertShopTTL := func(name, authID string) {
+		t.Helper()
+		if ttl, ok, err := store.TTL(ctx, sessionKey(authID)); err != nil || !ok || ttl <= 30*time.Second || ttl > 45*time.Second {
+			t.Fatalf("%s record TTL = (%s, %t, %v), want the shop verified TTL", name, ttl, ok, err)
+		}
+	}
+
+	cancelled, _ := initNonce(t, shop, InitOptions{})
+	if resp, err := svc.CancelAuth(ctx, cancelled); err != nil || resp.Status != StatusCancelled {
+		t.Fatalf("CancelAuth() = (%#v, %v)", resp, err)
+	}
+	assertShopTTL("cancelled", cancelled)
+
+	consumed, nonce := initNonce(t, shop, InitOptions{})
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	if resp, err := svc.CheckSigned(ctx, consumed); err != nil || resp.Token == "" {
+		t.Fatalf("CheckSigned() = (%#v, %v), want a token", resp, err)
+	}
+	assertShopTTL("consumed", consumed)
+}
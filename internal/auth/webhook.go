@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mapae/internal/webhook"
+)
+
+// ErrInvalidWebhookURL은 /auth/init에 넘긴 webhook_url을 받을 수 없을 때 반환(웹훅 미설정, 허용하지 않은 주소)
+var ErrInvalidWebhookURL = errors.New("invalid_webhook_url")
+
+// defaultExpiredWebhookDelay는 만료 이벤트를 세션 TTL보다 늦게 보내는 시간. 만료 직전에 온 문자의 결과가 먼저 기록되도록 둠
+const defaultExpiredWebhookDelay = 5 * time.Second
+
+// webhookData는 이벤트 본문의 data. 상태 조회 응답과 같은 필드에 auth_id를 더함(토큰은 넣지 않음)
+type webhookData struct {
+	AuthID string `json:"auth_id"`
+	*AuthCheckResponse
+}
+
+// UseWebhooks는 세션이 verified, failed, expired가 되면 d로 알리게 함
+func (s *Service) UseWebhooks(d *webhook.Dispatcher) {
+	s.webhooks = d
+}
+
+// WebhookCodec은 웹훅 전송 기록을 세션 기록과 같은 키로 암호화하는 Codec이며, 암호화 키가 없으면 nil
+func (s *Service) WebhookCodec() webhook.Codec {
+	if s.sealer == nil {
+		return nil
+	}
+	return webhookCodec{sealer: s.sealer}
+}
+
+type webhookCodec struct {
+	sealer *sealer
+}
+
+func (c webhookCodec) Seal(key, value string) (string, error) {
+	return c.sealer.seal("webhook", key, value)
+}
+func (c webhookCodec) Open(key, value string) (string, error) {
+	return c.sealer.open("webhook", key, value)
+}
+
+// WebhookLog는 auth_id의 웹훅 전송 기록을 반환하며, 웹훅을 쓰지 않거나 다른 클라이언트의 세션이면 빈 목록
+func (s *Service) WebhookLog(ctx context.Context, authID string) ([]webhook.Attempt, error) {
+	if !authIDRe.MatchString(authID) {
+		return nil, ErrInvalidAuthID
+	}
+	if s.webhooks == nil {
+		return nil, nil
+	}
+	if owned, err := s.owns(ctx, authID); err != nil || !owned {
+		return nil, err
+	}
+	return s.webhooks.Log(ctx, authID)
+}
+
+// validateWebhookURL은 세션별 webhook_url을 확인
+func (s *Service) validateWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if s.webhooks == nil || s.webhooks.Target(s.tenantID(), raw) == "" {
+		return fmt.Errorf("%w: webhooks are not configured", ErrInvalidWebhookURL)
+	}
+	if err := s.webhooks.ValidateURL(raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookURL, err)
+	}
+	return nil
+}
+
+// webhookEnabled는 rec의 결과를 알릴 주소와 서명 키가 있는지 여부. 클라이언트의 세션은 기본 주소로 보내지 않음
+func (s *Service) webhookEnabled(rec *SessionRecord) bool {
+	return s.webhooks != nil && s.webhooks.Target(rec.Tenant, rec.WebhookURL) != ""
+}
+
+func expiredWebhookID(authID string) string {
+	return authID + "-expired"
+}
+
+// scheduleExpiredWebhook은 대기 세션의 만료 이벤트를 미리 outbox에 넣어 둠
+// 인스턴스가 TTL 동안 살아 있지 않아도 만료를 알릴 수 있으며, 세션이 끝나면 cancelExpiredWebhook으로 지움
+// 웹훅은 인증 결과에 영향을 주지 않으므로 오류는 무시(Dispatcher가 기록)
+func (s *Service) scheduleExpiredWebhook(ctx context.Context, authID string, rec *SessionRecord) {
+	if !s.webhookEnabled(rec) {
+		return
+	}
+	resp := &AuthCheckResponse{Status: StatusExpired}
+	resp.setClient(rec.Client)
+	delivery := webhook.Delivery{
+		ID:      expiredWebhookID(authID),
+		URL:     rec.WebhookURL,
+		Client:  rec.Tenant,
+		Subject: authID,
+		Type:    webhook.EventExpired,
+		Data:    webhookData{AuthID: authID, AuthCheckResponse: resp},
+	}
+	at := rec.Timestamp.Add(time.Duration(s.settings.AuthTTLSeconds)*time.Second + s.expiredWebhookDelay)
+	_ = s.webhooks.Enqueue(ctx, delivery, at)
+}
+
+func (s *Service) cancelExpiredWebhook(ctx context.Context, authID string, rec *SessionRecord) {
+	if !s.webhookEnabled(rec) {
+		return
+	}
+	_ = s.webhooks.Cancel(ctx, expiredWebhookID(authID))
+}
+
+// emitWebhook은 종료된 세션의 결과(verified, failed)를 알리고 예약해 둔 만료 이벤트를 지움
+func (s *Service) emitWebhook(ctx context.Context, authID string, rec *SessionRecord) {
+	if !s.webhookEnabled(rec) {
+		return
+	}
+	eventType := webhook.EventVerified
+	if rec.Status == SessionFailed {
+		eventType = webhook.EventFailed
+	}
+	s.cancelExpiredWebhook(ctx, authID, rec)
+	delivery := webhook.Delivery{
+		ID:      authID + "-" + string(rec.Status),
+		URL:     rec.WebhookURL,
+		Client:  rec.Tenant,
+		Subject: authID,
+		Type:    eventType,
+		Data:    webhookData{AuthID: authID, AuthCheckResponse: recordResponse(rec)},
+	}
+	_ = s.webhooks.Enqueue(ctx, delivery, time.Now())
+}
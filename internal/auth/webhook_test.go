@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"mapae/internal/logging"
+	"mapae/internal/webhook"
+)
+
+type receivedEvent struct {
+	path  string
+	event webhook.Event
+	data  map[string]any
+}
+
+// webhookClientSecrets는 클라이언트별 서명 키. 수신 서버는 "/<클라이언트 ID>"로 시작하는 경로의 이벤트를 그 키로만 확인
+var webhookClientSecrets = map[string][]string{"shop": {"shop-secret"}, "bank": {"bank-secret"}}
+
+// newWebhookService는 httptest 수신 서버로 웹훅을 보내는 서비스를 만들고, 받은 이벤트 채널과 수신 서버 주소를 반환
+func newWebhookService(t *testing.T, defaultPath string) (*Service, <-chan receivedEvent, string) {
+	t.Helper()
+	svc, store, _ := newService(t, false)
+	events := make(chan receivedEvent, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		secrets := []string{"hook-secret"}
+		for client, clientSecrets := range webhookClientSecrets {
+			if strings.HasPrefix(r.URL.Path, "/"+client) {
+				secrets = clientSecrets
+			}
+		}
+		if _, err := webhook.Verify(secrets, r.Header, body, time.Now(), 0); err != nil {
+			t.Errorf("Verify() error = %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var got receivedEvent
+		got.path = r.URL.Path
+		if err := json.Unmarshal(body, &got.event); err != nil {
+			t.Errorf("Unmarshal() error = %v", err)
+		}
+		got.data, _ = got.event.Data.(map[string]any)
+		events <- got
+	}))
+	t.Cleanup(server.Close)
+
+	opts := webhook.Options{
+		AllowedURLPrefixes: []string{server.URL + "/session/"},
+		Secrets:            []string{"hook-secret"},
+		ClientSecrets:      webhookClientSecrets,
+		PollInterval:       10 * time.Millisecond,
+		Codec:              svc.WebhookCodec(),
+	}
+	if defaultPath != "" {
+		opts.URL = server.URL + defaultPath
+	}
+	dispatcher, err := webhook.New(store, opts, logging.New("test: ", false))
+	if err != nil {
+		t.Fatalf("webhook.New() error = %v", err)
+	}
+	svc.UseWebhooks(dispatcher)
+	svc.expiredWebhookDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return svc, events, server.URL
+}
+
+func waitEvent(t *testing.T, events <-chan receivedEvent) receivedEvent {
+	t.Helper()
+	select {
+	case got := <-events:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook event received")
+		return receivedEvent{}
+	}
+}
+
+func expectNoEvent(t *testing.T, events <-chan receivedEvent, wait time.Duration) {
+	t.Helper()
+	select {
+	case got := <-events:
+		t.Fatalf("unexpected webhook event %+v", got.event)
+	case <-time.After(wait):
+	}
+}
+
+func initNonce(t *testing.T, svc *Service, opts InitOptions) (string, string) {
+	t.Helper()
+	resp, err := svc.InitAuthWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	return resp.AuthID, regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(resp.SMSBody)[1]
+}
+
+func TestWebhookOnVerified(t *testing.T) {
+	svc, events, _ := newWebhookService(t, "/default")
+	ctx := context.Background()
+	authID, nonce := initNonce(t, svc, InitOptions{Client: &ClientData{State: "s-1"}})
+
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := svc.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	got := waitEvent(t, events)
+	if got.path != "/default" || got.event.Type != webhook.EventVerified || got.event.ID != authID+"-verified" {
+		t.Fatalf("received %s %+v", got.path, got.event)
+	}
+	if got.data["auth_id"] != authID || got.data["status"] != StatusVerified || got.data["phone"] != phone || got.data["state"] != "s-1" {
+		t.Fatalf("event data = %v", got.data)
+	}
+
+	// 인증되었으므로 만료 이벤트는 보내지 않음
+	expectNoEvent(t, events, 1500*time.Millisecond)
+
+	log, err := svc.WebhookLog(ctx, authID)
+	if err != nil {
+		t.Fatalf("WebhookLog() error = %v", err)
+	}
+	if len(log) != 1 || log[0].Outcome != webhook.OutcomeDelivered || log[0].Type != webhook.EventVerified {
+		t.Fatalf("WebhookLog() = %+v", log)
+	}
+}
+
+func TestWebhookOnFailedToSessionURL(t *testing.T) {
+	svc, events, serverURL := newWebhookService(t, "")
+	authID, nonce := initNonce(t, svc, InitOptions{WebhookURL: serverURL + "/session/hook"})
+
+	if _, ok, err := svc.FailByNonce(context.Background(), nonce, FailureSPF); err != nil || !ok {
+		t.Fatalf("FailByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	got := waitEvent(t, events)
+	if got.path != "/session/hook" || got.event.Type != webhook.EventFailed || got.data["auth_id"] != authID || got.data["reason"] != string(FailureSPF) {
+		t.Fatalf("received %s %+v", got.path, got.event)
+	}
+}
+
+func TestWebhookOnExpired(t *testing.T) {
+	svc, events, _ := newWebhookService(t, "/default")
+	svc.settings.AuthTTLSeconds = 1
+	authID, _ := initNonce(t, svc, InitOptions{Client: &ClientData{ClientReference: "order-7"}})
+
+	got := waitEvent(t, events)
+	if got.event.Type != webhook.EventExpired || got.data["auth_id"] != authID || got.data["status"] != StatusExpired || got.data["client_reference"] != "order-7" {
+		t.Fatalf("received %+v", got.event)
+	}
+}
+
+func TestWebhookNotSentAfterCancel(t *testing.T) {
+	svc, events, _ := newWebhookService(t, "/default")
+	svc.settings.AuthTTLSeconds = 1
+	authID, _ := initNonce(t, svc, InitOptions{})
+	if _, err := svc.CancelAuth(context.Background(), authID); err != nil {
+		t.Fatalf("CancelAuth() error = %v", err)
+	}
+	expectNoEvent(t, events, 1500*time.Millisecond)
+}
+
+func TestInitRejectsWebhookURL(t *testing.T) {
+	svc, _, _ := newService(t, false)
+	if _, err := svc.InitAuthWithOptions(context.Background(), InitOptions{WebhookURL: "https://api.example/hook"}); !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Fatalf("InitAuthWithOptions() without webhooks error = %v, want ErrInvalidWebhookURL", err)
+	}
+
+	svc, _, serverURL := newWebhookService(t, "")
+	for _, raw := range []string{serverURL + "/other", "http://169.254.169.254/latest"} {
+		if _, err := svc.InitAuthWithOptions(context.Background(), InitOptions{WebhookURL: raw}); !errors.Is(err, ErrInvalidWebhookURL) {
+			t.Fatalf("InitAuthWithOptions(%q) error = %v, want ErrInvalidWebhookURL", raw, err)
+		}
+	}
+}
@@ -12,8 +12,25 @@ type Settings struct {
 	Debug bool
 
 	// 저장소
-	UseInMemoryStore bool
-	RedisURL         string
+	UseInMemoryStore              bool
+	MemorySnapshotPath            string
+	MemorySnapshotIntervalSeconds int
+	MemoryAOFSyncAlways           bool
+	MemoryMaxEntries              int
+	RedisURL                      string
+	RedisSentinelMaster           string
+	RedisSentinelAddrs            []string
+	RedisSentinelPassword         string
+	RedisClusterAddrs             []string
+	DatabaseURL                   string
+	StoreNamespace                string
+	StoreRetryAttempts            int
+	StoreRetryBaseDelayMs         int
+	StoreBreakerFailures          int
+	StoreBreakerOpenSeconds       int
+	StoreEncryptionKeys           []string
+	StoreEncryptNonces            bool
+	StoreEncryptionAllowLegacy    bool
 
 	// SMTP 서버
 	SMTPHost          string
@@ -25,26 +42,81 @@ type Settings struct {
 	HTTPHost         string
 	HTTPPort         int
 	CORSAllowOrigins []string
+	// TrustedProxies는 X-Forwarded-For를 믿을 프록시의 CIDR 목록이며, 비어 있으면 접속한 주소를 클라이언트 IP로 씀
+	TrustedProxies []string
+	// MetricsAddr는 GET /metrics만 제공하는 별도 리스너 주소이며, 비어 있으면 지표를 제공하지 않음
+	MetricsAddr string
 
 	// 인증
 	AuthTTLSeconds     int
 	VerifiedTTLSeconds int
-	DataSizeLimitBytes int
+	// SessionTombstoneTTLSeconds는 발급한 auth_id를 기억하는 시간(기본 2 × (AuthTTLSeconds + VerifiedTTLSeconds))
+	// 기록이 사라진 뒤 expired와 unknown을 구분하며, 0이면 구분하지 않음
+	SessionTombstoneTTLSeconds int
+	DataSizeLimitBytes         int
+	NonceFormat                string
+	NonceTag                   string
+	NonceLength                int
+	SMSTemplateDir             string
+	SMSDefaultLocale           string
+	SMSBodyLimit               string
 
 	// JWT
 	JWTPrivateKeyPEM string
 	JWTIssuer        string
-	JWTTTLSeconds    int
+	// JWTAudience는 토큰의 aud 클레임이며, 비어 있으면 넣지 않음
+	JWTAudience   string
+	JWTTTLSeconds int
+	// SignedResultSingleUse면 /auth/check-signed가 처음 토큰을 발급할 때 결과를 소비하고, 이후에는 consumed로 응답
+	SignedResultSingleUse bool
+
+	// 요청 제한
+	RateLimitAlgorithm          string
+	HTTPInitRateLimit           int
+	HTTPInitRateWindowSeconds   int
+	SMTPSenderRateLimit         int
+	SMTPSenderRateWindowSeconds int
+
+	// 웹훅. WebhookSecrets가 비어 있으면 클라이언트가 없는 세션은 보내지 않음
+	WebhookURL string
+	// WebhookAllowedURLPrefixes는 /auth/init에서 세션별 webhook_url로 받을 수 있는 주소의 접두사
+	WebhookAllowedURLPrefixes []string
+	WebhookSecrets            []string
+	WebhookTimeoutSeconds     int
+	WebhookMaxAttempts        int
+	WebhookRetryBaseSeconds   int
+	WebhookRetryMaxSeconds    int
+	WebhookLogTTLSeconds      int
+
+	// 클라이언트. ClientsFile이 있으면 등록된 클라이언트의 API 키가 있어야 인증을 시작하고 조회할 수 있음
+	ClientsFile string
 }
 
 func Load() *Settings {
-	return &Settings{
+	settings := &Settings{
 		// 일반
 		Debug: envBool("DEBUG", false),
 
 		// 저장소
-		UseInMemoryStore: envBool("USE_IN_MEMORY_STORE", false),
-		RedisURL:         envString("REDIS_URL", ""),
+		UseInMemoryStore:              envBool("USE_IN_MEMORY_STORE", false),
+		MemorySnapshotPath:            envString("MEMORY_SNAPSHOT_PATH", ""),
+		MemorySnapshotIntervalSeconds: envInt("MEMORY_SNAPSHOT_INTERVAL_SECONDS", 60),
+		MemoryAOFSyncAlways:           envBool("MEMORY_AOF_FSYNC_ALWAYS", false),
+		MemoryMaxEntries:              envInt("MEMORY_MAX_ENTRIES", 0),
+		RedisURL:                      envString("REDIS_URL", ""),
+		RedisSentinelMaster:           envString("REDIS_SENTINEL_MASTER", ""),
+		RedisSentinelAddrs:            envList("REDIS_SENTINEL_ADDRS", nil),
+		RedisSentinelPassword:         envString("REDIS_SENTINEL_PASSWORD", ""),
+		RedisClusterAddrs:             envList("REDIS_CLUSTER_ADDRS", nil),
+		DatabaseURL:                   envString("DATABASE_URL", ""),
+		StoreNamespace:                envString("STORE_NAMESPACE", ""),
+		StoreRetryAttempts:            envInt("STORE_RETRY_ATTEMPTS", 3),
+		StoreRetryBaseDelayMs:         envInt("STORE_RETRY_BASE_DELAY_MS", 50),
+		StoreBreakerFailures:          envInt("STORE_BREAKER_FAILURES", 5),
+		StoreBreakerOpenSeconds:       envInt("STORE_BREAKER_OPEN_SECONDS", 10),
+		StoreEncryptionKeys:           envList("STORE_ENCRYPTION_KEYS", nil),
+		StoreEncryptNonces:            envBool("STORE_ENCRYPT_NONCES", false),
+		StoreEncryptionAllowLegacy:    envBool("STORE_ENCRYPTION_ALLOW_LEGACY", false),
 
 		// SMTP 서버
 		SMTPHost:          envString("SMTP_HOST", "0.0.0.0"),
@@ -56,17 +128,50 @@ func Load() *Settings {
 		HTTPHost:         envString("HTTP_HOST", "0.0.0.0"),
 		HTTPPort:         envInt("HTTP_PORT", 8000),
 		CORSAllowOrigins: envList("CORS_ALLOW_ORIGINS", []string{"*"}),
+		TrustedProxies:   envList("TRUSTED_PROXIES", nil),
+		MetricsAddr:      envString("METRICS_ADDR", ""),
 
 		// 인증
 		AuthTTLSeconds:     envInt("AUTH_TTL_SECONDS", 600),
 		VerifiedTTLSeconds: envInt("VERIFIED_TTL_SECONDS", 300),
 		DataSizeLimitBytes: 128 * 1024,
+		NonceFormat:        envString("NONCE_FORMAT", "hex64"),
+		NonceTag:           envString("NONCE_TAG", "MAPAE"),
+		NonceLength:        envInt("NONCE_LENGTH", 8),
+		SMSTemplateDir:     envString("SMS_TEMPLATE_DIR", ""),
+		SMSDefaultLocale:   envString("SMS_DEFAULT_LOCALE", "ko"),
+		SMSBodyLimit:       envString("SMS_BODY_LIMIT", "lms"),
 
 		// JWT
-		JWTPrivateKeyPEM: envString("JWT_PRIVATE_KEY", ""),
-		JWTIssuer:        envString("JWT_ISSUER", "https://example.com"),
-		JWTTTLSeconds:    envInt("JWT_TTL_SECONDS", 3600),
+		JWTPrivateKeyPEM:      envString("JWT_PRIVATE_KEY", ""),
+		JWTIssuer:             envString("JWT_ISSUER", "https://example.com"),
+		JWTAudience:           envString("JWT_AUDIENCE", ""),
+		JWTTTLSeconds:         envInt("JWT_TTL_SECONDS", 3600),
+		SignedResultSingleUse: envBool("SIGNED_RESULT_SINGLE_USE", false),
+
+		// 요청 제한
+		RateLimitAlgorithm:          envString("RATE_LIMIT_ALGORITHM", "sliding"),
+		HTTPInitRateLimit:           envInt("HTTP_INIT_RATE_LIMIT", 0),
+		HTTPInitRateWindowSeconds:   envInt("HTTP_INIT_RATE_WINDOW_SECONDS", 60),
+		SMTPSenderRateLimit:         envInt("SMTP_SENDER_RATE_LIMIT", 0),
+		SMTPSenderRateWindowSeconds: envInt("SMTP_SENDER_RATE_WINDOW_SECONDS", 60),
+
+		// 웹훅
+		WebhookURL:                envString("WEBHOOK_URL", ""),
+		WebhookAllowedURLPrefixes: envList("WEBHOOK_ALLOWED_URL_PREFIXES", nil),
+		WebhookSecrets:            envList("WEBHOOK_SECRETS", nil),
+		WebhookTimeoutSeconds:     envInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		WebhookMaxAttempts:        envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBaseSeconds:   envInt("WEBHOOK_RETRY_BASE_SECONDS", 10),
+		WebhookRetryMaxSeconds:    envInt("WEBHOOK_RETRY_MAX_SECONDS", 3600),
+		WebhookLogTTLSeconds:      envInt("WEBHOOK_LOG_TTL_SECONDS", 86400),
+
+		// 클라이언트
+		ClientsFile: envString("CLIENTS_FILE", ""),
 	}
+	// 묘비는 세션 기록이 남을 수 있는 가장 긴 시간(대기 + 종료)의 두 배만 남겨 세션보다 훨씬 많이 쌓이지 않게 함
+	settings.SessionTombstoneTTLSeconds = envInt("SESSION_TOMBSTONE_TTL_SECONDS", 2*(settings.AuthTTLSeconds+settings.VerifiedTTLSeconds))
+	return settings
 }
 
 func envString(key, def string) string {
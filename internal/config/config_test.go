@@ -70,39 +70,116 @@ func TestLoadWithDefaultsAndOverrides(t *testing.T) {
 	t.Setenv("DEBUG", "true")
 	t.Setenv("USE_IN_MEMORY_STORE", "1")
 	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	t.Setenv("DATABASE_URL", "sqlite:///var/lib/mapae/mapae.db")
+	t.Setenv("REDIS_SENTINEL_MASTER", "mymaster")
+	t.Setenv("REDIS_SENTINEL_ADDRS", "10.0.0.1:26379,10.0.0.2:26379")
+	t.Setenv("REDIS_CLUSTER_ADDRS", `["10.0.1.1:6379"]`)
+	t.Setenv("STORE_NAMESPACE", "staging")
+	t.Setenv("MEMORY_SNAPSHOT_PATH", "/var/lib/mapae/memory.snapshot")
+	t.Setenv("MEMORY_SNAPSHOT_INTERVAL_SECONDS", "15")
+	t.Setenv("MEMORY_MAX_ENTRIES", "100000")
+	t.Setenv("STORE_RETRY_ATTEMPTS", "2")
+	t.Setenv("STORE_BREAKER_OPEN_SECONDS", "30")
+	t.Setenv("STORE_ENCRYPTION_KEYS", "k2:AAAA,k1:BBBB")
+	t.Setenv("STORE_ENCRYPT_NONCES", "true")
+	t.Setenv("STORE_ENCRYPTION_ALLOW_LEGACY", "true")
 	t.Setenv("DUMP_INBOUND", "true")
 	t.Setenv("SMS_INBOUND_ADDRESS", "verify@carrier.test")
 	t.Setenv("SMTP_HOST", "127.0.0.1")
 	t.Setenv("SMTP_PORT", "2526")
 	t.Setenv("HTTP_HOST", "127.0.0.1")
 	t.Setenv("HTTP_PORT", "8080")
+	t.Setenv("METRICS_ADDR", "127.0.0.1:9090")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,192.168.0.1/32")
 	t.Setenv("CORS_ALLOW_ORIGINS", "https://a.example,https://b.example")
 	t.Setenv("AUTH_TTL_SECONDS", "60")
 	t.Setenv("VERIFIED_TTL_SECONDS", "30")
+	t.Setenv("SESSION_TOMBSTONE_TTL_SECONDS", "3600")
 	t.Setenv("JWT_PRIVATE_KEY", "test-key")
 	t.Setenv("JWT_ISSUER", "https://issuer.example")
+	t.Setenv("JWT_AUDIENCE", "https://app.example")
 	t.Setenv("JWT_TTL_SECONDS", "120")
+	t.Setenv("SIGNED_RESULT_SINGLE_USE", "true")
+	t.Setenv("NONCE_FORMAT", "base32")
+	t.Setenv("NONCE_TAG", "OTP")
+	t.Setenv("SMS_TEMPLATE_DIR", "/etc/mapae/sms")
+	t.Setenv("SMS_BODY_LIMIT", "sms")
+	t.Setenv("RATE_LIMIT_ALGORITHM", "fixed")
+	t.Setenv("HTTP_INIT_RATE_LIMIT", "20")
+	t.Setenv("SMTP_SENDER_RATE_LIMIT", "5")
+	t.Setenv("SMTP_SENDER_RATE_WINDOW_SECONDS", "3600")
+	t.Setenv("WEBHOOK_URL", "https://api.example/hooks/mapae")
+	t.Setenv("WEBHOOK_ALLOWED_URL_PREFIXES", "https://api.example/hooks/")
+	t.Setenv("WEBHOOK_SECRETS", "new-secret,old-secret")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "5")
+	t.Setenv("CLIENTS_FILE", "/etc/mapae/clients.json")
 
 	s := Load()
 	if !s.Debug || !s.UseInMemoryStore || !s.DumpInbound {
 		t.Fatalf("boolean settings were not loaded correctly: %#v", s)
 	}
-	if s.RedisURL != "redis://localhost:6379/0" || s.SMSInboundAddress != "verify@carrier.test" {
+	if s.RedisURL != "redis://localhost:6379/0" || s.DatabaseURL != "sqlite:///var/lib/mapae/mapae.db" || s.SMSInboundAddress != "verify@carrier.test" {
 		t.Fatalf("string settings were not loaded correctly: %#v", s)
 	}
-	if s.SMTPHost != "127.0.0.1" || s.SMTPPort != 2526 || s.HTTPHost != "127.0.0.1" || s.HTTPPort != 8080 {
+	if s.RedisSentinelMaster != "mymaster" ||
+		!reflect.DeepEqual(s.RedisSentinelAddrs, []string{"10.0.0.1:26379", "10.0.0.2:26379"}) ||
+		!reflect.DeepEqual(s.RedisClusterAddrs, []string{"10.0.1.1:6379"}) ||
+		s.StoreNamespace != "staging" {
+		t.Fatalf("storage settings were not loaded correctly: %#v", s)
+	}
+	if s.MemorySnapshotPath != "/var/lib/mapae/memory.snapshot" || s.MemorySnapshotIntervalSeconds != 15 || s.MemoryMaxEntries != 100000 {
+		t.Fatalf("memory snapshot settings were not loaded correctly: %#v", s)
+	}
+	if s.StoreRetryAttempts != 2 || s.StoreRetryBaseDelayMs != 50 || s.StoreBreakerFailures != 5 || s.StoreBreakerOpenSeconds != 30 {
+		t.Fatalf("store resilience settings were not loaded correctly: %#v", s)
+	}
+	if !reflect.DeepEqual(s.StoreEncryptionKeys, []string{"k2:AAAA", "k1:BBBB"}) || !s.StoreEncryptNonces || !s.StoreEncryptionAllowLegacy {
+		t.Fatalf("store encryption settings were not loaded correctly: %#v", s)
+	}
+	if s.SMTPHost != "127.0.0.1" || s.SMTPPort != 2526 || s.HTTPHost != "127.0.0.1" || s.HTTPPort != 8080 || s.MetricsAddr != "127.0.0.1:9090" {
 		t.Fatalf("network settings were not loaded correctly: %#v", s)
 	}
+	if !reflect.DeepEqual(s.TrustedProxies, []string{"10.0.0.0/8", "192.168.0.1/32"}) {
+		t.Fatalf("trusted proxies were not loaded correctly: %#v", s.TrustedProxies)
+	}
 	if !reflect.DeepEqual(s.CORSAllowOrigins, []string{"https://a.example", "https://b.example"}) {
 		t.Fatalf("origins = %#v", s.CORSAllowOrigins)
 	}
-	if s.AuthTTLSeconds != 60 || s.VerifiedTTLSeconds != 30 || s.JWTTTLSeconds != 120 {
+	if s.AuthTTLSeconds != 60 || s.VerifiedTTLSeconds != 30 || s.SessionTombstoneTTLSeconds != 3600 || s.JWTTTLSeconds != 120 {
 		t.Fatalf("ttl settings were not loaded correctly: %#v", s)
 	}
-	if s.JWTPrivateKeyPEM != "test-key" || s.JWTIssuer != "https://issuer.example" {
+	if s.NonceFormat != "base32" || s.NonceTag != "OTP" || s.NonceLength != 8 {
+		t.Fatalf("nonce settings were not loaded correctly: %#v", s)
+	}
+	if s.SMSTemplateDir != "/etc/mapae/sms" || s.SMSDefaultLocale != "ko" || s.SMSBodyLimit != "sms" {
+		t.Fatalf("sms template settings were not loaded correctly: %#v", s)
+	}
+	if s.JWTPrivateKeyPEM != "test-key" || s.JWTIssuer != "https://issuer.example" || s.JWTAudience != "https://app.example" || !s.SignedResultSingleUse {
 		t.Fatalf("jwt settings were not loaded correctly: %#v", s)
 	}
+	if s.RateLimitAlgorithm != "fixed" || s.HTTPInitRateLimit != 20 || s.HTTPInitRateWindowSeconds != 60 ||
+		s.SMTPSenderRateLimit != 5 || s.SMTPSenderRateWindowSeconds != 3600 {
+		t.Fatalf("rate limit settings were not loaded correctly: %#v", s)
+	}
+	if s.WebhookURL != "https://api.example/hooks/mapae" ||
+		!reflect.DeepEqual(s.WebhookAllowedURLPrefixes, []string{"https://api.example/hooks/"}) ||
+		!reflect.DeepEqual(s.WebhookSecrets, []string{"new-secret", "old-secret"}) ||
+		s.WebhookTimeoutSeconds != 10 || s.WebhookMaxAttempts != 5 || s.WebhookRetryBaseSeconds != 10 ||
+		s.WebhookRetryMaxSeconds != 3600 || s.WebhookLogTTLSeconds != 86400 {
+		t.Fatalf("webhook settings were not loaded correctly: %#v", s)
+	}
+	if s.ClientsFile != "/etc/mapae/clients.json" {
+		t.Fatalf("ClientsFile = %q", s.ClientsFile)
+	}
 	if s.DataSizeLimitBytes != 128*1024 {
 		t.Fatalf("DataSizeLimitBytes = %d, want %d", s.DataSizeLimitBytes, 128*1024)
 	}
 }
+
+func TestSessionTombstoneDefaultFollowsSessionTTLs(t *testing.T) {
+	t.Setenv("AUTH_TTL_SECONDS", "60")
+	t.Setenv("VERIFIED_TTL_SECONDS", "30")
+	if got := Load().SessionTombstoneTTLSeconds; got != 180 {
+		t.Fatalf("SessionTombstoneTTLSeconds = %d, want 2 × (60 + 30)", got)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextExposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_requests_total", "Requests.", "code")
+	h := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	r.NewGaugeFunc("test_up", "Up.", func() float64 { return 1 })
+	r.NewCounterFunc("test_evictions_total", "Evictions.", func() float64 { return 7 })
+
+	c.Inc("200")
+	c.Add(2, "200")
+	c.Inc(`5"x`)
+	h.Observe(0.0625, "get")
+	h.Observe(0.5, "get")
+	h.Observe(3, "get")
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{code="200"} 3` + "\n",
+		`test_requests_total{code="5\"x"} 1` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{op="get",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{op="get",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{op="get",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{op="get"} 3.5625` + "\n",
+		`test_latency_seconds_count{op="get"} 3` + "\n",
+		"test_up 1\n",
+		"# TYPE test_evictions_total counter\ntest_evictions_total 7\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("exposition missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "Dup.")
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on duplicate metric name")
+		}
+	}()
+	r.NewCounterVec("dup_total", "Dup.")
+}
+
+func TestHandlerServesTextFormat(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("served_total", "Served.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "served_total 1\n") {
+		t.Fatalf("body = %q", rec.Body.String())
+	}
+}
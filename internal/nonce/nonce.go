@@ -0,0 +1,244 @@
+// Package nonce는 SMS 본문에 넣는 인증 코드의 형식
+//
+// 코드는 본문에 [<태그>:<코드>] 형태로 들어가며, auth.Service가 발급하고 SMTP 파서가 같은 Format으로 찾음
+package nonce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Hex64는 64자리 16진수(256비트) 코드
+	Hex64 = "hex64"
+	// Base32는 손으로 입력할 수 있는 Crockford Base32 코드
+	Base32 = "base32"
+
+	DefaultTag = "MAPAE"
+	// DefaultBase32Length는 검사 문자를 뺀 Base32 코드 길이(40비트)
+	DefaultBase32Length = 8
+
+	maxTagLength = 16
+)
+
+// Codec은 코드를 만들고, 본문에 쓰인 코드를 저장소 키에 쓰는 정규형으로 바꿈
+type Codec interface {
+	Name() string
+	Generate() (string, error)
+	// Normalize는 길이나 문자, 검사 문자가 맞지 않으면 ok=false
+	Normalize(code string) (string, bool)
+	// IsCodeByte와 MaxLen은 구분자를 포함한 본문 표기 기준
+	IsCodeByte(b byte) bool
+	MaxLen() int
+	// Short면 발급할 때 저장소에서 충돌을 확인해야 함
+	Short() bool
+}
+
+// Format은 SMS 본문의 태그(대소문자 구분 없음)와 코드 형식
+type Format struct {
+	Tag   string
+	Codec Codec
+}
+
+// New는 설정 값으로 Format을 만듦. 빈 값은 기본값(hex64, MAPAE)이며, length는 Base32 형식에서만 사용하고 0이면 기본값
+func New(format, tag string, length int) (*Format, error) {
+	if tag == "" {
+		tag = DefaultTag
+	}
+	if err := validateTag(tag); err != nil {
+		return nil, err
+	}
+	var codec Codec
+	switch format {
+	case Hex64, "":
+		codec = hexCodec{}
+	case Base32:
+		if length == 0 {
+			length = DefaultBase32Length
+		}
+		if length < 6 || length > 16 {
+			return nil, fmt.Errorf("base32 nonce length must be between 6 and 16: %d", length)
+		}
+		codec = base32Codec{length: length}
+	default:
+		return nil, fmt.Errorf("unknown nonce format %q", format)
+	}
+	return &Format{Tag: tag, Codec: codec}, nil
+}
+
+// Default는 기존 [MAPAE:<64자리 16진수>] 형식
+func Default() *Format {
+	return &Format{Tag: DefaultTag, Codec: hexCodec{}}
+}
+
+func (f *Format) Body(code string) string {
+	return "[" + f.Tag + ":" + code + "]"
+}
+
+// bodyRe는 "[<태그>:<코드>]" 후보를 찾음
+var bodyRe = regexp.MustCompile(`\[([0-9A-Za-z]+):([^\[\]\s]+)\]`)
+
+// Find는 text에서 형식에 맞는 첫 코드를 정규형으로 반환하며, 없으면 빈 문자열
+// SMTP 스트리밍 파서도 같은 규칙으로 찾으므로 이 규칙을 바꾸면 함께 바꿔야 함
+func (f *Format) Find(text string) string {
+	for _, match := range bodyRe.FindAllStringSubmatch(text, -1) {
+		if !strings.EqualFold(match[1], f.Tag) || len(match[2]) > f.Codec.MaxLen() {
+			continue
+		}
+		if code, ok := f.Codec.Normalize(match[2]); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// validateTag는 파서가 '['와 ':' 사이를 태그로 읽을 수 있도록 영문자와 숫자만 허용
+func validateTag(tag string) error {
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("nonce tag must be at most %d characters: %q", maxTagLength, tag)
+	}
+	for i := 0; i < len(tag); i++ {
+		b := tag[i]
+		if (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') {
+			continue
+		}
+		return fmt.Errorf("nonce tag must be alphanumeric: %q", tag)
+	}
+	return nil
+}
+
+const hexLength = 64
+
+// hexCodec의 정규형은 소문자
+type hexCodec struct{}
+
+func (hexCodec) Name() string { return Hex64 }
+func (hexCodec) MaxLen() int  { return hexLength }
+func (hexCodec) Short() bool  { return false }
+
+func (hexCodec) Generate() (string, error) {
+	buf := make([]byte, hexLength/2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (hexCodec) IsCodeByte(b byte) bool {
+	_, ok := hexValue(b)
+	return ok
+}
+
+func (hexCodec) Normalize(code string) (string, bool) {
+	if len(code) != hexLength {
+		return "", false
+	}
+	buf := make([]byte, hexLength)
+	for i := 0; i < len(code); i++ {
+		v, ok := hexValue(code[i])
+		if !ok {
+			return "", false
+		}
+		buf[i] = "0123456789abcdef"[v]
+	}
+	return string(buf), true
+}
+
+func hexValue(b byte) (byte, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return b - '0', true
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 10, true
+	case b >= 'A' && b <= 'F':
+		return b - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// base32Codec은 length자리 Crockford Base32 코드 뒤에 Luhn mod 32 검사 문자 1자리를 붙임
+// 읽을 때는 대소문자와 '-'를 무시하고 I/L은 1, O는 0으로 읽음
+type base32Codec struct {
+	length int
+}
+
+func (base32Codec) Name() string  { return Base32 }
+func (base32Codec) Short() bool   { return true }
+func (c base32Codec) MaxLen() int { return 2 * (c.length + 1) }
+
+func (c base32Codec) Generate() (string, error) {
+	buf := make([]byte, c.length+1)
+	if _, err := rand.Read(buf[:c.length]); err != nil {
+		return "", err
+	}
+	for i := 0; i < c.length; i++ {
+		// 256은 32의 배수이므로 치우침 없음
+		buf[i] = crockfordAlphabet[buf[i]&31]
+	}
+	buf[c.length] = checkSymbol(buf[:c.length])
+	return string(buf), nil
+}
+
+func (base32Codec) IsCodeByte(b byte) bool {
+	if b == '-' {
+		return true
+	}
+	_, ok := crockfordValue(b)
+	return ok
+}
+
+func (c base32Codec) Normalize(code string) (string, bool) {
+	buf := make([]byte, 0, c.length+1)
+	for i := 0; i < len(code); i++ {
+		if code[i] == '-' {
+			continue
+		}
+		v, ok := crockfordValue(code[i])
+		if !ok || len(buf) == c.length+1 {
+			return "", false
+		}
+		buf = append(buf, crockfordAlphabet[v])
+	}
+	if len(buf) != c.length+1 || checkSymbol(buf[:c.length]) != buf[c.length] {
+		return "", false
+	}
+	return string(buf), true
+}
+
+func crockfordValue(b byte) (byte, bool) {
+	if b >= 'a' && b <= 'z' {
+		b -= 'a' - 'A'
+	}
+	switch b {
+	case 'O':
+		return 0, true
+	case 'I', 'L':
+		return 1, true
+	case 'U':
+		return 0, false
+	}
+	for i := 0; i < len(crockfordAlphabet); i++ {
+		if crockfordAlphabet[i] == b {
+			return byte(i), true
+		}
+	}
+	return 0, false
+}
+
+// checkSymbol은 정규형 data의 Luhn mod 32 검사 문자
+func checkSymbol(data []byte) byte {
+	factor, sum := 2, 0
+	for i := len(data) - 1; i >= 0; i-- {
+		v, _ := crockfordValue(data[i])
+		addend := factor * int(v)
+		factor = 3 - factor
+		sum += addend/32 + addend%32
+	}
+	return crockfordAlphabet[(32-sum%32)%32]
+}
@@ -0,0 +1,102 @@
+package nonce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewValidatesSettings(t *testing.T) {
+	cases := map[string]struct {
+		format, tag string
+		length      int
+	}{
+		"unknown format":  {"uuid", "MAPAE", 0},
+		"tag with space":  {Hex64, "MA PAE", 0},
+		"tag with colon":  {Hex64, "MA:PAE", 0},
+		"tag too long":    {Hex64, strings.Repeat("A", maxTagLength+1), 0},
+		"short base32":    {Base32, "MAPAE", 5},
+		"too long base32": {Base32, "MAPAE", 17},
+	}
+	for name, tc := range cases {
+		if _, err := New(tc.format, tc.tag, tc.length); err == nil {
+			t.Fatalf("New(%s) should fail", name)
+		}
+	}
+	if f, err := New("", "", 0); err != nil || f.Tag != DefaultTag || f.Codec.Name() != Hex64 {
+		t.Fatalf("New() with empty settings = (%#v, %v), want default format", f, err)
+	}
+	f, err := New(Base32, "OTP", 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if f.Codec.MaxLen() != 2*(DefaultBase32Length+1) || f.Body("X") != "[OTP:X]" {
+		t.Fatalf("New() = %#v", f)
+	}
+}
+
+func TestHexNormalize(t *testing.T) {
+	codec := Default().Codec
+	code, err := codec.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if got, ok := codec.Normalize(strings.ToUpper(code)); !ok || got != code {
+		t.Fatalf("Normalize(upper) = (%q,%t), want (%q,true)", got, ok, code)
+	}
+	for _, bad := range []string{code[:63], code + "0", code[:63] + "z"} {
+		if _, ok := codec.Normalize(bad); ok {
+			t.Fatalf("Normalize(%q) should fail", bad)
+		}
+	}
+}
+
+func TestBase32GenerateAndNormalize(t *testing.T) {
+	f, err := New(Base32, DefaultTag, 8)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	codec := f.Codec
+	for i := 0; i < 100; i++ {
+		code, err := codec.Generate()
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if len(code) != 9 {
+			t.Fatalf("Generate() = %q, want 9 characters", code)
+		}
+		if got, ok := codec.Normalize(code); !ok || got != code {
+			t.Fatalf("Normalize(%q) = (%q,%t)", code, got, ok)
+		}
+	}
+
+	code := "7K1QM0XD" + string(checkSymbol([]byte("7K1QM0XD")))
+	// 손으로 입력하며 생기는 변형은 같은 코드로 읽음
+	typed := []string{
+		strings.ToLower(code),
+		code[:4] + "-" + code[4:],
+		strings.NewReplacer("1", "l", "0", "o").Replace(code),
+		strings.NewReplacer("1", "I", "0", "O").Replace(code),
+	}
+	for _, v := range typed {
+		if got, ok := codec.Normalize(v); !ok || got != code {
+			t.Fatalf("Normalize(%q) = (%q,%t), want (%q,true)", v, got, ok, code)
+		}
+	}
+	// 한 글자 오타는 검사 문자로 모두 걸러냄
+	for i := 0; i < len(code); i++ {
+		for j := 0; j < len(crockfordAlphabet); j++ {
+			if crockfordAlphabet[j] == code[i] {
+				continue
+			}
+			typo := code[:i] + string(crockfordAlphabet[j]) + code[i+1:]
+			if _, ok := codec.Normalize(typo); ok {
+				t.Fatalf("Normalize(%q) accepted a typo of %q", typo, code)
+			}
+		}
+	}
+	for _, bad := range []string{code[:8], code + "0", code[:8] + "U"} {
+		if _, ok := codec.Normalize(bad); ok {
+			t.Fatalf("Normalize(%q) should fail", bad)
+		}
+	}
+}
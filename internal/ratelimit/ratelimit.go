@@ -0,0 +1,158 @@
+// Package ratelimit는 storage.Store의 IncrEx 위에 만든 요청 제한기
+//
+// 카운터를 저장소에 두므로 같은 저장소를 쓰는 모든 인스턴스가 한도를 공유함
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"mapae/internal/storage"
+)
+
+type Algorithm string
+
+const (
+	// Fixed는 윈도 경계마다 카운터를 새로 시작. 저장소 호출이 1회지만 경계 직전/직후에 한도의 두 배까지 몰릴 수 있음
+	Fixed Algorithm = "fixed"
+	// Sliding은 직전 윈도 카운터를 남은 비율만큼 더해 경계의 몰림을 줄임(두 카운터를 저장소 호출 1회로 확인)
+	Sliding Algorithm = "sliding"
+)
+
+// Decision은 한 요청의 허용 여부와 클라이언트에 알려줄 제한 정보
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter는 거부된 요청이 다시 허용될 때까지의 시간
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow는 key(예: 클라이언트 IP)의 요청 하나를 세고 허용 여부를 반환
+	Allow(ctx context.Context, key string) (Decision, error)
+}
+
+type Options struct {
+	// Name은 카운터 키를 구분하는 이름(ratelimit:<name>:<key>:<윈도 번호>)
+	Name      string
+	Algorithm Algorithm
+	// Limit은 Window 동안 허용할 요청 수
+	Limit int
+	// Window는 1초 단위로 내림
+	Window time.Duration
+}
+
+func New(store storage.Store, opts Options) (Limiter, error) {
+	if opts.Name == "" {
+		return nil, errors.New("rate limiter name is required")
+	}
+	if opts.Limit <= 0 {
+		return nil, fmt.Errorf("rate limit must be positive: %d", opts.Limit)
+	}
+	seconds := int64(opts.Window / time.Second)
+	if seconds <= 0 {
+		return nil, fmt.Errorf("rate limit window must be at least 1s: %s", opts.Window)
+	}
+	w := window{store: store, name: opts.Name, limit: opts.Limit, seconds: seconds, now: time.Now}
+	switch opts.Algorithm {
+	case Fixed:
+		return &fixedWindow{w}, nil
+	case Sliding, "":
+		return &slidingWindow{w}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", opts.Algorithm)
+	}
+}
+
+type window struct {
+	store   storage.Store
+	name    string
+	limit   int
+	seconds int64
+	now     func() time.Time
+}
+
+func (w window) size() time.Duration {
+	return time.Duration(w.seconds) * time.Second
+}
+
+// current는 지금이 속한 윈도 번호와 윈도 시작 후 지난 시간을 반환
+func (w window) current() (int64, time.Duration) {
+	now := w.now()
+	index := now.Unix() / w.seconds
+	start := time.Unix(index*w.seconds, 0)
+	return index, now.Sub(start)
+}
+
+func (w window) key(key string, index int64) string {
+	return fmt.Sprintf("ratelimit:%s:%s:%d", w.name, key, index)
+}
+
+// KeyHashTag는 Redis Cluster에서 카운터 키를 둘 슬롯의 해시 태그이며, 카운터 키가 아니면 빈 문자열
+// 윈도 번호를 뺀 부분이므로 슬라이딩 윈도가 함께 읽는 이전 윈도 키와 같은 슬롯에 놓임
+func KeyHashTag(key string) string {
+	if !strings.HasPrefix(key, "ratelimit:") {
+		return ""
+	}
+	return key[:strings.LastIndex(key, ":")]
+}
+
+type fixedWindow struct {
+	window
+}
+
+func (l *fixedWindow) Allow(ctx context.Context, key string) (Decision, error) {
+	index, elapsed := l.current()
+	n, err := l.store.IncrEx(ctx, l.key(key, index), 1, int(l.seconds))
+	if err != nil {
+		return Decision{}, err
+	}
+	d := Decision{Allowed: n <= int64(l.limit), Limit: l.limit, Remaining: max(l.limit-int(n), 0)}
+	if !d.Allowed {
+		d.RetryAfter = l.size() - elapsed
+	}
+	return d, nil
+}
+
+type slidingWindow struct {
+	window
+}
+
+// Allow는 현재 윈도 카운터와 직전 윈도 카운터*(윈도의 남은 비율)의 합으로 최근 Window 동안의 요청 수를 추정
+// 추정치가 한도 안일 때만 저장소가 한 번에 카운터를 더하므로 거부된 요청은 세지 않음
+func (l *slidingWindow) Allow(ctx context.Context, key string) (Decision, error) {
+	index, elapsed := l.current()
+	weight := 1 - float64(elapsed)/float64(l.size())
+	// 다음 윈도에서 직전 윈도로 읽히도록 두 윈도 동안 유지
+	n, prev, added, err := l.store.SlidingIncrEx(ctx, l.key(key, index), l.key(key, index-1), weight, int64(l.limit), int(2*l.seconds))
+	if err != nil {
+		return Decision{}, err
+	}
+	if added {
+		estimate := float64(prev)*weight + float64(n)
+		return Decision{Allowed: true, Limit: l.limit, Remaining: max(int(math.Floor(float64(l.limit)-estimate)), 0)}, nil
+	}
+	return Decision{Limit: l.limit, RetryAfter: l.retryAfter(prev, n, elapsed)}, nil
+}
+
+// retryAfter는 허용된 요청 수가 그대로일 때 추정치+1이 한도 안으로 들어오는 가장 이른 시점까지의 시간
+func (l *slidingWindow) retryAfter(prev, accepted int64, elapsed time.Duration) time.Duration {
+	limit := float64(l.limit)
+	size := float64(l.size())
+	if float64(accepted)+1 <= limit && prev > 0 {
+		// 이번 윈도 안에서 직전 윈도의 가중치가 줄어들기를 기다림
+		fraction := 1 - (limit-float64(accepted)-1)/float64(prev)
+		return max(time.Duration(fraction*size)-elapsed, time.Second)
+	}
+	// 다음 윈도에서 이번 윈도의 가중치가 줄어들기를 기다림
+	fraction := 0.0
+	if accepted > 0 {
+		fraction = max(1-(limit-1)/float64(accepted), 0)
+	}
+	return l.size() - elapsed + time.Duration(fraction*size)
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapae/internal/storage/memory"
+)
+
+func newLimiter(t *testing.T, algorithm Algorithm, limit int, window time.Duration, now *time.Time) Limiter {
+	t.Helper()
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	limiter, err := New(store, Options{Name: "test", Algorithm: algorithm, Limit: limit, Window: window})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	clock := func() time.Time { return *now }
+	switch l := limiter.(type) {
+	case *fixedWindow:
+		l.now = clock
+	case *slidingWindow:
+		l.now = clock
+	}
+	return limiter
+}
+
+func allow(t *testing.T, limiter Limiter, key string) Decision {
+	t.Helper()
+	d, err := limiter.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	return d
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	cases := map[string]Options{
+		"no name":       {Limit: 1, Window: time.Minute},
+		"zero limit":    {Name: "x", Window: time.Minute},
+		"short window":  {Name: "x", Limit: 1, Window: 500 * time.Millisecond},
+		"bad algorithm": {Name: "x", Limit: 1, Window: time.Minute, Algorithm: "token"},
+	}
+	for name, opts := range cases {
+		if _, err := New(store, opts); err == nil {
+			t.Fatalf("New(%s) should fail", name)
+		}
+	}
+}
+
+func TestFixedWindowResetsAtBoundary(t *testing.T) {
+	now := time.Unix(6000, 0) // 윈도 시작
+	limiter := newLimiter(t, Fixed, 2, time.Minute, &now)
+
+	for i, wantRemaining := range []int{1, 0} {
+		if d := allow(t, limiter, "1.2.3.4"); !d.Allowed || d.Remaining != wantRemaining || d.Limit != 2 {
+			t.Fatalf("request %d = %#v, want allowed with %d remaining", i+1, d, wantRemaining)
+		}
+	}
+	now = now.Add(20 * time.Second)
+	d := allow(t, limiter, "1.2.3.4")
+	if d.Allowed || d.RetryAfter != 40*time.Second {
+		t.Fatalf("third request = %#v, want rejected with 40s retry", d)
+	}
+	if d := allow(t, limiter, "5.6.7.8"); !d.Allowed {
+		t.Fatalf("other key should have its own counter, got %#v", d)
+	}
+
+	now = now.Add(40 * time.Second)
+	if d := allow(t, limiter, "1.2.3.4"); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("request in next window = %#v, want allowed with 1 remaining", d)
+	}
+}
+
+func TestSlidingWindowWeightsPreviousWindow(t *testing.T) {
+	now := time.Unix(6000, 0)
+	limiter := newLimiter(t, Sliding, 4, time.Minute, &now)
+
+	for i := 0; i < 4; i++ {
+		if d := allow(t, limiter, "k"); !d.Allowed {
+			t.Fatalf("request %d rejected: %#v", i+1, d)
+		}
+	}
+	// 다음 윈도 6초 시점: 4*0.9+1 = 4.6 > 4 이므로 거부(고정 윈도라면 허용됨)
+	// 직전 윈도 가중치가 4*0.75가 되는 15초 시점까지 9초 대기
+	now = now.Add(time.Minute + 6*time.Second)
+	if d := allow(t, limiter, "k"); d.Allowed || d.RetryAfter != 9*time.Second {
+		t.Fatalf("request after boundary = %#v, want rejected with 9s retry", d)
+	}
+
+	// 거부된 요청은 세지 않으므로 15초 시점에는 4*0.75+1 = 4 로 허용
+	now = now.Add(9 * time.Second)
+	if d := allow(t, limiter, "k"); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("request at 15s = %#v, want allowed with 0 remaining", d)
+	}
+	// 4*0.75+2 = 5 > 4, 4*(1-f)+2 <= 4 가 되는 30초 시점까지 15초 대기
+	if d := allow(t, limiter, "k"); d.Allowed || d.RetryAfter != 15*time.Second {
+		t.Fatalf("second request at 15s = %#v, want rejected with 15s retry", d)
+	}
+}
+
+// 동시에 들어온 요청도 한도만큼만 허용해야 함
+func TestSlidingWindowConcurrentRequests(t *testing.T) {
+	now := time.Unix(6000, 0)
+	limiter := newLimiter(t, Sliding, 10, time.Minute, &now)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := limiter.Allow(context.Background(), "k")
+			if err != nil {
+				t.Errorf("Allow() error = %v", err)
+				return
+			}
+			if d.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 10 {
+		t.Fatalf("allowed %d requests, want 10", n)
+	}
+}
+
+func TestKeyHashTagSharesWindows(t *testing.T) {
+	w := window{name: "auth_init"}
+	current, previous := w.key("10.0.0.1", 7), w.key("10.0.0.1", 6)
+	if KeyHashTag(current) == "" || KeyHashTag(current) != KeyHashTag(previous) {
+		t.Fatalf("KeyHashTag(%q) = %q, KeyHashTag(%q) = %q, want the same non-empty tag", current, KeyHashTag(current), previous, KeyHashTag(previous))
+	}
+	if KeyHashTag(w.key("10.0.0.2", 7)) == KeyHashTag(current) {
+		t.Fatalf("different clients share a hash tag")
+	}
+	if tag := KeyHashTag("auth:abc"); tag != "" {
+		t.Fatalf("KeyHashTag(auth:abc) = %q, want empty", tag)
+	}
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriberBuffer는 구독자별 채널 버퍼 크기
+// 수신이 밀려 버퍼가 차면 이후 메시지는 버림(알림 용도이므로 수신 측에서 상태를 다시 조회)
+const subscriberBuffer = 16
+
+// Broker는 프로세스 내부 발행/구독 허브
+// 단일 인스턴스로 동작하는 저장소(memory, SQLite)와 외부 알림을 받아 지역 구독자에게 나눠주는 용도로 사용
+type Broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan string]struct{}
+}
+
+func New() *Broker {
+	return &Broker{subs: map[string]map[chan string]struct{}{}}
+}
+
+// Publish는 channel의 모든 구독자에게 message를 보내고, 전달된 구독자 수를 반환
+func (b *Broker) Publish(channel, message string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delivered := 0
+	for ch := range b.subs[channel] {
+		select {
+		case ch <- message:
+			delivered++
+		default:
+		}
+	}
+	return delivered
+}
+
+// Subscribe는 ctx가 끝날 때까지 channel로 발행된 메시지를 받는 채널을 반환하며, ctx가 끝나면 채널을 닫음
+func (b *Broker) Subscribe(ctx context.Context, channel string) <-chan string {
+	ch := make(chan string, subscriberBuffer)
+	b.mu.Lock()
+	if b.subs[channel] == nil {
+		b.subs[channel] = map[chan string]struct{}{}
+	}
+	b.subs[channel][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[channel], ch)
+		if len(b.subs[channel]) == 0 {
+			delete(b.subs, channel)
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// Subscribers는 channel의 현재 구독자 수를 반환
+func (b *Broker) Subscribers(channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[channel])
+}
@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPublishDeliversToSubscribers(t *testing.T) {
+	b := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := b.Subscribe(ctx, "auth:a")
+	second := b.Subscribe(ctx, "auth:a")
+	other := b.Subscribe(ctx, "auth:b")
+
+	if n := b.Publish("auth:a", "verified"); n != 2 {
+		t.Fatalf("Publish() delivered to %d subscribers, want 2", n)
+	}
+	for _, ch := range []<-chan string{first, second} {
+		select {
+		case msg := <-ch:
+			if msg != "verified" {
+				t.Fatalf("message = %q, want verified", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber did not receive message")
+		}
+	}
+	select {
+	case msg := <-other:
+		t.Fatalf("unrelated subscriber received %q", msg)
+	default:
+	}
+}
+
+func TestSubscribeClosesOnContextDone(t *testing.T) {
+	b := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := b.Subscribe(ctx, "auth:a")
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatalf("channel should be closed without messages")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("channel was not closed after cancel")
+	}
+	if n := b.Subscribers("auth:a"); n != 0 {
+		t.Fatalf("Subscribers() = %d after cancel, want 0", n)
+	}
+	if n := b.Publish("auth:a", "verified"); n != 0 {
+		t.Fatalf("Publish() after cancel delivered to %d subscribers", n)
+	}
+}
+
+func TestPublishDropsWhenSubscriberIsFull(t *testing.T) {
+	b := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_ = b.Subscribe(ctx, "auth:a")
+
+	for i := 0; i < subscriberBuffer; i++ {
+		if n := b.Publish("auth:a", "m"); n != 1 {
+			t.Fatalf("Publish() #%d delivered to %d, want 1", i, n)
+		}
+	}
+	if n := b.Publish("auth:a", "overflow"); n != 0 {
+		t.Fatalf("Publish() to a full subscriber should be dropped, delivered to %d", n)
+	}
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"mapae/internal/metrics"
+)
+
+// Instrumented는 store의 작업별 지연 시간, 오류 수, 조회 적중/실패를 registry에 기록하는 Store를 반환
+// 지표는 작업(op)과 키 계열(family: 첫 ":" 앞 부분, 예: auth, nonce)으로 구분
+// Namespaced보다 바깥에 감싸야 네임스페이스가 아닌 키 계열로 집계됨
+func Instrumented(store Store, registry *metrics.Registry) Store {
+	return &instrumentedStore{
+		store: store,
+		duration: registry.NewHistogramVec(
+			"mapae_store_operation_duration_seconds",
+			"Latency of storage operations.",
+			metrics.DefaultBuckets, "op", "family",
+		),
+		errors: registry.NewCounterVec(
+			"mapae_store_operation_errors_total",
+			"Storage operations that returned an error.",
+			"op", "family",
+		),
+		lookups: registry.NewCounterVec(
+			"mapae_store_lookups_total",
+			"Storage reads by result (hit or miss).",
+			"op", "family", "result",
+		),
+	}
+}
+
+type instrumentedStore struct {
+	store    Store
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+	lookups  *metrics.CounterVec
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.store.Ping(ctx)
+	s.observe("ping", "", start, err)
+	return err
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, key string) (string, bool, error) {
+	start := time.Now()
+	value, ok, err := s.store.Get(ctx, key)
+	s.observeLookup("get", keyFamily(key), start, ok, err)
+	return value, ok, err
+}
+
+func (s *instrumentedStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	start := time.Now()
+	ttl, ok, err := s.store.TTL(ctx, key)
+	s.observeLookup("ttl", keyFamily(key), start, ok, err)
+	return ttl, ok, err
+}
+
+func (s *instrumentedStore) Take(ctx context.Context, key string) (string, bool, error) {
+	start := time.Now()
+	value, ok, err := s.store.Take(ctx, key)
+	s.observeLookup("take", keyFamily(key), start, ok, err)
+	return value, ok, err
+}
+
+func (s *instrumentedStore) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	start := time.Now()
+	err := s.store.SetEx(ctx, key, value, ttlSeconds)
+	s.observe("set_ex", keyFamily(key), start, err)
+	return err
+}
+
+// MSetEx는 첫 번째 키의 계열로 집계
+func (s *instrumentedStore) MSetEx(ctx context.Context, entries ...Entry) error {
+	start := time.Now()
+	err := s.store.MSetEx(ctx, entries...)
+	family := "other"
+	if len(entries) > 0 {
+		family = keyFamily(entries[0].Key)
+	}
+	s.observe("mset_ex", family, start, err)
+	return err
+}
+
+func (s *instrumentedStore) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	start := time.Now()
+	added, err := s.store.AddEx(ctx, key, value, ttlSeconds)
+	s.observe("add_ex", keyFamily(key), start, err)
+	return added, err
+}
+
+func (s *instrumentedStore) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	start := time.Now()
+	n, err := s.store.IncrEx(ctx, key, delta, ttlSeconds)
+	s.observe("incr_ex", keyFamily(key), start, err)
+	return n, err
+}
+
+func (s *instrumentedStore) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	start := time.Now()
+	current, previous, added, err := s.store.SlidingIncrEx(ctx, key, prev, prevWeight, limit, ttlSeconds)
+	s.observe("sliding_incr_ex", keyFamily(key), start, err)
+	return current, previous, added, err
+}
+
+func (s *instrumentedStore) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	start := time.Now()
+	ok, err := s.store.TakeAndSetEx(ctx, key, expected, target, value, ttlSeconds)
+	s.observeLookup("take_and_set_ex", keyFamily(key), start, ok, err)
+	return ok, err
+}
+
+func (s *instrumentedStore) Publish(ctx context.Context, channel, message string) error {
+	start := time.Now()
+	err := s.store.Publish(ctx, channel, message)
+	s.observe("publish", keyFamily(channel), start, err)
+	return err
+}
+
+func (s *instrumentedStore) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	start := time.Now()
+	messages, err := s.store.Subscribe(ctx, channel)
+	s.observe("subscribe", keyFamily(channel), start, err)
+	return messages, err
+}
+
+func (s *instrumentedStore) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	start := time.Now()
+	err := s.store.Schedule(ctx, queue, member, at)
+	s.observe("schedule", keyFamily(queue), start, err)
+	return err
+}
+
+// ClaimDue는 항목을 하나 이상 가져왔으면 hit로 집계
+func (s *instrumentedStore) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	start := time.Now()
+	members, err := s.store.ClaimDue(ctx, queue, now, lease, limit)
+	s.observeLookup("claim_due", keyFamily(queue), start, len(members) > 0, err)
+	return members, err
+}
+
+func (s *instrumentedStore) Unschedule(ctx context.Context, queue, member string) error {
+	start := time.Now()
+	err := s.store.Unschedule(ctx, queue, member)
+	s.observe("unschedule", keyFamily(queue), start, err)
+	return err
+}
+
+func (s *instrumentedStore) observe(op, family string, start time.Time, err error) {
+	s.duration.Observe(time.Since(start).Seconds(), op, family)
+	if err != nil {
+		s.errors.Inc(op, family)
+	}
+}
+
+func (s *instrumentedStore) observeLookup(op, family string, start time.Time, ok bool, err error) {
+	s.observe(op, family, start, err)
+	if err != nil {
+		return
+	}
+	result := "miss"
+	if ok {
+		result = "hit"
+	}
+	s.lookups.Inc(op, family, result)
+}
+
+// keyFamily는 키의 첫 ":" 앞 부분을 반환하며, 구분자가 없으면 "other"
+func keyFamily(key string) string {
+	family, _, found := strings.Cut(key, ":")
+	if !found || family == "" {
+		return "other"
+	}
+	return family
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mapae/internal/metrics"
+)
+
+type failingSetStore struct {
+	mapStore
+}
+
+func (failingSetStore) SetEx(context.Context, string, string, int) error {
+	return errors.New("write failed")
+}
+
+func TestInstrumentedRecordsHitMissAndLatency(t *testing.T) {
+	registry := metrics.NewRegistry()
+	store := Instrumented(mapStore{}, registry)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "auth:missing"); ok {
+		t.Fatalf("Get() should miss")
+	}
+	if ok, _ := store.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); !ok {
+		t.Fatalf("TakeAndSetEx() should hit")
+	}
+	if _, ok, _ := store.Get(ctx, "auth:id1"); !ok {
+		t.Fatalf("Get() should hit")
+	}
+
+	s := store.(*instrumentedStore)
+	if got := s.lookups.Value("get", "auth", "hit"); got != 1 {
+		t.Fatalf("get/auth hits = %v, want 1", got)
+	}
+	if got := s.lookups.Value("get", "auth", "miss"); got != 1 {
+		t.Fatalf("get/auth misses = %v, want 1", got)
+	}
+	if got := s.lookups.Value("take_and_set_ex", "nonce", "hit"); got != 1 {
+		t.Fatalf("take_and_set_ex/nonce hits = %v, want 1", got)
+	}
+	if got := s.duration.Count("get", "auth"); got != 2 {
+		t.Fatalf("get/auth observations = %d, want 2", got)
+	}
+	if got := s.duration.Count("set_ex", "nonce"); got != 1 {
+		t.Fatalf("set_ex/nonce observations = %d, want 1", got)
+	}
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `mapae_store_lookups_total{op="get",family="auth",result="hit"} 1`) {
+		t.Fatalf("exposition missing lookup counter:\n%s", out.String())
+	}
+}
+
+func TestInstrumentedCountsErrors(t *testing.T) {
+	registry := metrics.NewRegistry()
+	store := Instrumented(failingSetStore{mapStore{}}, registry)
+
+	if err := store.SetEx(context.Background(), "auth:a", "pending", 60); err == nil {
+		t.Fatalf("SetEx() should propagate the error")
+	}
+	s := store.(*instrumentedStore)
+	if got := s.errors.Value("set_ex", "auth"); got != 1 {
+		t.Fatalf("set_ex/auth errors = %v, want 1", got)
+	}
+}
+
+func TestKeyFamily(t *testing.T) {
+	cases := map[string]string{
+		"auth:abc":   "auth",
+		"nonce:ab12": "nonce",
+		"plain":      "other",
+		":x":         "other",
+	}
+	for key, want := range cases {
+		if got := keyFamily(key); got != want {
+			t.Fatalf("keyFamily(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
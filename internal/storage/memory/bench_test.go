@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func newBenchClient(b *testing.B) *Client {
+	b.Helper()
+	c, err := New()
+	if err != nil {
+		b.Fatalf("New() error = %v", err)
+	}
+	b.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func BenchmarkSetEx(b *testing.B) {
+	c := newBenchClient(b)
+	ctx := context.Background()
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := fmt.Sprintf("auth:%032x", n.Add(1))
+			if err := c.SetEx(ctx, key, `{"status":"pending","timestamp":"2026-01-01T00:00:00Z"}`, 600); err != nil {
+				b.Fatalf("SetEx() error = %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	c := newBenchClient(b)
+	ctx := context.Background()
+	const keys = 1 << 14
+	for i := 0; i < keys; i++ {
+		if err := c.SetEx(ctx, fmt.Sprintf("auth:%032x", i), "pending", 600); err != nil {
+			b.Fatalf("SetEx() error = %v", err)
+		}
+	}
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, ok, err := c.Get(ctx, fmt.Sprintf("auth:%032x", n.Add(1)%keys)); err != nil || !ok {
+				b.Fatalf("Get() = (ok=%t, err=%v)", ok, err)
+			}
+		}
+	})
+}
+
+// BenchmarkInitVerify는 InitAuth(SetEx 2회)와 SMTP 검증(TakeAndSetEx), 조회(Get)를 한 세션으로 반복
+func BenchmarkInitVerify(b *testing.B) {
+	c := newBenchClient(b)
+	ctx := context.Background()
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := n.Add(1)
+			authID := fmt.Sprintf("%032x", i)
+			nonceKey := fmt.Sprintf("nonce:%064x", i)
+			if err := c.SetEx(ctx, "auth:"+authID, "pending", 600); err != nil {
+				b.Fatalf("SetEx() error = %v", err)
+			}
+			if err := c.SetEx(ctx, nonceKey, authID, 600); err != nil {
+				b.Fatalf("SetEx() error = %v", err)
+			}
+			if ok, err := c.TakeAndSetEx(ctx, nonceKey, authID, "auth:"+authID, "verified", 300); err != nil || !ok {
+				b.Fatalf("TakeAndSetEx() = (ok=%t, err=%v)", ok, err)
+			}
+			if _, ok, err := c.Get(ctx, "auth:"+authID); err != nil || !ok {
+				b.Fatalf("Get() = (ok=%t, err=%v)", ok, err)
+			}
+		}
+	})
+}
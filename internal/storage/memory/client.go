@@ -2,107 +2,474 @@ package memory
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"hash/fnv"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/allegro/bigcache/v3"
+	"mapae/internal/storage"
+	"mapae/internal/storage/broker"
 )
 
+// Client는 키별 만료 시각을 가진 샤드 맵 기반 저장소
+//
+// 다른 저장소와 같게 이미 끝난 ctx로 호출하면 아무것도 바꾸지 않고 ctx.Err()를 반환
+// 모든 작업은 키가 속한 샤드의 잠금 안에서 수행되므로 Get/Take/SetEx가 서로 선형화됨
+// 만료된 항목은 조회 시 즉시 숨겨지고, 샤드별 만료 힙을 주기적으로 훑어 메모리에서 제거
 type Client struct {
-	cache   *bigcache.BigCache
-	stripes [lockStripeCount]sync.Mutex
+	shards        [shardCount]shard
+	shardCapacity int
+	evictFirst    []string
+	now           func() time.Time
+
+	expired atomic.Uint64
+	evicted atomic.Uint64
+
+	queues  queueSet
+	persist *persistence
+	bus     *broker.Broker
+
+	closeOnce sync.Once
+	stopSweep chan struct{}
+	sweepDone chan struct{}
 }
 
-type entry struct {
-	Value     string `json:"value"`
-	ExpiresAt int64  `json:"expires_at"`
+// Options는 메모리 저장소 설정
+// SnapshotPath가 비어 있으면 재시작 시 모든 데이터가 사라지며,
+// 지정하면 SnapshotInterval마다 스냅샷을 남기고 그 사이의 변경은 SnapshotPath+".aof"에 추가 기록
+type Options struct {
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	// AOFSyncAlways면 변경마다 AOF를 fsync해 응답한 변경이 운영체제 장애에도 남음
+	// 끄면 1초마다 fsync하므로 운영체제나 전원 장애 때 마지막 1초의 변경을 잃을 수 있음
+	AOFSyncAlways bool
+	// MaxEntries는 보관할 최대 항목 수(0이면 제한 없음)
+	// 샤드별로 나누어 적용하며, 가득 찬 샤드에 새 키를 쓰면 가장 먼저 만료될 항목을 내보냄
+	MaxEntries int
+	// EvictFirst는 가득 찼을 때 만료 시각과 관계없이 먼저 내보낼 키의 접두사(예: 오래 남는 묘비)
+	EvictFirst []string
+	// SweepInterval은 만료된 항목을 메모리에서 제거하는 주기(기본 1초)
+	SweepInterval time.Duration
 }
 
-const lockStripeCount = 256
+// Stats는 저장소 상태와 누적 제거 횟수
+type Stats struct {
+	Entries int
+	// Expired는 만료되어 제거된 항목 수
+	Expired uint64
+	// Evicted는 용량 초과로 만료 전에 내보낸 항목 수
+	Evicted uint64
+	// AOFWriteErrors는 실패한 AOF 기록과 fsync 수
+	AOFWriteErrors uint64
+}
+
+const (
+	shardCount           = 256
+	defaultSweepInterval = time.Second
+)
 
 func New() (*Client, error) {
-	cache, err := bigcache.New(context.Background(), bigcache.Config{
-		Shards:           1024,
-		LifeWindow:       24 * time.Hour,
-		CleanWindow:      5 * time.Minute,
-		MaxEntrySize:     4096,
-		HardMaxCacheSize: 64,
-		Verbose:          false,
-	})
-	if err != nil {
-		return nil, err
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions는 SnapshotPath가 있으면 스냅샷과 AOF를 순서대로 재생해 만료되지 않은 항목을 복원
+func NewWithOptions(opts Options) (*Client, error) {
+	if opts.MaxEntries < 0 {
+		return nil, fmt.Errorf("max entries must not be negative: %d", opts.MaxEntries)
+	}
+	c := &Client{
+		now:       time.Now,
+		bus:       broker.New(),
+		stopSweep: make(chan struct{}),
+		sweepDone: make(chan struct{}),
+
+		evictFirst: opts.EvictFirst,
+	}
+	if opts.MaxEntries > 0 {
+		c.shardCapacity = (opts.MaxEntries + shardCount - 1) / shardCount
+	}
+	for i := range c.shards {
+		c.shards[i].items = map[string]*item{}
+	}
+	c.queues.queues = map[string]map[string]int64{}
+	if opts.SnapshotPath != "" {
+		if err := c.startPersistence(opts); err != nil {
+			return nil, err
+		}
+	}
+	interval := opts.SweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
 	}
-	return &Client{cache: cache}, nil
+	go c.sweepLoop(interval)
+	return c, nil
 }
 
-func (c *Client) Ping(_ context.Context) error {
+// Ping은 AOF 기록이 실패해 재시작 때 잃을 변경이 있으면 다음 스냅샷이 성공할 때까지 오류를 반환
+func (c *Client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.persist != nil {
+		return c.persist.failure()
+	}
 	return nil
 }
 
-func (c *Client) Get(_ context.Context, key string) (string, bool, error) {
-	raw, err := c.cache.Get(key)
-	if errors.Is(err, bigcache.ErrEntryNotFound) {
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := c.live(s, key)
+	if it == nil {
 		return "", false, nil
 	}
-	if err != nil {
-		return "", false, err
+	return it.value, true, nil
+}
+
+// TTL은 항목의 만료 시각까지 남은 시간을 반환
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := c.live(s, key)
+	if it == nil {
+		return 0, false, nil
 	}
-	var e entry
-	if err := json.Unmarshal(raw, &e); err != nil {
+	return time.Duration(it.expiresAt - c.now().UnixNano()), true, nil
+}
+
+func (c *Client) Take(ctx context.Context, key string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
 		return "", false, err
 	}
-	if time.Now().Unix() >= e.ExpiresAt {
-		_ = c.cache.Delete(key)
+	defer c.beginWrite()()
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := c.live(s, key)
+	if it == nil {
 		return "", false, nil
 	}
-	return e.Value, true, nil
+	s.remove(it)
+	c.logDelete(key)
+	return it.value, true, nil
 }
 
-func (c *Client) Take(ctx context.Context, key string) (string, bool, error) {
-	lock := &c.stripes[stripeIndex(key)]
-	lock.Lock()
-	defer lock.Unlock()
+func (c *Client) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	expiresAt, err := c.expiresAt(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer c.beginWrite()()
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.set(s, key, value, expiresAt)
+	return nil
+}
 
-	raw, err := c.cache.Get(key)
-	if errors.Is(err, bigcache.ErrEntryNotFound) {
-		return "", false, nil
+// MSetEx는 관련된 샤드를 번호 순서대로 모두 잠근 상태에서 기록하므로 다른 작업에는 한 번에 보임
+func (c *Client) MSetEx(ctx context.Context, entries ...storage.Entry) error {
+	expiresAt := make([]int64, len(entries))
+	for i, e := range entries {
+		var err error
+		if expiresAt[i], err = c.expiresAt(e.TTLSeconds); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer c.beginWrite()()
+	var locked [shardCount]bool
+	for _, e := range entries {
+		locked[shardIndex(e.Key)] = true
+	}
+	for i := range c.shards {
+		if locked[i] {
+			c.shards[i].mu.Lock()
+			defer c.shards[i].mu.Unlock()
+		}
 	}
+	for i, e := range entries {
+		c.set(c.shardFor(e.Key), e.Key, e.Value, expiresAt[i])
+	}
+	return nil
+}
+
+func (c *Client) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	expiresAt, err := c.expiresAt(ttlSeconds)
 	if err != nil {
-		return "", false, err
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
+	defer c.beginWrite()()
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.live(s, key) != nil {
+		return false, nil
+	}
+	c.set(s, key, value, expiresAt)
+	return true, nil
+}
 
-	var e entry
-	if err := json.Unmarshal(raw, &e); err != nil {
-		return "", false, err
+// IncrEx는 값을 10진수 문자열로 저장하므로 Get으로도 읽을 수 있음
+func (c *Client) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	expiresAt, err := c.expiresAt(ttlSeconds)
+	if err != nil {
+		return 0, err
 	}
-	if time.Now().Unix() >= e.ExpiresAt {
-		_ = c.cache.Delete(key)
-		return "", false, nil
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	defer c.beginWrite()()
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	if it := c.live(s, key); it != nil {
+		current, err := strconv.ParseInt(it.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %q is not an integer", key)
+		}
+		n = current
+		expiresAt = it.expiresAt
 	}
+	n += delta
+	c.set(s, key, strconv.FormatInt(n, 10), expiresAt)
+	return n, nil
+}
 
-	if err := c.cache.Delete(key); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
-		return "", false, err
+// SlidingIncrEx는 key와 prev의 샤드를 번호 순서대로 잠근 상태에서 두 값을 읽고 비교해 더함
+func (c *Client) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	expiresAt, err := c.expiresAt(ttlSeconds)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, 0, false, err
+	}
+	defer c.beginWrite()()
+	cur, prv := shardIndex(key), shardIndex(prev)
+	first, second := min(cur, prv), max(cur, prv)
+	c.shards[first].mu.Lock()
+	defer c.shards[first].mu.Unlock()
+	if second != first {
+		c.shards[second].mu.Lock()
+		defer c.shards[second].mu.Unlock()
+	}
+	previous, _, err := c.counter(&c.shards[prv], prev)
+	if err != nil {
+		return 0, 0, false, err
 	}
-	return e.Value, true, nil
+	current, it, err := c.counter(&c.shards[cur], key)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if float64(current+1)+float64(previous)*prevWeight > float64(limit) {
+		return current, previous, false, nil
+	}
+	if it != nil {
+		expiresAt = it.expiresAt
+	}
+	current++
+	c.set(&c.shards[cur], key, strconv.FormatInt(current, 10), expiresAt)
+	return current, previous, true, nil
+}
+
+// counter는 만료되지 않은 key의 정수 값이며, 없으면 0
+func (c *Client) counter(s *shard, key string) (int64, *item, error) {
+	it := c.live(s, key)
+	if it == nil {
+		return 0, nil, nil
+	}
+	n, err := strconv.ParseInt(it.value, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("value of %q is not an integer", key)
+	}
+	return n, it, nil
 }
 
-func stripeIndex(key string) int {
+// TakeAndSetEx는 key와 target의 샤드를 번호 순서대로 잠근 상태에서 비교, target 기록, key 삭제를 수행
+// 메모리 안에서 끝나는 작업이므로 중간에 실패하지 않음
+func (c *Client) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	expiresAt, err := c.expiresAt(ttlSeconds)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	defer c.beginWrite()()
+	src, dst := shardIndex(key), shardIndex(target)
+	first, second := min(src, dst), max(src, dst)
+	c.shards[first].mu.Lock()
+	defer c.shards[first].mu.Unlock()
+	if second != first {
+		c.shards[second].mu.Lock()
+		defer c.shards[second].mu.Unlock()
+	}
+	it := c.live(&c.shards[src], key)
+	if it == nil || it.value != expected {
+		return false, nil
+	}
+	c.set(&c.shards[dst], target, value, expiresAt)
+	c.shards[src].remove(it)
+	c.logDelete(key)
+	return true, nil
+}
+
+// Publish는 같은 프로세스의 구독자에게만 전달
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.bus.Publish(channel, message)
+	return nil
+}
+
+func (c *Client) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	return c.bus.Subscribe(ctx, channel), nil
+}
+
+func (c *Client) Stats() Stats {
+	entries := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		entries += len(s.items)
+		s.mu.Unlock()
+	}
+	stats := Stats{Entries: entries, Expired: c.expired.Load(), Evicted: c.evicted.Load()}
+	if c.persist != nil {
+		stats.AOFWriteErrors = c.persist.writeErrors.Load()
+	}
+	return stats
+}
+
+// Close는 만료 정리를 멈추고, 영속화가 켜져 있으면 마지막 스냅샷을 남김
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stopSweep)
+	})
+	<-c.sweepDone
+	return c.closePersistence()
+}
+
+func (c *Client) expiresAt(ttlSeconds int) (int64, error) {
+	if ttlSeconds <= 0 {
+		return 0, storage.InvalidTTL(ttlSeconds)
+	}
+	return c.now().Add(time.Duration(ttlSeconds) * time.Second).UnixNano(), nil
+}
+
+func (c *Client) shardFor(key string) *shard {
+	return &c.shards[shardIndex(key)]
+}
+
+// live는 만료되지 않은 항목을 반환하며, 만료된 항목은 그 자리에서 제거(s 잠금 필요)
+func (c *Client) live(s *shard, key string) *item {
+	it, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if c.now().UnixNano() >= it.expiresAt {
+		s.remove(it)
+		c.expired.Add(1)
+		return nil
+	}
+	return it
+}
+
+// set은 항목을 기록하고 AOF에 남기며, 샤드가 가득 찼으면 가장 먼저 만료될 항목을 내보냄(s 잠금 필요)
+func (c *Client) set(s *shard, key, value string, expiresAt int64) {
+	if _, exists := s.items[key]; !exists && c.shardCapacity > 0 && len(s.items) >= c.shardCapacity {
+		if victim := s.victim(); victim != nil {
+			s.remove(victim)
+			c.evicted.Add(1)
+			c.logDelete(victim.key)
+		}
+	}
+	s.put(key, value, expiresAt, c.spare(key))
+	c.logSet(key, value, expiresAt)
+}
+
+// spare는 key가 EvictFirst 접두사로 시작하는지 여부
+func (c *Client) spare(key string) bool {
+	for _, prefix := range c.evictFirst {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) sweepLoop(interval time.Duration) {
+	defer close(c.sweepDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopSweep:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+// sweep은 모든 샤드에서 만료 시각이 지난 항목을 힙 순서대로 제거
+func (c *Client) sweep() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		now := c.now().UnixNano()
+		for {
+			it := s.soonest()
+			if it == nil || it.expiresAt > now {
+				break
+			}
+			s.remove(it)
+			c.expired.Add(1)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func shardIndex(key string) int {
+	// nonce 키는 이미 균등 분포된 HEX이므로 앞 두 자리를 그대로 샤드 번호로 사용
+	// 네임스페이스가 붙은 키("<ns>:nonce:<hex>")도 같은 경로를 타도록 마지막 "nonce:" 위치를 찾음
 	const noncePrefix = "nonce:"
-	if len(key) >= len(noncePrefix)+2 && key[:len(noncePrefix)] == noncePrefix {
-		if hi, ok := fromHexNibble(key[len(noncePrefix)]); ok {
-			if lo, ok := fromHexNibble(key[len(noncePrefix)+1]); ok {
-				return int((hi << 4) | lo)
+	if idx := strings.LastIndex(key, noncePrefix); idx == 0 || (idx > 0 && key[idx-1] == ':') {
+		rest := key[idx+len(noncePrefix):]
+		if len(rest) >= 2 {
+			if hi, ok := fromHexNibble(rest[0]); ok {
+				if lo, ok := fromHexNibble(rest[1]); ok {
+					return int((hi << 4) | lo)
+				}
 			}
 		}
 	}
 
 	h := fnv.New32a()
 	_, _ = h.Write([]byte(key))
-	return int(h.Sum32() % lockStripeCount)
+	return int(h.Sum32() % shardCount)
 }
 
 func fromHexNibble(b byte) (byte, bool) {
@@ -117,17 +484,3 @@ func fromHexNibble(b byte) (byte, bool) {
 		return 0, false
 	}
 }
-
-func (c *Client) SetEx(_ context.Context, key, value string, ttlSeconds int) error {
-	if ttlSeconds <= 0 {
-		return fmt.Errorf("ttl must be positive: %d", ttlSeconds)
-	}
-	payload, err := json.Marshal(entry{
-		Value:     value,
-		ExpiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second).Unix(),
-	})
-	if err != nil {
-		return err
-	}
-	return c.cache.Set(key, payload)
-}
@@ -2,7 +2,7 @@ package memory
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -56,39 +56,30 @@ func TestSetExRejectsNonPositiveTTL(t *testing.T) {
 }
 
 func TestGetExpiredEntry(t *testing.T) {
-	c, err := New()
+	// 시계를 바꾸는 동안 백그라운드 정리가 돌지 않도록 주기를 길게 둠
+	c, err := NewWithOptions(Options{SweepInterval: time.Hour})
 	if err != nil {
-		t.Fatalf("New() error = %v", err)
+		t.Fatalf("NewWithOptions() error = %v", err)
 	}
+	defer c.Close()
+	now := time.Now()
+	c.now = func() time.Time { return now }
 
-	payload, err := json.Marshal(entry{Value: "v", ExpiresAt: time.Now().Add(-time.Second).Unix()})
-	if err != nil {
-		t.Fatalf("json.Marshal() error = %v", err)
-	}
-	if err := c.cache.Set("expired", payload); err != nil {
-		t.Fatalf("cache.Set() error = %v", err)
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "expired", "v", 1); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
 	}
+	now = now.Add(time.Second)
 
-	_, ok, err := c.Get(context.Background(), "expired")
+	_, ok, err := c.Get(ctx, "expired")
 	if err != nil {
 		t.Fatalf("Get() error = %v", err)
 	}
 	if ok {
 		t.Fatalf("expired key should be treated as not found")
 	}
-}
-
-func TestGetInvalidPayloadReturnsError(t *testing.T) {
-	c, err := New()
-	if err != nil {
-		t.Fatalf("New() error = %v", err)
-	}
-	if err := c.cache.Set("broken", []byte("not-json")); err != nil {
-		t.Fatalf("cache.Set() error = %v", err)
-	}
-
-	if _, _, err := c.Get(context.Background(), "broken"); err == nil {
-		t.Fatalf("Get() should fail for invalid payload")
+	if stats := c.Stats(); stats.Entries != 0 || stats.Expired != 1 {
+		t.Fatalf("Stats() = %+v, want no entries and one expiry", stats)
 	}
 }
 
@@ -126,3 +117,252 @@ func TestTakeIsAtomicUnderConcurrency(t *testing.T) {
 		t.Fatalf("successful Take count = %d, want 1", got)
 	}
 }
+
+func TestTakeAndSetEx(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "auth:id1", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	// 기록 실패 시 nonce는 남아 있어야 함
+	if _, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 0); err == nil {
+		t.Fatalf("TakeAndSetEx() should fail for non-positive ttl")
+	}
+	if _, ok, _ := c.Get(ctx, "nonce:ab"); !ok {
+		t.Fatalf("nonce should survive a failed TakeAndSetEx")
+	}
+
+	// 다른 세션을 가리키면 아무것도 쓰지 않음
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id2", "auth:id2", "verified", 30); err != nil || ok {
+		t.Fatalf("TakeAndSetEx() with another value = (%t,%v), want (false,nil)", ok, err)
+	}
+	if _, ok, _ := c.Get(ctx, "auth:id2"); ok {
+		t.Fatalf("auth:id2 should not be written")
+	}
+
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v), want (true,nil)", ok, err)
+	}
+	if got, _, _ := c.Get(ctx, "auth:id1"); got != "verified" {
+		t.Fatalf("auth:id1 = %q, want verified", got)
+	}
+	if _, ok, _ := c.Get(ctx, "nonce:ab"); ok {
+		t.Fatalf("nonce should be consumed")
+	}
+
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || ok {
+		t.Fatalf("second TakeAndSetEx() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestShardIndexNonceFastPath(t *testing.T) {
+	cases := map[string]int{
+		"nonce:ab12":            0xab,
+		"prod:nonce:ab12":       0xab,
+		"prod:staging:nonce:0F": 0x0f,
+	}
+	for key, want := range cases {
+		if got := shardIndex(key); got != want {
+			t.Fatalf("shardIndex(%q) = %d, want %d", key, got, want)
+		}
+	}
+	// "nonce:"가 세그먼트 경계에 있지 않으면 해시 경로를 사용
+	if got := shardIndex("xnonce:ab"); got < 0 || got >= shardCount {
+		t.Fatalf("shardIndex fallback out of range: %d", got)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	ttl, ok, err := c.TTL(ctx, "auth:a")
+	if err != nil || !ok {
+		t.Fatalf("TTL() = (ok=%t, err=%v), want (true, nil)", ok, err)
+	}
+	if ttl <= 58*time.Second || ttl > 60*time.Second {
+		t.Fatalf("TTL() = %s, want about 60s", ttl)
+	}
+	if _, ok, err := c.TTL(ctx, "auth:missing"); err != nil || ok {
+		t.Fatalf("TTL() missing = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := c.Subscribe(ctx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := c.Publish(ctx, "auth:a", "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "verified" {
+			t.Fatalf("message = %q, want verified", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscriber did not receive message")
+	}
+	cancel()
+	for range messages {
+	}
+}
+
+func TestSweepRemovesExpiredEntries(t *testing.T) {
+	// 시계를 바꾸는 동안 백그라운드 정리가 돌지 않도록 주기를 길게 둠
+	c, err := NewWithOptions(Options{SweepInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		ttl := 10
+		if i%2 == 0 {
+			ttl = 1
+		}
+		if err := c.SetEx(ctx, fmt.Sprintf("auth:%d", i), "pending", ttl); err != nil {
+			t.Fatalf("SetEx() error = %v", err)
+		}
+	}
+	now = now.Add(2 * time.Second)
+	c.sweep()
+
+	if stats := c.Stats(); stats.Entries != 50 || stats.Expired != 50 {
+		t.Fatalf("Stats() after sweep = %+v, want 50 entries and 50 expired", stats)
+	}
+	if _, ok, _ := c.Get(ctx, "auth:1"); !ok {
+		t.Fatalf("live entry should survive the sweep")
+	}
+}
+
+func TestCapacityEvictsSoonestExpiring(t *testing.T) {
+	c, err := NewWithOptions(Options{MaxEntries: shardCount})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	// 같은 샤드("nonce:00..")에 두 개를 쓰면 샤드 용량(1)을 넘음
+	if err := c.SetEx(ctx, "nonce:00aa", "short", 10); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "nonce:00bb", "long", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if _, ok, _ := c.Get(ctx, "nonce:00aa"); ok {
+		t.Fatalf("soonest-expiring entry should be evicted")
+	}
+	if got, ok, _ := c.Get(ctx, "nonce:00bb"); !ok || got != "long" {
+		t.Fatalf("new entry = (%q,%t), want (long,true)", got, ok)
+	}
+	// 기존 키 갱신은 내보내기를 일으키지 않음
+	if err := c.SetEx(ctx, "nonce:00bb", "updated", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if stats := c.Stats(); stats.Evicted != 1 || stats.Entries != 1 {
+		t.Fatalf("Stats() = %+v, want one eviction and one entry", stats)
+	}
+
+	if _, err := NewWithOptions(Options{MaxEntries: -1}); err == nil {
+		t.Fatalf("NewWithOptions() should reject negative MaxEntries")
+	}
+}
+
+func TestTakeAndSetExAcrossShardsIsLinearizable(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	const sessions = 256
+	for i := 0; i < sessions; i++ {
+		if err := c.SetEx(ctx, fmt.Sprintf("nonce:%02x%02x", i, i), fmt.Sprintf("id%d", i), 60); err != nil {
+			t.Fatalf("SetEx() error = %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var successCount int32
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < sessions; i++ {
+				ok, err := c.TakeAndSetEx(ctx, fmt.Sprintf("nonce:%02x%02x", i, i), fmt.Sprintf("id%d", i), fmt.Sprintf("auth:id%d", i), "verified", 30)
+				if err != nil {
+					t.Errorf("TakeAndSetEx() error = %v", err)
+					return
+				}
+				if ok {
+					atomic.AddInt32(&successCount, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&successCount); got != sessions {
+		t.Fatalf("successful TakeAndSetEx count = %d, want %d", got, sessions)
+	}
+	for i := 0; i < sessions; i++ {
+		if got, ok, _ := c.Get(ctx, fmt.Sprintf("auth:id%d", i)); !ok || got != "verified" {
+			t.Fatalf("auth:id%d = (%q,%t), want (verified,true)", i, got, ok)
+		}
+	}
+}
+
+// 오래 남는 묘비로 가득 차도 EvictFirst 접두사의 키를 먼저 내보내 진행 중인 세션을 지켜야 함
+func TestCapacityEvictsEvictFirstKeysBeforeSessions(t *testing.T) {
+	c, err := NewWithOptions(Options{MaxEntries: shardCount * 4, EvictFirst: []string{"tomb:"}})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	for i := range shardCount * 8 {
+		if err := c.SetEx(ctx, fmt.Sprintf("tomb:%032x", i), "1", 1800); err != nil {
+			t.Fatalf("SetEx(tomb) error = %v", err)
+		}
+	}
+	const sessions = shardCount / 4
+	for i := range sessions {
+		if err := c.SetEx(ctx, fmt.Sprintf("auth:%032x", i), "pending", 600); err != nil {
+			t.Fatalf("SetEx(auth) error = %v", err)
+		}
+	}
+	for i := range sessions {
+		if _, ok, _ := c.Get(ctx, fmt.Sprintf("auth:%032x", i)); !ok {
+			t.Fatalf("pending session %d was evicted", i)
+		}
+	}
+	if stats := c.Stats(); stats.Entries > shardCount*4 {
+		t.Fatalf("Stats() = %+v, want at most %d entries", stats, shardCount*4)
+	}
+}
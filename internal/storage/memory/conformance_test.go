@@ -0,0 +1,23 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (storage.Store, func(time.Duration)) {
+		// 시계를 바꾸는 동안 백그라운드 정리가 돌지 않도록 주기를 길게 둠
+		c, err := NewWithOptions(Options{SweepInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("NewWithOptions() error = %v", err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		var offset time.Duration
+		c.now = func() time.Time { return time.Now().Add(offset) }
+		return c, func(d time.Duration) { offset += d }
+	})
+}
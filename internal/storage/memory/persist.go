@@ -0,0 +1,347 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSnapshotInterval = time.Minute
+	// aofSyncInterval은 AOFSyncAlways가 아닐 때 AOF를 디스크에 fsync하는 주기
+	aofSyncInterval = time.Second
+)
+
+// record는 스냅샷 파일과 AOF(append-only log)의 한 줄
+// 스냅샷에서는 키 항목의 Op가 비어 있고, AOF에서는 "set" 또는 "del"
+// ExpiresAt은 unix 초이며, 만료가 늦어지는 쪽으로 올림해 기록
+// 대기열 항목은 Op "schedule"/"unschedule"로 Key에 queue, Value에 member, Due에 처리 시각(unix 밀리초)을 기록
+type record struct {
+	Op        string `json:"op,omitempty"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Due       int64  `json:"due,omitempty"`
+}
+
+const (
+	opSet        = "set"
+	opDelete     = "del"
+	opSchedule   = "schedule"
+	opUnschedule = "unschedule"
+)
+
+// persistence는 주기적 스냅샷과 스냅샷 사이의 변경 로그를 관리
+//
+// 변경 작업은 mu를 읽기 잠금으로 잡고 캐시 반영과 AOF 기록을 함께 수행하며,
+// 스냅샷은 mu를 쓰기 잠금으로 잡아 스냅샷과 AOF 사이에 누락되는 변경이 없도록 함
+//
+// 내구성: AOF는 줄마다 write하므로 프로세스가 죽어도 기록이 남고, 운영체제나 전원 장애에는
+// syncAlways면 응답한 모든 변경이, 아니면 마지막 aofSyncInterval 동안의 변경을 제외한 기록이 남음
+// AOF 기록이 실패하면 writeErr에 남겨 Ping이 실패하며, 메모리 전체를 다시 쓰는 다음 스냅샷이 성공하면 해소됨
+type persistence struct {
+	path       string
+	syncAlways bool
+
+	mu          sync.RWMutex
+	aofMu       sync.Mutex
+	aof         *os.File
+	dirty       bool
+	writeErr    error
+	writeErrors atomic.Uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func aofPath(snapshotPath string) string {
+	return snapshotPath + ".aof"
+}
+
+func (c *Client) startPersistence(opts Options) error {
+	now := time.Now().Unix()
+	if _, err := replayFile(opts.SnapshotPath, now, c.restoreRecord); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+	replayed, err := replayFile(aofPath(opts.SnapshotPath), now, c.restoreRecord)
+	if err != nil {
+		return fmt.Errorf("replay append-only log: %w", err)
+	}
+	aof, err := os.OpenFile(aofPath(opts.SnapshotPath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	// 잘린 줄 뒤에 이어 쓰면 다음 재생이 그 줄에서 멈춰 이후 기록을 잃으므로 마지막으로 읽은 줄 끝까지 자름
+	if err := aof.Truncate(replayed); err != nil {
+		_ = aof.Close()
+		return fmt.Errorf("truncate append-only log: %w", err)
+	}
+
+	interval := opts.SnapshotInterval
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	c.persist = &persistence{
+		path:       opts.SnapshotPath,
+		syncAlways: opts.AOFSyncAlways,
+		aof:        aof,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go c.snapshotLoop(interval)
+	return nil
+}
+
+// replayFile은 파일의 레코드를 순서대로 적용하며, 만료된 set 레코드는 건너뜀
+// 비정상 종료로 마지막 줄이 잘렸을 수 있으므로 개행으로 끝나지 않는 마지막 줄은 무시하고,
+// 개행까지 기록된 줄을 해석할 수 없으면 뒤의 기록을 버리지 않도록 오류를 반환
+// 반환값은 적용한 마지막 줄까지의 바이트 수
+func replayFile(path string, now int64, apply func(record) error) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// 파일 끝이거나 잘린 마지막 줄
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return offset, fmt.Errorf("corrupt record at byte %d of %s: %w", offset, path, err)
+		}
+		offset += int64(len(line))
+		if (rec.Op == "" || rec.Op == opSet) && now >= rec.ExpiresAt {
+			continue
+		}
+		if err := apply(rec); err != nil {
+			return offset, err
+		}
+	}
+}
+
+func (c *Client) restoreRecord(rec record) error {
+	switch rec.Op {
+	case opSchedule, opUnschedule:
+		c.queues.mu.Lock()
+		defer c.queues.mu.Unlock()
+		if rec.Op == opSchedule {
+			c.schedule(rec.Key, rec.Value, rec.Due)
+		} else {
+			c.unschedule(rec.Key, rec.Value)
+		}
+		return nil
+	}
+	s := c.shardFor(rec.Key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.Op == opDelete {
+		if it, ok := s.items[rec.Key]; ok {
+			s.remove(it)
+		}
+		return nil
+	}
+	c.set(s, rec.Key, rec.Value, time.Unix(rec.ExpiresAt, 0).UnixNano())
+	return nil
+}
+
+// beginWrite는 변경 작업 동안 스냅샷이 끼어들지 않도록 잠그고, 해제 함수를 반환
+func (c *Client) beginWrite() func() {
+	if c.persist == nil {
+		return func() {}
+	}
+	c.persist.mu.RLock()
+	return c.persist.mu.RUnlock
+}
+
+func (c *Client) logSet(key, value string, expiresAt int64) {
+	if c.persist == nil {
+		return
+	}
+	c.appendRecord(record{Op: opSet, Key: key, Value: value, ExpiresAt: unixSecondsCeil(expiresAt)})
+}
+
+func unixSecondsCeil(unixNano int64) int64 {
+	return (unixNano + int64(time.Second) - 1) / int64(time.Second)
+}
+
+func (c *Client) logDelete(key string) {
+	c.appendRecord(record{Op: opDelete, Key: key})
+}
+
+func (c *Client) appendRecord(rec record) {
+	if c.persist == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	p := c.persist
+	p.aofMu.Lock()
+	defer p.aofMu.Unlock()
+	// 한 줄을 한 번의 write로 기록해 다른 고루틴의 기록과 섞이지 않도록 함
+	_, err = p.aof.Write(line)
+	if err == nil && p.syncAlways {
+		err = p.aof.Sync()
+	}
+	if err != nil {
+		p.writeErrors.Add(1)
+		p.writeErr = err
+		return
+	}
+	p.dirty = !p.syncAlways
+}
+
+// syncAOF는 마지막 fsync 뒤에 추가된 AOF 기록을 디스크에 내림
+func (p *persistence) syncAOF() {
+	p.aofMu.Lock()
+	defer p.aofMu.Unlock()
+	if !p.dirty {
+		return
+	}
+	if err := p.aof.Sync(); err != nil {
+		p.writeErrors.Add(1)
+		p.writeErr = err
+		return
+	}
+	p.dirty = false
+}
+
+// failure는 다음 스냅샷 전까지 복원되지 않을 변경이 있으면 마지막 AOF 오류를 반환
+func (p *persistence) failure() error {
+	p.aofMu.Lock()
+	defer p.aofMu.Unlock()
+	if p.writeErr != nil {
+		return fmt.Errorf("append-only log: %w", p.writeErr)
+	}
+	return nil
+}
+
+// Snapshot은 만료되지 않은 모든 항목을 임시 파일에 쓴 뒤 rename으로 교체하고 AOF를 비움
+func (c *Client) Snapshot() error {
+	p := c.persist
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tmp := p.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range c.shards {
+		if err = c.snapshotShard(&c.shards[i], enc); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = c.snapshotQueues(enc)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return err
+	}
+
+	// 스냅샷에 모두 반영되었으므로 AOF를 비움
+	// rename 직후 중단되어 AOF가 남아도, 재생 시 같은 결과가 되므로 안전
+	p.aofMu.Lock()
+	defer p.aofMu.Unlock()
+	if err := p.aof.Truncate(0); err != nil {
+		return err
+	}
+	p.dirty = false
+	p.writeErr = nil
+	return nil
+}
+
+// snapshotShard는 샤드의 만료되지 않은 항목을 복사한 뒤 잠금을 풀고 기록
+func (c *Client) snapshotShard(s *shard, enc *json.Encoder) error {
+	s.mu.Lock()
+	now := c.now().UnixNano()
+	records := make([]record, 0, len(s.items))
+	for key, it := range s.items {
+		if now >= it.expiresAt {
+			continue
+		}
+		records = append(records, record{Key: key, Value: it.value, ExpiresAt: unixSecondsCeil(it.expiresAt)})
+	}
+	s.mu.Unlock()
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) snapshotLoop(interval time.Duration) {
+	defer close(c.persist.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	syncTicker := time.NewTicker(aofSyncInterval)
+	defer syncTicker.Stop()
+	for {
+		select {
+		case <-c.persist.stop:
+			return
+		case <-ticker.C:
+			_ = c.Snapshot()
+		case <-syncTicker.C:
+			c.persist.syncAOF()
+		}
+	}
+}
+
+func (c *Client) closePersistence() error {
+	p := c.persist
+	if p == nil {
+		return nil
+	}
+	var err error
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.syncAOF()
+		err = c.Snapshot()
+		if closeErr := p.aof.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
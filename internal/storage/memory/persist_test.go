@@ -0,0 +1,258 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestoresOnRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	ctx := context.Background()
+
+	c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "nonce:ab", "a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if info, err := os.Stat(aofPath(path)); err != nil || info.Size() != 0 {
+		t.Fatalf("append-only log should be empty after final snapshot: info=%v err=%v", info, err)
+	}
+
+	restored, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() restore error = %v", err)
+	}
+	defer restored.Close()
+	if got, ok, _ := restored.Get(ctx, "auth:a"); !ok || got != "pending" {
+		t.Fatalf("auth:a after restore = (%q,%t)", got, ok)
+	}
+	if got, ok, _ := restored.Get(ctx, "nonce:ab"); !ok || got != "a" {
+		t.Fatalf("nonce:ab after restore = (%q,%t)", got, ok)
+	}
+}
+
+func TestAppendOnlyLogReplaysChangesSinceSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	ctx := context.Background()
+
+	c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "nonce:ab", "a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "nonce:cd", "b", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if _, err := c.TakeAndSetEx(ctx, "nonce:ab", "a", "auth:a", "verified", 30); err != nil {
+		t.Fatalf("TakeAndSetEx() error = %v", err)
+	}
+
+	// Close 없이 재시작한 상황(비정상 종료): 스냅샷 + AOF로 복원
+	restored, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() restore error = %v", err)
+	}
+	defer restored.Close()
+	defer c.Close()
+
+	if _, ok, _ := restored.Get(ctx, "nonce:ab"); ok {
+		t.Fatalf("consumed nonce should stay deleted after replay")
+	}
+	if got, ok, _ := restored.Get(ctx, "auth:a"); !ok || got != "verified" {
+		t.Fatalf("auth:a after replay = (%q,%t)", got, ok)
+	}
+	if got, ok, _ := restored.Get(ctx, "nonce:cd"); !ok || got != "b" {
+		t.Fatalf("nonce:cd after replay = (%q,%t)", got, ok)
+	}
+}
+
+func TestRestoreSkipsExpiredAndTruncatedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	now := time.Now()
+
+	var snapshot []byte
+	for _, rec := range []record{
+		{Key: "live", Value: "v", ExpiresAt: now.Add(time.Minute).Unix()},
+		{Key: "expired", Value: "v", ExpiresAt: now.Add(-time.Minute).Unix()},
+	} {
+		line, _ := json.Marshal(rec)
+		snapshot = append(append(snapshot, line...), '\n')
+	}
+	if err := os.WriteFile(path, snapshot, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	// 마지막 줄이 잘린 AOF
+	if err := os.WriteFile(aofPath(path), []byte(`{"op":"del","key":"live"`), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	if _, ok, _ := c.Get(ctx, "live"); !ok {
+		t.Fatalf("live entry should be restored (truncated del must be ignored)")
+	}
+	if _, ok, _ := c.Get(ctx, "expired"); ok {
+		t.Fatalf("expired entry should be skipped on restore")
+	}
+}
+
+func TestTornAppendOnlyLogSurvivesRepeatedRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	ctx := context.Background()
+	before, _ := json.Marshal(record{Op: opSet, Key: "before", Value: "v", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	// 마지막 줄이 잘린 AOF
+	if err := os.WriteFile(aofPath(path), append(append(before, '\n'), `{"op":"set","key":"torn"`...), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	// 첫 재시작 뒤의 기록이 잘린 줄 뒤에 붙으면 다음 재시작에서 사라짐
+	first, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer first.Close()
+	if err := first.SetEx(ctx, "after", "v", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	// Close 없이 두 번 재시작한 상황
+	second, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() second restart error = %v", err)
+	}
+	defer second.Close()
+	third, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() third restart error = %v", err)
+	}
+	defer third.Close()
+
+	for _, c := range []*Client{second, third} {
+		for _, key := range []string{"before", "after"} {
+			if _, ok, _ := c.Get(ctx, key); !ok {
+				t.Fatalf("%s should survive restarts after a torn tail", key)
+			}
+		}
+		if _, ok, _ := c.Get(ctx, "torn"); ok {
+			t.Fatalf("torn record should not be restored")
+		}
+	}
+}
+
+func TestCorruptAppendOnlyLogFailsWithoutDroppingRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	after, _ := json.Marshal(record{Op: opSet, Key: "after", Value: "v", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	// 잘린 마지막 줄이 아니라 중간 줄이 깨진 AOF
+	aof := append([]byte("not-json\n"), append(after, '\n')...)
+	if err := os.WriteFile(aofPath(path), aof, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour}); err == nil {
+		_ = c.Close()
+		t.Fatal("NewWithOptions() with a corrupt record in the middle of the log should fail")
+	}
+	if got, err := os.ReadFile(aofPath(path)); err != nil || string(got) != string(aof) {
+		t.Fatalf("append-only log after a failed restore = (%q, %v), want it untouched", got, err)
+	}
+}
+
+func TestAppendOnlyLogWriteErrorsFailPingUntilSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	ctx := context.Background()
+	c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour, AOFSyncAlways: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+
+	// 쓸 수 없는 파일로 바꿔 AOF 기록을 실패시킴
+	writable := c.persist.aof
+	readOnly, err := os.Open(aofPath(path))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	c.persist.aof = readOnly
+	if err := c.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.Ping(ctx); err == nil {
+		t.Fatal("Ping() after a failed AOF write error = nil")
+	}
+	if got := c.Stats().AOFWriteErrors; got != 1 {
+		t.Fatalf("AOFWriteErrors = %d, want 1", got)
+	}
+
+	// 스냅샷이 메모리 전체를 기록하면 잃을 변경이 없으므로 다시 정상
+	c.persist.aof = writable
+	_ = readOnly.Close()
+	if err := c.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() after snapshot error = %v", err)
+	}
+}
+
+func TestQueuesSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.snapshot")
+	ctx := context.Background()
+	now := time.Now()
+
+	c, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	for _, member := range []string{"a", "b", "c"} {
+		if err := c.Schedule(ctx, "webhook:due", member, now); err != nil {
+			t.Fatalf("Schedule() error = %v", err)
+		}
+	}
+	if err := c.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	// 스냅샷 뒤의 변경은 AOF로 복원
+	if err := c.Unschedule(ctx, "webhook:due", "a"); err != nil {
+		t.Fatalf("Unschedule() error = %v", err)
+	}
+	if err := c.Schedule(ctx, "webhook:due", "b", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	// Close 없이 재시작한 상황: 스냅샷 + AOF로 복원
+	restored, err := NewWithOptions(Options{SnapshotPath: path, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithOptions() restore error = %v", err)
+	}
+	defer restored.Close()
+	defer c.Close()
+
+	if members, err := restored.ClaimDue(ctx, "webhook:due", now, time.Minute, 10); err != nil || len(members) != 1 || members[0] != "c" {
+		t.Fatalf("ClaimDue() after restore = (%v, %v), want [c]", members, err)
+	}
+	if members, _ := restored.ClaimDue(ctx, "webhook:due", now.Add(2*time.Hour), time.Minute, 10); len(members) != 2 {
+		t.Fatalf("ClaimDue() later = %v, want b and c", members)
+	}
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// queueSet은 Schedule/ClaimDue로 쓰는 처리 대기열(queue별 member → 처리 시각(unix 밀리초))
+// 키 항목과 달리 만료되지 않고 MaxEntries에도 포함되지 않음
+type queueSet struct {
+	mu     sync.Mutex
+	queues map[string]map[string]int64
+}
+
+func (c *Client) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer c.beginWrite()()
+	c.queues.mu.Lock()
+	defer c.queues.mu.Unlock()
+	c.schedule(queue, member, at.UnixMilli())
+	return nil
+}
+
+// ClaimDue는 queue의 모든 항목을 훑으므로 항목 수에 비례하는 시간이 걸림
+func (c *Client) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+	defer c.beginWrite()()
+	c.queues.mu.Lock()
+	defer c.queues.mu.Unlock()
+
+	type due struct {
+		member string
+		at     int64
+	}
+	cutoff := now.UnixMilli()
+	var ready []due
+	for member, at := range c.queues.queues[queue] {
+		if at <= cutoff {
+			ready = append(ready, due{member: member, at: at})
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].at != ready[j].at {
+			return ready[i].at < ready[j].at
+		}
+		return ready[i].member < ready[j].member
+	})
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+	next := now.Add(lease).UnixMilli()
+	members := make([]string, len(ready))
+	for i, d := range ready {
+		members[i] = d.member
+		c.schedule(queue, d.member, next)
+	}
+	return members, nil
+}
+
+func (c *Client) Unschedule(ctx context.Context, queue, member string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer c.beginWrite()()
+	c.queues.mu.Lock()
+	defer c.queues.mu.Unlock()
+	c.unschedule(queue, member)
+	return nil
+}
+
+// schedule은 항목을 기록하고 AOF에 남김(c.queues.mu 잠금 필요)
+func (c *Client) schedule(queue, member string, at int64) {
+	members, ok := c.queues.queues[queue]
+	if !ok {
+		members = map[string]int64{}
+		c.queues.queues[queue] = members
+	}
+	members[member] = at
+	c.appendRecord(record{Op: opSchedule, Key: queue, Value: member, Due: at})
+}
+
+// unschedule은 항목을 지우고 AOF에 남김(c.queues.mu 잠금 필요)
+func (c *Client) unschedule(queue, member string) {
+	members, ok := c.queues.queues[queue]
+	if !ok {
+		return
+	}
+	if _, ok := members[member]; !ok {
+		return
+	}
+	delete(members, member)
+	if len(members) == 0 {
+		delete(c.queues.queues, queue)
+	}
+	c.appendRecord(record{Op: opUnschedule, Key: queue, Value: member})
+}
+
+// snapshotQueues는 모든 대기열 항목을 복사한 뒤 잠금을 풀고 기록
+func (c *Client) snapshotQueues(enc *json.Encoder) error {
+	c.queues.mu.Lock()
+	var records []record
+	for queue, members := range c.queues.queues {
+		for member, at := range members {
+			records = append(records, record{Op: opSchedule, Key: queue, Value: member, Due: at})
+		}
+	}
+	c.queues.mu.Unlock()
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
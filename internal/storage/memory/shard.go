@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"container/heap"
+	"sync"
+)
+
+type item struct {
+	key       string
+	value     string
+	expiresAt int64 // unix nano
+	index     int   // expiryHeap 안의 위치
+	spare     bool  // spare 힙에 있는지 여부
+}
+
+// shard는 키 맵과 만료 시각 순서의 최소 힙을 함께 관리(mu로 보호)
+// EvictFirst 접두사의 키는 spare 힙에 따로 두어 가득 찼을 때 먼저 내보냄
+type shard struct {
+	mu    sync.Mutex
+	items map[string]*item
+	heap  expiryHeap
+	spare expiryHeap
+}
+
+func (s *shard) heapOf(it *item) *expiryHeap {
+	if it.spare {
+		return &s.spare
+	}
+	return &s.heap
+}
+
+// put은 새 항목을 넣거나 기존 항목의 값과 만료 시각을 갱신
+func (s *shard) put(key, value string, expiresAt int64, spare bool) {
+	if it, ok := s.items[key]; ok {
+		it.value = value
+		it.expiresAt = expiresAt
+		heap.Fix(s.heapOf(it), it.index)
+		return
+	}
+	it := &item{key: key, value: value, expiresAt: expiresAt, spare: spare}
+	s.items[key] = it
+	heap.Push(s.heapOf(it), it)
+}
+
+func (s *shard) remove(it *item) {
+	heap.Remove(s.heapOf(it), it.index)
+	delete(s.items, it.key)
+}
+
+// soonest는 가장 먼저 만료될 항목을 반환하며, 비어 있으면 nil
+func (s *shard) soonest() *item {
+	switch {
+	case len(s.spare) == 0 && len(s.heap) == 0:
+		return nil
+	case len(s.spare) == 0:
+		return s.heap[0]
+	case len(s.heap) == 0 || s.spare[0].expiresAt < s.heap[0].expiresAt:
+		return s.spare[0]
+	}
+	return s.heap[0]
+}
+
+// victim은 가득 찼을 때 내보낼 항목. spare 힙에서 가장 먼저 만료될 항목, 없으면 전체에서 가장 먼저 만료될 항목
+func (s *shard) victim() *item {
+	if len(s.spare) > 0 {
+		return s.spare[0]
+	}
+	return s.soonest()
+}
+
+type expiryHeap []*item
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt < h[j].expiresAt }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	it.index = -1
+	return it
+}
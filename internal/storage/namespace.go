@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Namespaced는 모든 키 앞에 "<namespace>:"를 붙이는 Store를 반환
+// 여러 배포(스테이징/프로덕션, 제품군)가 같은 Redis DB를 공유해도 키가 충돌하지 않도록 함
+// namespace가 비어 있으면 store를 그대로 반환
+func Namespaced(store Store, namespace string) Store {
+	if namespace == "" {
+		return store
+	}
+	return &namespacedStore{store: store, prefix: NamespacedKey(namespace, "")}
+}
+
+// NamespacedKey는 Namespaced(store, namespace)에 쓴 key가 store에 저장되는 키
+func NamespacedKey(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + ":" + key
+}
+
+type namespacedStore struct {
+	store  Store
+	prefix string
+}
+
+func (n *namespacedStore) Ping(ctx context.Context) error {
+	return n.store.Ping(ctx)
+}
+
+func (n *namespacedStore) Get(ctx context.Context, key string) (string, bool, error) {
+	return n.store.Get(ctx, n.prefix+key)
+}
+
+func (n *namespacedStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	return n.store.TTL(ctx, n.prefix+key)
+}
+
+func (n *namespacedStore) Take(ctx context.Context, key string) (string, bool, error) {
+	return n.store.Take(ctx, n.prefix+key)
+}
+
+func (n *namespacedStore) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	return n.store.SetEx(ctx, n.prefix+key, value, ttlSeconds)
+}
+
+func (n *namespacedStore) MSetEx(ctx context.Context, entries ...Entry) error {
+	prefixed := make([]Entry, len(entries))
+	for i, e := range entries {
+		prefixed[i] = Entry{Key: n.prefix + e.Key, Value: e.Value, TTLSeconds: e.TTLSeconds}
+	}
+	return n.store.MSetEx(ctx, prefixed...)
+}
+
+func (n *namespacedStore) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	return n.store.AddEx(ctx, n.prefix+key, value, ttlSeconds)
+}
+
+func (n *namespacedStore) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	return n.store.IncrEx(ctx, n.prefix+key, delta, ttlSeconds)
+}
+
+func (n *namespacedStore) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	return n.store.SlidingIncrEx(ctx, n.prefix+key, n.prefix+prev, prevWeight, limit, ttlSeconds)
+}
+
+func (n *namespacedStore) Publish(ctx context.Context, channel, message string) error {
+	return n.store.Publish(ctx, n.prefix+channel, message)
+}
+
+func (n *namespacedStore) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	return n.store.Subscribe(ctx, n.prefix+channel)
+}
+
+func (n *namespacedStore) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	return n.store.Schedule(ctx, n.prefix+queue, member, at)
+}
+
+func (n *namespacedStore) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	return n.store.ClaimDue(ctx, n.prefix+queue, now, lease, limit)
+}
+
+func (n *namespacedStore) Unschedule(ctx context.Context, queue, member string) error {
+	return n.store.Unschedule(ctx, n.prefix+queue, member)
+}
+
+func (n *namespacedStore) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	return n.store.TakeAndSetEx(ctx, n.prefix+key, expected, n.prefix+target, value, ttlSeconds)
+}
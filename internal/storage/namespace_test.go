@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mapStore map[string]string
+
+func (m mapStore) Ping(context.Context) error { return nil }
+
+func (m mapStore) Get(_ context.Context, key string) (string, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+// mapStore는 TTL을 저장하지 않으므로 키가 있으면 항상 1분을 반환
+func (m mapStore) TTL(_ context.Context, key string) (time.Duration, bool, error) {
+	if _, ok := m[key]; !ok {
+		return 0, false, nil
+	}
+	return time.Minute, true, nil
+}
+
+func (m mapStore) Take(_ context.Context, key string) (string, bool, error) {
+	v, ok := m[key]
+	delete(m, key)
+	return v, ok, nil
+}
+
+func (m mapStore) SetEx(_ context.Context, key, value string, _ int) error {
+	m[key] = value
+	return nil
+}
+
+func (m mapStore) MSetEx(_ context.Context, entries ...Entry) error {
+	for _, e := range entries {
+		m[e.Key] = e.Value
+	}
+	return nil
+}
+
+func (m mapStore) AddEx(_ context.Context, key, value string, _ int) (bool, error) {
+	if _, ok := m[key]; ok {
+		return false, nil
+	}
+	m[key] = value
+	return true, nil
+}
+
+func (m mapStore) IncrEx(_ context.Context, key string, delta int64, _ int) (int64, error) {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	n += delta
+	m[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (m mapStore) SlidingIncrEx(_ context.Context, key, prev string, prevWeight float64, limit int64, _ int) (int64, int64, bool, error) {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	p, _ := strconv.ParseInt(m[prev], 10, 64)
+	if float64(n+1)+float64(p)*prevWeight > float64(limit) {
+		return n, p, false, nil
+	}
+	m[key] = strconv.FormatInt(n+1, 10)
+	return n + 1, p, true, nil
+}
+
+func (m mapStore) TakeAndSetEx(_ context.Context, key, expected, target, value string, _ int) (bool, error) {
+	if v, ok := m[key]; !ok || v != expected {
+		return false, nil
+	}
+	delete(m, key)
+	m[target] = value
+	return true, nil
+}
+
+// mapStore는 대기열 항목을 "<queue> <member>" 키에 처리 시각(unix 밀리초)으로 저장
+func (m mapStore) Schedule(_ context.Context, queue, member string, at time.Time) error {
+	m[queue+" "+member] = strconv.FormatInt(at.UnixMilli(), 10)
+	return nil
+}
+
+func (m mapStore) ClaimDue(_ context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	var members []string
+	for key, value := range m {
+		member, ok := strings.CutPrefix(key, queue+" ")
+		if !ok || len(members) >= limit {
+			continue
+		}
+		if at, _ := strconv.ParseInt(value, 10, 64); at <= now.UnixMilli() {
+			members = append(members, member)
+			m[key] = strconv.FormatInt(now.Add(lease).UnixMilli(), 10)
+		}
+	}
+	return members, nil
+}
+
+func (m mapStore) Unschedule(_ context.Context, queue, member string) error {
+	delete(m, queue+" "+member)
+	return nil
+}
+
+func (m mapStore) Publish(context.Context, string, string) error { return nil }
+
+func (m mapStore) Subscribe(ctx context.Context, _ string) (<-chan string, error) {
+	ch := make(chan string)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func TestNamespacedPrefixesEveryKey(t *testing.T) {
+	backend := mapStore{}
+	prod := Namespaced(backend, "prod")
+	staging := Namespaced(backend, "staging")
+	ctx := context.Background()
+
+	if err := prod.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := staging.SetEx(ctx, "nonce:ab", "id2", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if backend["prod:nonce:ab"] != "id1" || backend["staging:nonce:ab"] != "id2" {
+		t.Fatalf("unexpected backend keys: %#v", backend)
+	}
+
+	if err := prod.MSetEx(ctx, Entry{Key: "auth:id0", Value: "pending", TTLSeconds: 60}, Entry{Key: "nonce:cd", Value: "id0", TTLSeconds: 60}); err != nil {
+		t.Fatalf("MSetEx() error = %v", err)
+	}
+	if backend["prod:auth:id0"] != "pending" || backend["prod:nonce:cd"] != "id0" {
+		t.Fatalf("MSetEx keys should be namespaced: %#v", backend)
+	}
+
+	if ok, err := prod.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 60); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v)", ok, err)
+	}
+	if backend["prod:auth:id1"] != "verified" {
+		t.Fatalf("target key should be namespaced: %#v", backend)
+	}
+	if got, ok, _ := staging.Take(ctx, "nonce:ab"); !ok || got != "id2" {
+		t.Fatalf("staging nonce should be untouched, got (%q,%t)", got, ok)
+	}
+	if got, ok, _ := prod.Get(ctx, "auth:id1"); !ok || got != "verified" {
+		t.Fatalf("Get() through namespace = (%q,%t)", got, ok)
+	}
+	if err := prod.Schedule(ctx, "webhook:due", "d1", time.Now()); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if _, ok := backend["prod:webhook:due d1"]; !ok {
+		t.Fatalf("queue should be namespaced: %#v", backend)
+	}
+	if members, _ := staging.ClaimDue(ctx, "webhook:due", time.Now(), time.Minute, 10); len(members) != 0 {
+		t.Fatalf("staging should not see prod queue, got %v", members)
+	}
+	if members, _ := prod.ClaimDue(ctx, "webhook:due", time.Now(), time.Minute, 10); len(members) != 1 || members[0] != "d1" {
+		t.Fatalf("ClaimDue() through namespace = %v", members)
+	}
+	for key := range backend {
+		if !strings.HasPrefix(key, "prod:") && !strings.HasPrefix(key, "staging:") {
+			t.Fatalf("key %q escaped its namespace", key)
+		}
+	}
+}
+
+func TestNamespacedEmptyReturnsStore(t *testing.T) {
+	backend := mapStore{}
+	if got := Namespaced(backend, ""); got == nil {
+		t.Fatalf("Namespaced() returned nil")
+	} else if _, wrapped := got.(*namespacedStore); wrapped {
+		t.Fatalf("empty namespace should not wrap the store")
+	}
+}
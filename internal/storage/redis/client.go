@@ -2,32 +2,257 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	goredis "github.com/redis/go-redis/v9"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/broker"
 )
 
 var ErrNil = goredis.Nil
 
+// takeAndSetScript는 KEYS[1]의 값이 ARGV[1]일 때만 KEYS[2]를 먼저 기록한 뒤 KEYS[1]을 지우므로, 기록이 실패하면 원본 키가 그대로 남음
+var takeAndSetScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2], 'EX', ARGV[3])
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// incrExScript는 증가와 최초 만료 설정을 한 번에 처리(이미 만료가 있으면 유지)
+var incrExScript = goredis.NewScript(`
+local n = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return n
+`)
+
+// slidingIncrExScript는 두 윈도 카운터를 읽고 비교해 한도 안일 때만 KEYS[1]을 더함(만료 처리는 incrExScript와 같음)
+// 반환: {KEYS[1] 값, KEYS[2] 값, 더했으면 1}
+var slidingIncrExScript = goredis.NewScript(`
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current + 1 + previous * tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return {current, previous, 0}
+end
+current = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('EXPIRE', KEYS[1], ARGV[3])
+end
+return {current, previous, 1}
+`)
+
+// claimDueScript는 처리 시각이 지난 항목을 골라 점수를 lease 뒤로 미루는 작업을 한 번에 처리
+// 점수는 unix 밀리초
+var claimDueScript = goredis.NewScript(`
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, m in ipairs(members) do
+	redis.call('ZADD', KEYS[1], ARGV[2], m)
+end
+return members
+`)
+
 type Client struct {
-	client *goredis.Client
+	client     goredis.UniversalClient
+	masterName string
+	sentinels  []sentinelNode
+	// hashTag는 Cluster 모드에서만 쓰는 Options.HashTag
+	hashTag func(key string) string
+
+	subMu      sync.Mutex
+	pubsub     *goredis.PubSub
+	pubsubDone chan struct{}
+	closed     bool
+	bus        *broker.Broker
+	channels   map[string]*channelSub
+	// pending은 채널별로 구독 확인을 기다리는 SUBSCRIBE의 순서(Redis는 보낸 순서대로 확인을 돌려줌)
+	pending map[string][]chan struct{}
+}
+
+type sentinelNode struct {
+	addr   string
+	client *goredis.SentinelClient
+}
+
+// Options는 Redis 토폴로지 설정
+//
+// - SentinelMaster가 있으면 SentinelAddrs를 통해 마스터를 찾는 Sentinel 모드
+// - ClusterAddrs가 있으면 시드 노드로 슬롯 정보를 받아오는 Cluster 모드(HashTag로 키의 슬롯을 정함)
+// - 둘 다 없으면 URL 단일 노드 모드
+//
+// Sentinel/Cluster 모드에서 URL은 선택 사항이며, 지정하면 인증 정보/DB/TLS 설정만 가져옴
+type Options struct {
+	URL              string
+	SentinelMaster   string
+	SentinelAddrs    []string
+	SentinelPassword string
+	ClusterAddrs     []string
+	// HashTag는 Cluster 모드에서 키 앞에 "{<태그>}"로 붙일 해시 태그이며, 빈 문자열이면 키 전체로 슬롯을 정함
+	// 한 번에 여러 키를 다루는 MSetEx, TakeAndSetEx, SlidingIncrEx의 키는 같은 태그여야 함(다르면 CROSSSLOT 오류)
+	HashTag func(key string) string
+}
+
+// NodeStatus는 Ping 시 개별 노드의 상태
+type NodeStatus struct {
+	Addr string
+	Role string
+	Err  error
 }
 
 func New(redisURL string) (*Client, error) {
-	opt, err := goredis.ParseURL(redisURL)
-	if err != nil {
-		return nil, err
+	return NewWithOptions(Options{URL: redisURL})
+}
+
+func NewWithOptions(opts Options) (*Client, error) {
+	sentinelMode := opts.SentinelMaster != ""
+	clusterMode := len(opts.ClusterAddrs) > 0
+	if sentinelMode && clusterMode {
+		return nil, errors.New("redis sentinel and cluster modes are mutually exclusive")
+	}
+	if sentinelMode && len(opts.SentinelAddrs) == 0 {
+		return nil, errors.New("redis sentinel master requires at least one sentinel address")
+	}
+	if !sentinelMode && !clusterMode && opts.URL == "" {
+		return nil, errors.New("redis url is required")
+	}
+
+	uopt := &goredis.UniversalOptions{}
+	if opts.URL != "" {
+		parsed, err := goredis.ParseURL(opts.URL)
+		if err != nil {
+			return nil, err
+		}
+		uopt.Addrs = []string{parsed.Addr}
+		uopt.Username = parsed.Username
+		uopt.Password = parsed.Password
+		uopt.DB = parsed.DB
+		uopt.TLSConfig = parsed.TLSConfig
+		uopt.Protocol = parsed.Protocol
+	}
+
+	switch {
+	case sentinelMode:
+		uopt.MasterName = opts.SentinelMaster
+		uopt.Addrs = opts.SentinelAddrs
+		uopt.SentinelPassword = opts.SentinelPassword
+	case clusterMode:
+		if uopt.DB != 0 {
+			return nil, fmt.Errorf("redis cluster does not support database %d", uopt.DB)
+		}
+		uopt.Addrs = opts.ClusterAddrs
+		uopt.IsClusterMode = true
+	}
+
+	c := &Client{
+		client:     goredis.NewUniversalClient(uopt),
+		masterName: opts.SentinelMaster,
+		bus:        broker.New(),
+		channels:   map[string]*channelSub{},
+		pending:    map[string][]chan struct{}{},
+	}
+	if clusterMode {
+		c.hashTag = opts.HashTag
+	}
+	if sentinelMode {
+		for _, addr := range opts.SentinelAddrs {
+			c.sentinels = append(c.sentinels, sentinelNode{
+				addr: addr,
+				client: goredis.NewSentinelClient(&goredis.Options{
+					Addr:      addr,
+					Password:  opts.SentinelPassword,
+					TLSConfig: uopt.TLSConfig,
+				}),
+			})
+		}
 	}
-	client := goredis.NewClient(opt)
-	return &Client{client: client}, nil
+	return c, nil
 }
 
+// Ping은 마스터(단일 노드, Sentinel 마스터, Cluster 샤드 마스터)가 응답하지 않거나
+// 응답하는 Sentinel이 과반이 안 되어 장애 조치를 할 수 없을 때만 실패
+// 레플리카나 일부 Sentinel의 장애는 실패로 보지 않으며 PingNodes로 확인
 func (c *Client) Ping(ctx context.Context) error {
-	return c.client.Ping(ctx).Err()
+	return nodesError(c.PingNodes(ctx))
+}
+
+func nodesError(nodes []NodeStatus) error {
+	var errs, sentinelErrs []error
+	sentinels := 0
+	for _, node := range nodes {
+		switch {
+		case node.Role == "sentinel":
+			sentinels++
+			if node.Err != nil {
+				sentinelErrs = append(sentinelErrs, fmt.Errorf("%s %s: %w", node.Role, node.Addr, node.Err))
+			}
+		case node.Role == "replica":
+		case node.Err != nil:
+			errs = append(errs, fmt.Errorf("%s %s: %w", node.Role, node.Addr, node.Err))
+		}
+	}
+	if reachable := sentinels - len(sentinelErrs); sentinels > 0 && reachable <= sentinels/2 {
+		errs = append(errs, fmt.Errorf("sentinel quorum lost (%d of %d reachable): %w", reachable, sentinels, errors.Join(sentinelErrs...)))
+	}
+	return errors.Join(errs...)
+}
+
+// PingNodes는 토폴로지의 각 노드(Cluster 샤드, Sentinel 마스터와 감시 노드)에 PING을 보낸 결과를 반환
+func (c *Client) PingNodes(ctx context.Context) []NodeStatus {
+	switch client := c.client.(type) {
+	case *goredis.ClusterClient:
+		return pingCluster(ctx, client)
+	case *goredis.Client:
+		if c.masterName == "" {
+			return []NodeStatus{{Addr: client.Options().Addr, Role: "node", Err: client.Ping(ctx).Err()}}
+		}
+		// FailoverClient는 마스터 주소를 내부에서 해석하므로 마스터 이름으로 표시
+		nodes := []NodeStatus{{Addr: c.masterName, Role: "master", Err: client.Ping(ctx).Err()}}
+		for _, sentinel := range c.sentinels {
+			nodes = append(nodes, NodeStatus{
+				Addr: sentinel.addr,
+				Role: "sentinel",
+				Err:  sentinel.client.Ping(ctx).Err(),
+			})
+		}
+		return nodes
+	default:
+		return []NodeStatus{{Addr: "redis", Role: "node", Err: c.client.Ping(ctx).Err()}}
+	}
+}
+
+func pingCluster(ctx context.Context, client *goredis.ClusterClient) []NodeStatus {
+	var mu sync.Mutex
+	var nodes []NodeStatus
+	record := func(role string) func(context.Context, *goredis.Client) error {
+		return func(ctx context.Context, shard *goredis.Client) error {
+			err := shard.Ping(ctx).Err()
+			mu.Lock()
+			nodes = append(nodes, NodeStatus{Addr: shard.Options().Addr, Role: role, Err: err})
+			mu.Unlock()
+			return nil
+		}
+	}
+	err := client.ForEachMaster(ctx, record("master"))
+	if err == nil {
+		err = client.ForEachSlave(ctx, record("replica"))
+	}
+	if err != nil {
+		// 슬롯 정보를 가져오지 못한 경우(모든 시드 노드 장애 등)
+		nodes = append(nodes, NodeStatus{Addr: "cluster", Role: "cluster", Err: err})
+	}
+	return nodes
 }
 
 func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
-	value, err := c.client.Get(ctx, key).Result()
+	value, err := c.client.Get(ctx, c.key(key)).Result()
 	if err == goredis.Nil {
 		return "", false, nil
 	}
@@ -37,8 +262,26 @@ func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
 	return value, true, nil
 }
 
+// TTL은 PTTL로 남은 시간을 조회하며, 만료가 없는 키는 0을 반환
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	ttl, err := c.client.PTTL(ctx, c.key(key)).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	switch {
+	case ttl == -2:
+		// 키 없음
+		return 0, false, nil
+	case ttl < 0:
+		return 0, true, nil
+	default:
+		return ttl, true, nil
+	}
+}
+
+// Take는 GETDEL 단일 명령으로 처리하므로 Sentinel(마스터)과 Cluster(키 소유 샤드) 모두에서 원자적
 func (c *Client) Take(ctx context.Context, key string) (string, bool, error) {
-	value, err := c.client.GetDel(ctx, key).Result()
+	value, err := c.client.GetDel(ctx, c.key(key)).Result()
 	if err == goredis.Nil {
 		return "", false, nil
 	}
@@ -49,5 +292,109 @@ func (c *Client) Take(ctx context.Context, key string) (string, bool, error) {
 }
 
 func (c *Client) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
-	return c.client.SetEx(ctx, key, value, time.Duration(ttlSeconds)*time.Second).Err()
+	if ttlSeconds <= 0 {
+		return storage.InvalidTTL(ttlSeconds)
+	}
+	return c.client.SetEx(ctx, c.key(key), value, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// MSetEx는 MULTI/EXEC 파이프라인 한 번으로 모든 키를 기록
+// Cluster에서는 모든 키가 같은 해시 태그여야 한 노드의 트랜잭션 하나로 처리됨
+func (c *Client) MSetEx(ctx context.Context, entries ...storage.Entry) error {
+	for _, e := range entries {
+		if e.TTLSeconds <= 0 {
+			return storage.InvalidTTL(e.TTLSeconds)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := c.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, e := range entries {
+			pipe.SetEx(ctx, c.key(e.Key), e.Value, time.Duration(e.TTLSeconds)*time.Second)
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *Client) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	if ttlSeconds <= 0 {
+		return false, storage.InvalidTTL(ttlSeconds)
+	}
+	return c.client.SetNX(ctx, c.key(key), value, time.Duration(ttlSeconds)*time.Second).Result()
+}
+
+func (c *Client) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	if ttlSeconds <= 0 {
+		return 0, storage.InvalidTTL(ttlSeconds)
+	}
+	return incrExScript.Run(ctx, c.client, []string{c.key(key)}, delta, ttlSeconds).Int64()
+}
+
+// SlidingIncrEx는 두 키를 모두 KEYS로 넘기는 스크립트 하나로 처리하며, Cluster에서는 해시 태그로 두 키가 같은 슬롯에 있음
+func (c *Client) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	if ttlSeconds <= 0 {
+		return 0, 0, false, storage.InvalidTTL(ttlSeconds)
+	}
+	res, err := slidingIncrExScript.Run(ctx, c.client, []string{c.key(key), c.key(prev)},
+		strconv.FormatFloat(prevWeight, 'g', -1, 64), limit, ttlSeconds).Int64Slice()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(res) != 3 {
+		return 0, 0, false, fmt.Errorf("unexpected sliding counter reply %v", res)
+	}
+	return res[0], res[1], res[2] == 1, nil
+}
+
+// TakeAndSetEx는 두 키를 모두 KEYS로 넘기는 스크립트 하나로 처리하며, Cluster에서는 해시 태그로 두 키가 같은 슬롯에 있음
+func (c *Client) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	if ttlSeconds <= 0 {
+		return false, storage.InvalidTTL(ttlSeconds)
+	}
+	n, err := takeAndSetScript.Run(ctx, c.client, []string{c.key(key), c.key(target)}, expected, value, ttlSeconds).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// key는 저장소 키의 Redis 키. Cluster 모드에서는 해시 태그를 앞에 붙임
+func (c *Client) key(key string) string {
+	if c.hashTag != nil {
+		if tag := c.hashTag(key); tag != "" {
+			return "{" + tag + "}" + key
+		}
+	}
+	return key
+}
+
+// Schedule은 queue를 정렬 집합으로 두고 처리 시각(unix 밀리초)을 점수로 씀
+func (c *Client) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	return c.client.ZAdd(ctx, c.key(queue), goredis.Z{Score: float64(at.UnixMilli()), Member: member}).Err()
+}
+
+func (c *Client) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	members, err := claimDueScript.Run(ctx, c.client, []string{c.key(queue)}, now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err == goredis.Nil {
+		return nil, nil
+	}
+	return members, err
+}
+
+func (c *Client) Unschedule(ctx context.Context, queue, member string) error {
+	return c.client.ZRem(ctx, c.key(queue), member).Err()
+}
+
+func (c *Client) Close() error {
+	var errs []error
+	for _, sentinel := range c.sentinels {
+		errs = append(errs, sentinel.client.Close())
+	}
+	errs = append(errs, c.closePubSub(), c.client.Close())
+	return errors.Join(errs...)
 }
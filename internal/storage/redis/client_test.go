@@ -1,9 +1,373 @@
 package redis
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"mapae/internal/storage"
+)
 
 func TestNewInvalidURL(t *testing.T) {
 	if _, err := New("not-a-redis-url"); err == nil {
 		t.Fatalf("New() should fail for invalid redis url")
 	}
 }
+
+func TestNewWithOptionsValidation(t *testing.T) {
+	cases := map[string]Options{
+		"empty":             {},
+		"sentinel no addrs": {SentinelMaster: "mymaster"},
+		"sentinel+cluster":  {SentinelMaster: "mymaster", SentinelAddrs: []string{"a:26379"}, ClusterAddrs: []string{"b:6379"}},
+		"cluster with db":   {URL: "redis://localhost:6379/3", ClusterAddrs: []string{"b:6379"}},
+	}
+	for name, opts := range cases {
+		if _, err := NewWithOptions(opts); err == nil {
+			t.Fatalf("NewWithOptions(%s) should fail", name)
+		}
+	}
+}
+
+func TestSetExGetTakeFlow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetEx(ctx, "k", "v", 10); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	got, ok, err := c.Get(ctx, "k")
+	if err != nil || !ok || got != "v" {
+		t.Fatalf("Get() = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+	taken, ok, err := c.Take(ctx, "k")
+	if err != nil || !ok || taken != "v" {
+		t.Fatalf("Take() = (%q,%t,%v), want (v,true,nil)", taken, ok, err)
+	}
+	if _, ok, err := c.Take(ctx, "k"); err != nil || ok {
+		t.Fatalf("second Take() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestPingReportsNodeHealth(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	nodes := c.PingNodes(ctx)
+	if len(nodes) != 1 || nodes[0].Addr != mr.Addr() || nodes[0].Role != "node" || nodes[0].Err != nil {
+		t.Fatalf("PingNodes() = %#v", nodes)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	addr := mr.Addr()
+	mr.Close()
+	downCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	err = c.Ping(downCtx)
+	if err == nil {
+		t.Fatalf("Ping() should fail when node is down")
+	}
+	if !strings.Contains(err.Error(), addr) {
+		t.Fatalf("Ping() error should name the failing node: %v", err)
+	}
+}
+
+func TestPingSentinelReportsEachSentinel(t *testing.T) {
+	c, err := NewWithOptions(Options{
+		SentinelMaster: "mymaster",
+		SentinelAddrs:  []string{"127.0.0.1:1", "127.0.0.1:2"},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	nodes := c.PingNodes(ctx)
+	if len(nodes) != 3 {
+		t.Fatalf("PingNodes() returned %d nodes, want 3: %#v", len(nodes), nodes)
+	}
+	if nodes[0].Role != "master" || nodes[0].Addr != "mymaster" {
+		t.Fatalf("unexpected master status: %#v", nodes[0])
+	}
+	for _, node := range nodes[1:] {
+		if node.Role != "sentinel" || node.Err == nil {
+			t.Fatalf("unreachable sentinel should be reported as failing: %#v", node)
+		}
+	}
+}
+
+func TestPingFailsOnlyWithoutMasterOrSentinelQuorum(t *testing.T) {
+	down := errors.New("connection refused")
+	cases := []struct {
+		name    string
+		nodes   []NodeStatus
+		wantErr bool
+	}{
+		{"cluster replica down", []NodeStatus{
+			{Addr: "a:6379", Role: "master"},
+			{Addr: "b:6379", Role: "master"},
+			{Addr: "c:6379", Role: "replica", Err: down},
+		}, false},
+		{"cluster master down", []NodeStatus{
+			{Addr: "a:6379", Role: "master"},
+			{Addr: "b:6379", Role: "master", Err: down},
+		}, true},
+		{"cluster slots unavailable", []NodeStatus{{Addr: "cluster", Role: "cluster", Err: down}}, true},
+		{"one of three sentinels down", []NodeStatus{
+			{Addr: "mymaster", Role: "master"},
+			{Addr: "s1:26379", Role: "sentinel"},
+			{Addr: "s2:26379", Role: "sentinel"},
+			{Addr: "s3:26379", Role: "sentinel", Err: down},
+		}, false},
+		{"sentinel quorum lost", []NodeStatus{
+			{Addr: "mymaster", Role: "master"},
+			{Addr: "s1:26379", Role: "sentinel"},
+			{Addr: "s2:26379", Role: "sentinel", Err: down},
+			{Addr: "s3:26379", Role: "sentinel", Err: down},
+		}, true},
+		{"sentinel master down", []NodeStatus{
+			{Addr: "mymaster", Role: "master", Err: down},
+			{Addr: "s1:26379", Role: "sentinel"},
+		}, true},
+	}
+	for _, tc := range cases {
+		if err := nodesError(tc.nodes); (err != nil) != tc.wantErr {
+			t.Fatalf("%s: nodesError() = %v, want error %t", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestTakeAndSetEx(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id2", "auth:id2", "verified", 30); err != nil || ok {
+		t.Fatalf("TakeAndSetEx() with another value = (%t,%v), want (false,nil)", ok, err)
+	}
+	if mr.Exists("auth:id2") || !mr.Exists("nonce:ab") {
+		t.Fatalf("TakeAndSetEx() with another value should not write: %v", mr.Keys())
+	}
+
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v), want (true,nil)", ok, err)
+	}
+	if got, _ := mr.Get("auth:id1"); got != "verified" {
+		t.Fatalf("auth:id1 = %q, want verified", got)
+	}
+	if ttl := mr.TTL("auth:id1"); ttl != 30*time.Second {
+		t.Fatalf("auth:id1 ttl = %s, want 30s", ttl)
+	}
+	if mr.Exists("nonce:ab") {
+		t.Fatalf("nonce should be consumed")
+	}
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || ok {
+		t.Fatalf("second TakeAndSetEx() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestClusterKeysShareHashTag(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// 테스트 태그는 ':' 뒤 두 글자이므로 "nonce:ab"와 "auth:ab1"이 같은 슬롯
+	hashTag := func(key string) string {
+		if i := strings.Index(key, ":"); i >= 0 && len(key) >= i+3 {
+			return key[i+1 : i+3]
+		}
+		return ""
+	}
+	c, err := NewWithOptions(Options{ClusterAddrs: []string{mr.Addr()}, HashTag: hashTag})
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetEx(ctx, "nonce:ab", "ab1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "ab1", "auth:ab1", "verified", 30); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v), want (true,nil)", ok, err)
+	}
+	if got, _ := mr.Get("{ab}auth:ab1"); got != "verified" {
+		t.Fatalf("keys = %v, want auth:ab1 under the {ab} hash tag", mr.Keys())
+	}
+	if got, ok, err := c.Get(ctx, "auth:ab1"); err != nil || !ok || got != "verified" {
+		t.Fatalf("Get() = (%q,%t,%v), want (verified,true,nil)", got, ok, err)
+	}
+
+	// 한 세션의 키는 한 슬롯에 모이고, 다른 세션과 태그가 없는 키는 흩어짐
+	if err := c.MSetEx(ctx,
+		storage.Entry{Key: "auth:cd2", Value: "pending", TTLSeconds: 60},
+		storage.Entry{Key: "nonce:cd", Value: "cd2", TTLSeconds: 60},
+		storage.Entry{Key: "tomb:cd2", Value: "1", TTLSeconds: 60},
+	); err != nil {
+		t.Fatalf("MSetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "x", "untagged", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	want := []string{"x", "{ab}auth:ab1", "{cd}auth:cd2", "{cd}nonce:cd", "{cd}tomb:cd2"}
+	if got := mr.Keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	ttl, ok, err := c.TTL(ctx, "auth:a")
+	if err != nil || !ok || ttl != 60*time.Second {
+		t.Fatalf("TTL() = (%s,%t,%v), want (1m0s,true,nil)", ttl, ok, err)
+	}
+	if _, ok, err := c.TTL(ctx, "auth:missing"); err != nil || ok {
+		t.Fatalf("TTL() missing = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	mr.Set("persistent", "v")
+	if ttl, ok, err := c.TTL(ctx, "persistent"); err != nil || !ok || ttl != 0 {
+		t.Fatalf("TTL() without expiry = (%s,%t,%v), want (0s,true,nil)", ttl, ok, err)
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := c.Subscribe(ctx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	// 다른 인스턴스에서 발행한 상황
+	publisher, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer publisher.Close()
+	if err := publisher.Publish(ctx, "auth:a", "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "verified" {
+			t.Fatalf("message = %q, want verified", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("subscriber did not receive message")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatalf("channel should be closed after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("channel was not closed after cancel")
+	}
+}
+
+// 같은 인스턴스의 구독은 커넥션 하나를 공유하며, 채널의 마지막 구독자가 끝나야 UNSUBSCRIBE
+func TestSubscribersShareOneConnection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := New("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	defer cancelFirst()
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	defer cancelSecond()
+	first, err := c.Subscribe(firstCtx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	second, err := c.Subscribe(secondCtx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	other, err := c.Subscribe(secondCtx, "auth:b")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if got := mr.PubSubNumSub("auth:a", "auth:b"); got["auth:a"] != 1 || got["auth:b"] != 1 {
+		t.Fatalf("PUBSUB NUMSUB = %v, want one server subscription per channel", got)
+	}
+
+	receive := func(ch <-chan string, want string) {
+		t.Helper()
+		select {
+		case msg := <-ch:
+			if msg != want {
+				t.Fatalf("message = %q, want %q", msg, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("subscriber did not receive %q", want)
+		}
+	}
+	if err := c.Publish(ctx, "auth:a", "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	receive(first, "verified")
+	receive(second, "verified")
+	if err := c.Publish(ctx, "auth:b", "failed"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	receive(other, "failed")
+
+	cancelFirst()
+	receive(first, "")
+	if err := c.Publish(ctx, "auth:a", "cancelled"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	receive(second, "cancelled")
+
+	cancelSecond()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mr.PubSubChannels("")) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("PUBSUB CHANNELS = %v after every subscriber ended", mr.PubSubChannels(""))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (storage.Store, func(time.Duration)) {
+		mr := miniredis.RunT(t)
+		c, err := New("redis://" + mr.Addr())
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		return c, mr.FastForward
+	})
+}
+
+func TestClusterConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (storage.Store, func(time.Duration)) {
+		mr := miniredis.RunT(t)
+		// 공통 테스트는 서로 관계없는 키를 함께 다루므로 모두 한 슬롯에 둠
+		c, err := NewWithOptions(Options{ClusterAddrs: []string{mr.Addr()}, HashTag: func(string) string { return "conformance" }})
+		if err != nil {
+			t.Fatalf("NewWithOptions() error = %v", err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		return c, mr.FastForward
+	})
+}
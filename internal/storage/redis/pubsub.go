@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// channelSub은 한 채널의 지역 구독 상태
+type channelSub struct {
+	refs int
+	// ready는 이 채널의 SUBSCRIBE 확인을 받으면 닫힘
+	ready chan struct{}
+}
+
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	return c.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe는 구독 확인을 받은 뒤 반환하므로 반환 이후 발행된 메시지는 놓치지 않음
+// 인스턴스의 모든 구독은 커넥션 하나를 공유하며, 채널의 첫 구독자가 SUBSCRIBE하고 마지막 구독자가 끝나면 UNSUBSCRIBE
+func (c *Client) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	c.subMu.Lock()
+	if c.closed {
+		c.subMu.Unlock()
+		cancel()
+		return nil, goredis.ErrClosed
+	}
+	if c.pubsub == nil {
+		c.startPubSub()
+	}
+	// 확인 직후 도착한 메시지도 받도록 SUBSCRIBE 전에 bus에 등록
+	messages := c.bus.Subscribe(subCtx, channel)
+	sub, ok := c.channels[channel]
+	if !ok {
+		sub = &channelSub{ready: make(chan struct{})}
+		c.pending[channel] = append(c.pending[channel], sub.ready)
+		if err := c.pubsub.Subscribe(ctx, channel); err != nil {
+			c.dropPending(channel)
+			_ = c.pubsub.Unsubscribe(context.Background(), channel)
+			c.subMu.Unlock()
+			cancel()
+			return nil, err
+		}
+		c.channels[channel] = sub
+	}
+	sub.refs++
+	c.subMu.Unlock()
+
+	go func() {
+		defer cancel()
+		<-subCtx.Done()
+		c.release(channel)
+	}()
+	select {
+	case <-sub.ready:
+		return messages, nil
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+}
+
+// startPubSub은 구독 커넥션을 열고 받은 메시지를 c.bus로 전달하는 루프를 시작. c.subMu를 잡은 채 호출
+func (c *Client) startPubSub() {
+	c.pubsub = c.client.Subscribe(context.Background())
+	c.pubsubDone = make(chan struct{})
+	go c.pubsubLoop(c.pubsub.ChannelWithSubscriptions(), c.pubsubDone)
+}
+
+func (c *Client) pubsubLoop(messages <-chan interface{}, done chan struct{}) {
+	defer close(done)
+	for msg := range messages {
+		switch m := msg.(type) {
+		case *goredis.Message:
+			c.bus.Publish(m.Channel, m.Payload)
+		case *goredis.Subscription:
+			// 재연결 뒤 다시 구독할 때도 확인이 오며, 그때는 기다리는 구독이 없거나 이미 구독된 상태
+			if m.Kind == "subscribe" {
+				c.subMu.Lock()
+				if q := c.pending[m.Channel]; len(q) > 0 {
+					close(q[0])
+					c.popPending(m.Channel)
+				}
+				c.subMu.Unlock()
+			}
+		}
+	}
+}
+
+// release는 channel의 지역 구독자 하나를 빼고, 남은 구독자가 없으면 UNSUBSCRIBE
+func (c *Client) release(channel string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	sub, ok := c.channels[channel]
+	if !ok {
+		return
+	}
+	sub.refs--
+	if sub.refs > 0 {
+		return
+	}
+	delete(c.channels, channel)
+	if !c.closed {
+		_ = c.pubsub.Unsubscribe(context.Background(), channel)
+	}
+}
+
+// popPending은 channel에서 가장 먼저 보낸 SUBSCRIBE의 대기를 지움
+func (c *Client) popPending(channel string) {
+	if q := c.pending[channel][1:]; len(q) > 0 {
+		c.pending[channel] = q
+	} else {
+		delete(c.pending, channel)
+	}
+}
+
+// dropPending은 보내지 못한 마지막 SUBSCRIBE의 대기를 지움
+func (c *Client) dropPending(channel string) {
+	if q := c.pending[channel]; len(q) > 1 {
+		c.pending[channel] = q[:len(q)-1]
+	} else {
+		delete(c.pending, channel)
+	}
+}
+
+func (c *Client) closePubSub() error {
+	c.subMu.Lock()
+	c.closed = true
+	pubsub, done := c.pubsub, c.pubsubDone
+	c.subMu.Unlock()
+	if pubsub == nil {
+		return nil
+	}
+	err := pubsub.Close()
+	<-done
+	return err
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen은 회로 차단기가 열려 저장소 호출 없이 즉시 실패했음을 나타냄
+var ErrCircuitOpen = errors.New("storage circuit breaker is open")
+
+// BreakerState는 회로 차단기 상태
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerReporter는 회로 차단기 상태를 알려주는 Store
+type BreakerReporter interface {
+	BreakerState() BreakerState
+}
+
+// ResilientOptions는 Resilient 래퍼 설정
+// 0 이하인 값은 기본값을 사용
+type ResilientOptions struct {
+	// RetryAttempts는 멱등 작업(Ping/Get/TTL/SetEx/MSetEx/Schedule/Unschedule)의 최대 시도 횟수(첫 시도 포함)
+	RetryAttempts int
+	// RetryBaseDelay는 재시도 대기 시간의 기준값. n번째 재시도는 [0, base*2^n) 범위에서 무작위로 대기
+	RetryBaseDelay time.Duration
+	// FailureThreshold는 차단기를 여는 연속 실패 횟수
+	FailureThreshold int
+	// OpenTimeout은 차단기가 열린 뒤 시험 호출(half-open)을 허용하기까지의 시간
+	OpenTimeout time.Duration
+}
+
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBaseDelay   = 50 * time.Millisecond
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 10 * time.Second
+)
+
+// Resilient는 재시도와 회로 차단기를 적용한 Store를 반환
+//
+// Take/TakeAndSetEx/AddEx/IncrEx/ClaimDue는 응답이 유실된 경우 이미 반영되었을 수 있어 재시도하지 않음
+// 저장소가 계속 실패하면 차단기가 열려 OpenTimeout 동안 ErrCircuitOpen으로 즉시 실패하고,
+// 이후 한 번의 시험 호출이 성공하면 다시 닫힘
+func Resilient(store Store, opts ResilientOptions) *ResilientStore {
+	if opts.RetryAttempts <= 0 {
+		opts.RetryAttempts = defaultRetryAttempts
+	}
+	if opts.RetryBaseDelay <= 0 {
+		opts.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultOpenTimeout
+	}
+	return &ResilientStore{store: store, opts: opts, now: time.Now}
+}
+
+type ResilientStore struct {
+	store Store
+	opts  ResilientOptions
+	now   func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (r *ResilientStore) Ping(ctx context.Context) error {
+	return r.retry(ctx, func() error {
+		return r.store.Ping(ctx)
+	})
+}
+
+func (r *ResilientStore) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	var ok bool
+	err := r.retry(ctx, func() error {
+		var err error
+		value, ok, err = r.store.Get(ctx, key)
+		return err
+	})
+	return value, ok, err
+}
+
+func (r *ResilientStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	var ttl time.Duration
+	var ok bool
+	err := r.retry(ctx, func() error {
+		var err error
+		ttl, ok, err = r.store.TTL(ctx, key)
+		return err
+	})
+	return ttl, ok, err
+}
+
+func (r *ResilientStore) Take(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	var ok bool
+	err := r.call(func() error {
+		var err error
+		value, ok, err = r.store.Take(ctx, key)
+		return err
+	})
+	return value, ok, err
+}
+
+func (r *ResilientStore) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	return r.retry(ctx, func() error {
+		return r.store.SetEx(ctx, key, value, ttlSeconds)
+	})
+}
+
+// MSetEx는 같은 값을 다시 써도 결과가 같으므로 SetEx처럼 재시도
+func (r *ResilientStore) MSetEx(ctx context.Context, entries ...Entry) error {
+	return r.retry(ctx, func() error {
+		return r.store.MSetEx(ctx, entries...)
+	})
+}
+
+// AddEx는 응답이 유실되면 이미 기록되었을 수 있어 재시도하지 않음(재시도하면 자기 기록 때문에 false가 됨)
+func (r *ResilientStore) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	var added bool
+	err := r.call(func() error {
+		var err error
+		added, err = r.store.AddEx(ctx, key, value, ttlSeconds)
+		return err
+	})
+	return added, err
+}
+
+// IncrEx는 응답이 유실되면 이미 더해졌을 수 있어 재시도하지 않음
+func (r *ResilientStore) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	var n int64
+	err := r.call(func() error {
+		var err error
+		n, err = r.store.IncrEx(ctx, key, delta, ttlSeconds)
+		return err
+	})
+	return n, err
+}
+
+// SlidingIncrEx도 IncrEx와 같은 이유로 재시도하지 않음
+func (r *ResilientStore) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	var current, previous int64
+	var added bool
+	err := r.call(func() error {
+		var err error
+		current, previous, added, err = r.store.SlidingIncrEx(ctx, key, prev, prevWeight, limit, ttlSeconds)
+		return err
+	})
+	return current, previous, added, err
+}
+
+func (r *ResilientStore) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	var ok bool
+	err := r.call(func() error {
+		var err error
+		ok, err = r.store.TakeAndSetEx(ctx, key, expected, target, value, ttlSeconds)
+		return err
+	})
+	return ok, err
+}
+
+// Publish는 중복 알림이 무해하므로 재시도
+func (r *ResilientStore) Publish(ctx context.Context, channel, message string) error {
+	return r.retry(ctx, func() error {
+		return r.store.Publish(ctx, channel, message)
+	})
+}
+
+func (r *ResilientStore) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	var messages <-chan string
+	err := r.call(func() error {
+		var err error
+		messages, err = r.store.Subscribe(ctx, channel)
+		return err
+	})
+	return messages, err
+}
+
+// Schedule은 같은 시각으로 다시 넣어도 결과가 같으므로 재시도
+func (r *ResilientStore) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	return r.retry(ctx, func() error {
+		return r.store.Schedule(ctx, queue, member, at)
+	})
+}
+
+// ClaimDue는 응답이 유실되면 가져간 항목이 lease 동안 숨겨지므로 재시도하지 않음
+func (r *ResilientStore) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	var members []string
+	err := r.call(func() error {
+		var err error
+		members, err = r.store.ClaimDue(ctx, queue, now, lease, limit)
+		return err
+	})
+	return members, err
+}
+
+func (r *ResilientStore) Unschedule(ctx context.Context, queue, member string) error {
+	return r.retry(ctx, func() error {
+		return r.store.Unschedule(ctx, queue, member)
+	})
+}
+
+// BreakerState는 현재 차단기 상태를 반환
+// 열린 지 OpenTimeout이 지났으면 다음 호출이 시험 호출이 되므로 half-open으로 보고
+func (r *ResilientStore) BreakerState() BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.state == BreakerOpen && r.now().Sub(r.openedAt) >= r.opts.OpenTimeout:
+		return BreakerHalfOpen
+	case r.state == "":
+		return BreakerClosed
+	default:
+		return r.state
+	}
+}
+
+func (r *ResilientStore) retry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < r.opts.RetryAttempts; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(rand.Int64N(int64(r.opts.RetryBaseDelay) << (attempt - 1)))
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+		err = r.call(fn)
+		if err == nil || errors.Is(err, ErrCircuitOpen) || callerError(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// call은 차단기를 거쳐 fn을 한 번 실행
+func (r *ResilientStore) call(fn func() error) error {
+	allowed, probe := r.allow()
+	if !allowed {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	r.record(err, probe)
+	return err
+}
+
+// allow는 호출을 허용할지와, 허용했다면 그 호출이 half-open의 시험 호출인지를 반환
+func (r *ResilientStore) allow() (allowed, probe bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case BreakerOpen:
+		if r.now().Sub(r.openedAt) < r.opts.OpenTimeout {
+			return false, false
+		}
+		r.state = BreakerHalfOpen
+		r.probing = true
+		return true, true
+	case BreakerHalfOpen:
+		// 시험 호출은 한 번에 하나만 허용
+		if r.probing {
+			return false, false
+		}
+		r.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// record는 호출 결과를 차단기에 반영하며, probe는 allow가 시험 호출로 허용한 호출인지 여부
+func (r *ResilientStore) record(err error, probe bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if probe {
+		r.probing = false
+	} else if r.state == BreakerOpen || r.state == BreakerHalfOpen {
+		// 차단기가 열리기 전에 시작한 호출의 결과는 시험 호출을 대신하지 않음
+		return
+	}
+	// 호출자가 요청을 취소했거나 인자가 잘못된 경우는 저장소 장애로 보지 않음
+	if callerError(err) {
+		if probe {
+			r.state = BreakerOpen
+		}
+		return
+	}
+	if err == nil {
+		r.state = BreakerClosed
+		r.failures = 0
+		return
+	}
+	r.failures++
+	if r.state == BreakerHalfOpen || r.failures >= r.opts.FailureThreshold {
+		r.state = BreakerOpen
+		r.openedAt = r.now()
+	}
+}
+
+// callerError는 err가 저장소가 아닌 호출자 쪽 원인(취소, 잘못된 인자)인지 여부
+func callerError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, ErrInvalidArgument)
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyStore는 failures가 0이 될 때까지 모든 호출을 실패시킴
+type flakyStore struct {
+	mapStore
+	failures int
+	calls    int
+}
+
+var errUnavailable = errors.New("connection refused")
+
+func (f *flakyStore) fail() error {
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return errUnavailable
+	}
+	return nil
+}
+
+func (f *flakyStore) Ping(ctx context.Context) error {
+	return f.fail()
+}
+
+func (f *flakyStore) Get(ctx context.Context, key string) (string, bool, error) {
+	if err := f.fail(); err != nil {
+		return "", false, err
+	}
+	return f.mapStore.Get(ctx, key)
+}
+
+func (f *flakyStore) Take(ctx context.Context, key string) (string, bool, error) {
+	if err := f.fail(); err != nil {
+		return "", false, err
+	}
+	return f.mapStore.Take(ctx, key)
+}
+
+func newTestResilient(store Store) *ResilientStore {
+	return Resilient(store, ResilientOptions{
+		RetryAttempts:    3,
+		RetryBaseDelay:   time.Millisecond,
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+	})
+}
+
+func TestResilientRetriesIdempotentOperations(t *testing.T) {
+	backend := &flakyStore{mapStore: mapStore{"auth:a": "pending"}, failures: 2}
+	r := newTestResilient(backend)
+
+	got, ok, err := r.Get(context.Background(), "auth:a")
+	if err != nil || !ok || got != "pending" {
+		t.Fatalf("Get() = (%q,%t,%v), want (pending,true,nil)", got, ok, err)
+	}
+	if backend.calls != 3 {
+		t.Fatalf("backend calls = %d, want 3", backend.calls)
+	}
+	if state := r.BreakerState(); state != BreakerClosed {
+		t.Fatalf("BreakerState() = %q, want closed", state)
+	}
+}
+
+func TestResilientDoesNotRetryTake(t *testing.T) {
+	backend := &flakyStore{mapStore: mapStore{"nonce:ab": "id1"}, failures: 1}
+	r := newTestResilient(backend)
+
+	if _, _, err := r.Take(context.Background(), "nonce:ab"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Take() error = %v, want %v", err, errUnavailable)
+	}
+	if backend.calls != 1 {
+		t.Fatalf("backend calls = %d, want 1", backend.calls)
+	}
+}
+
+func TestResilientBreakerOpensAndRecovers(t *testing.T) {
+	backend := &flakyStore{mapStore: mapStore{}, failures: 3}
+	r := newTestResilient(backend)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := r.Ping(ctx); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Ping() error = %v, want %v", err, errUnavailable)
+	}
+	if state := r.BreakerState(); state != BreakerOpen {
+		t.Fatalf("BreakerState() after failures = %q, want open", state)
+	}
+
+	// 열린 동안에는 저장소를 호출하지 않고 즉시 실패
+	calls := backend.calls
+	if _, _, err := r.Take(ctx, "nonce:ab"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Take() error = %v, want ErrCircuitOpen", err)
+	}
+	if backend.calls != calls {
+		t.Fatalf("backend should not be called while open")
+	}
+
+	now = now.Add(time.Minute)
+	if state := r.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("BreakerState() after timeout = %q, want half-open", state)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Fatalf("Ping() probe error = %v", err)
+	}
+	if state := r.BreakerState(); state != BreakerClosed {
+		t.Fatalf("BreakerState() after probe = %q, want closed", state)
+	}
+}
+
+func TestResilientFailedProbeReopens(t *testing.T) {
+	backend := &flakyStore{mapStore: mapStore{}, failures: 10}
+	r := newTestResilient(backend)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = r.Ping(ctx)
+	now = now.Add(time.Minute)
+	calls := backend.calls
+	if err := r.Ping(ctx); !errors.Is(err, ErrCircuitOpen) && !errors.Is(err, errUnavailable) {
+		t.Fatalf("Ping() probe error = %v", err)
+	}
+	if backend.calls != calls+1 {
+		t.Fatalf("half-open should allow exactly one probe, got %d calls", backend.calls-calls)
+	}
+	if state := r.BreakerState(); state != BreakerOpen {
+		t.Fatalf("BreakerState() after failed probe = %q, want open", state)
+	}
+}
+
+// 차단기가 열리기 전에 시작해 시험 호출 중에 끝난 호출은 시험 호출을 끝내거나 차단기를 닫지 않아야 함
+func TestResilientProbeIgnoresCallsStartedBeforeOpening(t *testing.T) {
+	r := newTestResilient(&flakyStore{mapStore: mapStore{}})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	started, release := make(chan struct{}), make(chan struct{})
+	stale := make(chan error, 1)
+	go func() {
+		stale <- r.call(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	for i := 0; i < 3; i++ {
+		_ = r.call(func() error { return errUnavailable })
+	}
+	if state := r.BreakerState(); state != BreakerOpen {
+		t.Fatalf("BreakerState() after failures = %q, want open", state)
+	}
+
+	now = now.Add(time.Minute)
+	probeStarted, probeRelease := make(chan struct{}), make(chan struct{})
+	probe := make(chan error, 1)
+	go func() {
+		probe <- r.call(func() error {
+			close(probeStarted)
+			<-probeRelease
+			return nil
+		})
+	}()
+	<-probeStarted
+
+	close(release)
+	if err := <-stale; err != nil {
+		t.Fatalf("stale call error = %v", err)
+	}
+	if state := r.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("BreakerState() after the stale call = %q, want half-open", state)
+	}
+	called := false
+	if err := r.call(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("call() during the probe = (called=%t, err=%v), want rejected with ErrCircuitOpen", called, err)
+	}
+
+	close(probeRelease)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if state := r.BreakerState(); state != BreakerClosed {
+		t.Fatalf("BreakerState() after the probe = %q, want closed", state)
+	}
+}
+
+// invalidStore는 양수가 아닌 TTL을 저장소 구현처럼 ErrInvalidArgument로 거부
+type invalidStore struct {
+	mapStore
+	calls int
+}
+
+func (s *invalidStore) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	s.calls++
+	if ttlSeconds <= 0 {
+		return InvalidTTL(ttlSeconds)
+	}
+	return s.mapStore.SetEx(ctx, key, value, ttlSeconds)
+}
+
+// 호출자의 잘못(잘못된 인자, 취소)은 재시도하지 않고 차단기도 열지 않아야 함
+func TestResilientIgnoresCallerErrors(t *testing.T) {
+	backend := &invalidStore{mapStore: mapStore{}}
+	r := newTestResilient(backend)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := r.SetEx(ctx, "auth:a", "pending", 0); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("SetEx() error = %v, want ErrInvalidArgument", err)
+		}
+	}
+	if backend.calls != 5 {
+		t.Fatalf("backend calls = %d, want 5 (no retries)", backend.calls)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for i := 0; i < 5; i++ {
+		_ = r.call(func() error { return cancelled.Err() })
+	}
+	if state := r.BreakerState(); state != BreakerClosed {
+		t.Fatalf("BreakerState() = %q, want closed", state)
+	}
+	if err := r.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+}
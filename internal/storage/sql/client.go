@@ -0,0 +1,436 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/broker"
+)
+
+const (
+	tableName      = "mapae_kv"
+	queueTableName = "mapae_queue"
+	purgeInterval  = time.Minute
+)
+
+type Client struct {
+	db      *dbsql.DB
+	dialect dialect
+
+	bus          *broker.Broker
+	listener     *pq.Listener
+	listenerDone chan struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// New는 DSN의 스킴으로 dialect를 고른 뒤 스키마를 마이그레이션하고 만료 데이터 정리를 시작
+//
+// - postgres://, postgresql:// : PostgreSQL
+// - sqlite://<path>, sqlite:<path> : SQLite (예: sqlite:///var/lib/mapae/mapae.db, sqlite::memory:)
+func New(dsn string) (*Client, error) {
+	d, source, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := dbsql.Open(d.driver, source)
+	if err != nil {
+		return nil, err
+	}
+	if d.name == "sqlite" {
+		// SQLite는 쓰기 잠금이 DB 단위이고 :memory:는 커넥션마다 별도 DB이므로 단일 커넥션으로 직렬화
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db, d); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate %s schema: %w", d.name, err)
+	}
+
+	c := &Client{
+		db:      db,
+		dialect: d,
+		bus:     broker.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if d.name == "postgres" {
+		if err := c.startListener(source); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("listen %s: %w", notifyChannel, err)
+		}
+	}
+	go c.purgeLoop(purgeInterval)
+	return c, nil
+}
+
+func parseDSN(dsn string) (dialect, string, error) {
+	trimmed := strings.TrimSpace(dsn)
+	lower := strings.ToLower(trimmed)
+	switch {
+	case strings.HasPrefix(lower, "postgres://"), strings.HasPrefix(lower, "postgresql://"):
+		return postgresDialect, trimmed, nil
+	case strings.HasPrefix(lower, "sqlite://"):
+		return sqliteDialect, trimmed[len("sqlite://"):], nil
+	case strings.HasPrefix(lower, "sqlite:"):
+		return sqliteDialect, trimmed[len("sqlite:"):], nil
+	default:
+		return dialect{}, "", errors.New("unsupported database url: expected postgres:// or sqlite:")
+	}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := c.db.QueryRowContext(ctx,
+		c.dialect.bind("SELECT value FROM "+tableName+" WHERE key = ? AND expires_at > ?"),
+		key, nowMillis(),
+	).Scan(&value)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	now := nowMillis()
+	var expiresAt int64
+	err := c.db.QueryRowContext(ctx,
+		c.dialect.bind("SELECT expires_at FROM "+tableName+" WHERE key = ? AND expires_at > ?"),
+		key, now,
+	).Scan(&expiresAt)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(expiresAt-now) * time.Millisecond, true, nil
+}
+
+func (c *Client) Take(ctx context.Context, key string) (string, bool, error) {
+	// DELETE ... RETURNING 한 문장으로 조회와 삭제를 묶어 동시 요청 중 하나만 값을 가져가도록 보장
+	// 만료된 행은 남겨두고 purge에서 정리
+	var value string
+	err := c.db.QueryRowContext(ctx,
+		c.dialect.bind("DELETE FROM "+tableName+" WHERE key = ? AND expires_at > ? RETURNING value"),
+		key, nowMillis(),
+	).Scan(&value)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (c *Client) SetEx(ctx context.Context, key, value string, ttlSeconds int) error {
+	if ttlSeconds <= 0 {
+		return storage.InvalidTTL(ttlSeconds)
+	}
+	return c.upsert(ctx, c.db, key, value, ttlSeconds)
+}
+
+// TakeAndSetEx는 한 트랜잭션 안에서 값이 expected인 key 행을 지우고 target을 기록
+// 기록이 실패하면 롤백되어 key가 그대로 남음
+func (c *Client) TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error) {
+	if ttlSeconds <= 0 {
+		return false, storage.InvalidTTL(ttlSeconds)
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx,
+		c.dialect.bind("DELETE FROM "+tableName+" WHERE key = ? AND value = ? AND expires_at > ?"),
+		key, expected, nowMillis(),
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := c.upsert(ctx, tx, target, value, ttlSeconds); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MSetEx는 여러 행을 한 INSERT ... ON CONFLICT 문으로 기록하므로 왕복 1회에 원자적으로 처리
+func (c *Client) MSetEx(ctx context.Context, entries ...storage.Entry) error {
+	for _, e := range entries {
+		if e.TTLSeconds <= 0 {
+			return storage.InvalidTTL(e.TTLSeconds)
+		}
+	}
+	// 한 문장 안에서 같은 키를 두 번 갱신할 수 없으므로(PostgreSQL) 마지막 값만 남김
+	last := make(map[string]int, len(entries))
+	for i, e := range entries {
+		last[e.Key] = i
+	}
+	now := time.Now()
+	var placeholders []string
+	var args []any
+	for i, e := range entries {
+		if last[e.Key] != i {
+			continue
+		}
+		placeholders = append(placeholders, "(?, ?, ?)")
+		args = append(args, e.Key, e.Value, now.Add(time.Duration(e.TTLSeconds)*time.Second).UnixMilli())
+	}
+	if len(placeholders) == 0 {
+		return nil
+	}
+	_, err := c.db.ExecContext(ctx,
+		c.dialect.bind("INSERT INTO "+tableName+" (key, value, expires_at) VALUES "+strings.Join(placeholders, ", ")+" "+
+			"ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at"),
+		args...,
+	)
+	return err
+}
+
+// AddEx는 만료된 행만 덮어쓰는 UPSERT로 처리하며, 살아 있는 행이 있으면 영향받은 행이 0
+func (c *Client) AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error) {
+	if ttlSeconds <= 0 {
+		return false, storage.InvalidTTL(ttlSeconds)
+	}
+	now := time.Now()
+	res, err := c.db.ExecContext(ctx,
+		c.dialect.bind("INSERT INTO "+tableName+" (key, value, expires_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at "+
+			"WHERE "+tableName+".expires_at <= ?"),
+		key, value, now.Add(time.Duration(ttlSeconds)*time.Second).UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// IncrEx는 한 UPSERT 문으로 처리하며, 만료된 행은 새로 만든 것처럼 0에서 시작
+func (c *Client) IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error) {
+	if ttlSeconds <= 0 {
+		return 0, storage.InvalidTTL(ttlSeconds)
+	}
+	now := time.Now()
+	var value string
+	err := c.db.QueryRowContext(ctx,
+		c.dialect.bind("INSERT INTO "+tableName+" (key, value, expires_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (key) DO UPDATE SET "+
+			"value = CASE WHEN "+tableName+".expires_at > ? THEN CAST(CAST("+tableName+".value AS BIGINT) + ? AS TEXT) ELSE excluded.value END, "+
+			"expires_at = CASE WHEN "+tableName+".expires_at > ? THEN "+tableName+".expires_at ELSE excluded.expires_at END "+
+			"RETURNING value"),
+		key, strconv.FormatInt(delta, 10), now.Add(time.Duration(ttlSeconds)*time.Second).UnixMilli(),
+		now.UnixMilli(), delta, now.UnixMilli(),
+	).Scan(&value)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// SlidingIncrEx는 한 트랜잭션 안에서 직전 윈도 값을 읽고, 한도 안일 때만 더하는 조건부 UPSERT로 처리
+// 조건은 갱신할 행을 잠근 뒤 다시 확인하므로 동시에 호출해도 한도를 넘겨 더하지 않음
+func (c *Client) SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (int64, int64, bool, error) {
+	if ttlSeconds <= 0 {
+		return 0, 0, false, storage.InvalidTTL(ttlSeconds)
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	previous, err := c.counter(ctx, tx, prev, now.UnixMilli())
+	if err != nil {
+		return 0, 0, false, err
+	}
+	// current + 1 + previous*prevWeight <= limit 인 current는 ceiling 미만
+	ceiling := int64(math.Floor(float64(limit) - float64(previous)*prevWeight))
+	added := false
+	var current int64
+	if ceiling >= 1 {
+		var value string
+		err = tx.QueryRowContext(ctx,
+			c.dialect.bind("INSERT INTO "+tableName+" (key, value, expires_at) VALUES (?, '1', ?) "+
+				"ON CONFLICT (key) DO UPDATE SET "+
+				"value = CASE WHEN "+tableName+".expires_at > ? THEN CAST(CAST("+tableName+".value AS BIGINT) + 1 AS TEXT) ELSE excluded.value END, "+
+				"expires_at = CASE WHEN "+tableName+".expires_at > ? THEN "+tableName+".expires_at ELSE excluded.expires_at END "+
+				"WHERE "+tableName+".expires_at <= ? OR CAST("+tableName+".value AS BIGINT) < ? "+
+				"RETURNING value"),
+			key, now.Add(time.Duration(ttlSeconds)*time.Second).UnixMilli(),
+			now.UnixMilli(), now.UnixMilli(), now.UnixMilli(), ceiling,
+		).Scan(&value)
+		switch {
+		case err == nil:
+			if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, 0, false, err
+			}
+			added = true
+		case !errors.Is(err, dbsql.ErrNoRows):
+			return 0, 0, false, err
+		}
+	}
+	if !added {
+		if current, err = c.counter(ctx, tx, key, now.UnixMilli()); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, false, err
+	}
+	return current, previous, added, nil
+}
+
+// counter는 만료되지 않은 key의 정수 값이며, 없으면 0
+func (c *Client) counter(ctx context.Context, tx *dbsql.Tx, key string, now int64) (int64, error) {
+	var value string
+	err := tx.QueryRowContext(ctx,
+		c.dialect.bind("SELECT value FROM "+tableName+" WHERE key = ? AND expires_at > ?"), key, now,
+	).Scan(&value)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of %q is not an integer", key)
+	}
+	return n, nil
+}
+
+func (c *Client) Schedule(ctx context.Context, queue, member string, at time.Time) error {
+	_, err := c.db.ExecContext(ctx,
+		c.dialect.bind("INSERT INTO "+queueTableName+" (queue, member, due_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (queue, member) DO UPDATE SET due_at = excluded.due_at"),
+		queue, member, at.UnixMilli(),
+	)
+	return err
+}
+
+// ClaimDue는 한 UPDATE ... RETURNING 문으로 처리
+// PostgreSQL에서는 다른 트랜잭션이 잠근 행을 건너뛰고, 잠금을 기다린 행도 바깥 조건(due_at <= now)을 다시 확인하므로 두 번 가져가지 않음
+func (c *Client) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	cutoff := now.UnixMilli()
+	rows, err := c.db.QueryContext(ctx,
+		c.dialect.bind("UPDATE "+queueTableName+" SET due_at = ? "+
+			"WHERE queue = ? AND due_at <= ? AND member IN ("+
+			"SELECT member FROM "+queueTableName+" WHERE queue = ? AND due_at <= ? ORDER BY due_at, member LIMIT ?"+c.dialect.skipLocked+
+			") RETURNING member"),
+		now.Add(lease).UnixMilli(), queue, cutoff, queue, cutoff, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []string
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (c *Client) Unschedule(ctx context.Context, queue, member string) error {
+	_, err := c.db.ExecContext(ctx,
+		c.dialect.bind("DELETE FROM "+queueTableName+" WHERE queue = ? AND member = ?"),
+		queue, member,
+	)
+	return err
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (dbsql.Result, error)
+}
+
+func (c *Client) upsert(ctx context.Context, db execer, key, value string, ttlSeconds int) error {
+	expiresAt := time.Now().Add(time.Duration(ttlSeconds) * time.Second).UnixMilli()
+	_, err := db.ExecContext(ctx,
+		c.dialect.bind("INSERT INTO "+tableName+" (key, value, expires_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at"),
+		key, value, expiresAt,
+	)
+	return err
+}
+
+// Purge는 만료된 행을 삭제하고 삭제한 행 수를 반환
+func (c *Client) Purge(ctx context.Context) (int64, error) {
+	res, err := c.db.ExecContext(ctx,
+		c.dialect.bind("DELETE FROM "+tableName+" WHERE expires_at <= ?"),
+		nowMillis(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (c *Client) purgeLoop(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			_, _ = c.Purge(ctx)
+			cancel()
+		}
+	}
+}
+
+// Close는 purge 루프와 리스너를 멈추고 커넥션 풀을 닫음
+func (c *Client) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+	return errors.Join(c.closeListener(), c.db.Close())
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
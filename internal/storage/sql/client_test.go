@@ -0,0 +1,262 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := New("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestSetExGetTakeFlow(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "k", "v", 10); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "k", "v2", 10); err != nil {
+		t.Fatalf("SetEx() overwrite error = %v", err)
+	}
+
+	got, ok, err := c.Get(ctx, "k")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !ok || got != "v2" {
+		t.Fatalf("Get() = (%q,%t), want (v2,true)", got, ok)
+	}
+
+	taken, ok, err := c.Take(ctx, "k")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if !ok || taken != "v2" {
+		t.Fatalf("Take() = (%q,%t), want (v2,true)", taken, ok)
+	}
+
+	_, ok, err = c.Get(ctx, "k")
+	if err != nil {
+		t.Fatalf("Get() after take error = %v", err)
+	}
+	if ok {
+		t.Fatalf("key should be deleted after Take")
+	}
+}
+
+func TestSetExRejectsNonPositiveTTL(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.SetEx(context.Background(), "k", "v", 0); err == nil {
+		t.Fatalf("expected error for non-positive ttl")
+	}
+}
+
+func TestExpiredEntryIsHiddenAndPurged(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Second).UnixMilli()
+	if _, err := c.db.ExecContext(ctx, "INSERT INTO "+tableName+" (key, value, expires_at) VALUES (?, ?, ?)", "expired", "v", past); err != nil {
+		t.Fatalf("insert error = %v", err)
+	}
+
+	if _, ok, err := c.Get(ctx, "expired"); err != nil || ok {
+		t.Fatalf("Get() expired = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := c.Take(ctx, "expired"); err != nil || ok {
+		t.Fatalf("Take() expired = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+
+	n, err := c.Purge(ctx)
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Purge() removed %d rows, want 1", n)
+	}
+}
+
+func TestTakeIsAtomicUnderConcurrency(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "nonce", "auth-id", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	const workers = 64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	var successCount int32
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			_, ok, err := c.Take(ctx, "nonce")
+			if err != nil {
+				t.Errorf("Take() error = %v", err)
+				return
+			}
+			if ok {
+				atomic.AddInt32(&successCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&successCount); got != 1 {
+		t.Fatalf("successful Take count = %d, want 1", got)
+	}
+}
+
+func TestMigrationIsIdempotentAndDataSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapae.db")
+	ctx := context.Background()
+
+	c, err := New("sqlite://" + path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "k", "v", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	c, err = New("sqlite://" + path)
+	if err != nil {
+		t.Fatalf("New() reopen error = %v", err)
+	}
+	defer c.Close()
+
+	got, ok, err := c.Get(ctx, "k")
+	if err != nil || !ok || got != "v" {
+		t.Fatalf("Get() after reopen = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+
+	var versions int
+	if err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM mapae_schema_migrations").Scan(&versions); err != nil {
+		t.Fatalf("count migrations error = %v", err)
+	}
+	if versions != len(migrations) {
+		t.Fatalf("applied migrations = %d, want %d", versions, len(migrations))
+	}
+}
+
+func TestNewInvalidDSN(t *testing.T) {
+	if _, err := New("mysql://localhost/mapae"); err == nil {
+		t.Fatalf("New() should fail for unsupported scheme")
+	}
+}
+
+func TestDialectBind(t *testing.T) {
+	query := "SELECT value FROM t WHERE key = ? AND expires_at > ?"
+	if got := sqliteDialect.bind(query); got != query {
+		t.Fatalf("sqlite bind = %q", got)
+	}
+	if got := postgresDialect.bind(query); got != "SELECT value FROM t WHERE key = $1 AND expires_at > $2" {
+		t.Fatalf("postgres bind = %q", got)
+	}
+}
+
+func TestTakeAndSetEx(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := c.SetEx(ctx, "auth:id1", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id2", "auth:id2", "verified", 30); err != nil || ok {
+		t.Fatalf("TakeAndSetEx() with another value = (%t,%v), want (false,nil)", ok, err)
+	}
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v), want (true,nil)", ok, err)
+	}
+	if got, _, _ := c.Get(ctx, "auth:id1"); got != "verified" {
+		t.Fatalf("auth:id1 = %q, want verified", got)
+	}
+	if _, ok, _ := c.Get(ctx, "nonce:ab"); ok {
+		t.Fatalf("nonce should be consumed")
+	}
+	if ok, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err != nil || ok {
+		t.Fatalf("second TakeAndSetEx() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestTakeAndSetExRollsBackOnWriteFailure(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "nonce:ab", "id1", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	// 대상 키 기록을 실패시키기 위해 트리거로 INSERT를 막음
+	if _, err := c.db.ExecContext(ctx, `CREATE TRIGGER block_auth BEFORE INSERT ON `+tableName+`
+		WHEN NEW.key LIKE 'auth:%' BEGIN SELECT RAISE(ABORT, 'blocked'); END`); err != nil {
+		t.Fatalf("create trigger error = %v", err)
+	}
+
+	if _, err := c.TakeAndSetEx(ctx, "nonce:ab", "id1", "auth:id1", "verified", 30); err == nil {
+		t.Fatalf("TakeAndSetEx() should fail when the write is rejected")
+	}
+	if got, ok, _ := c.Get(ctx, "nonce:ab"); !ok || got != "id1" {
+		t.Fatalf("nonce should be restored by rollback, got (%q,%t)", got, ok)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if err := c.SetEx(ctx, "auth:a", "pending", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	ttl, ok, err := c.TTL(ctx, "auth:a")
+	if err != nil || !ok {
+		t.Fatalf("TTL() = (ok=%t, err=%v), want (true, nil)", ok, err)
+	}
+	if ttl <= 59*time.Second || ttl > 60*time.Second {
+		t.Fatalf("TTL() = %s, want about 60s", ttl)
+	}
+	if _, ok, err := c.TTL(ctx, "auth:missing"); err != nil || ok {
+		t.Fatalf("TTL() missing = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestPublishSubscribeSQLite(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := c.Subscribe(ctx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := c.Publish(ctx, "auth:a", "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "verified" {
+			t.Fatalf("message = %q, want verified", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscriber did not receive message")
+	}
+}
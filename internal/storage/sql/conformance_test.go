@@ -0,0 +1,16 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/storagetest"
+)
+
+// SQL 저장소는 만료 판단에 DB가 아닌 프로세스 시계를 쓰지만 주입 지점이 없으므로 실제로 기다림
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (storage.Store, func(time.Duration)) {
+		return newTestClient(t), nil
+	})
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dialect struct {
+	name   string
+	driver string
+	// positional는 true일 때 '?' 자리표시자를 $1, $2... 형태로 바꿈
+	positional bool
+	// migrationLock은 여러 인스턴스가 동시에 기동할 때 마이그레이션을 직렬화하는 구문
+	migrationLock string
+	// skipLocked는 ClaimDue가 다른 트랜잭션이 잠근 행을 기다리지 않고 건너뛰도록 하위 SELECT에 붙이는 절
+	skipLocked string
+}
+
+var (
+	sqliteDialect = dialect{
+		name:   "sqlite",
+		driver: "sqlite3",
+	}
+	postgresDialect = dialect{
+		name:          "postgres",
+		driver:        "postgres",
+		positional:    true,
+		migrationLock: "SELECT pg_advisory_xact_lock(7283017)",
+		skipLocked:    " FOR UPDATE SKIP LOCKED",
+	}
+)
+
+func (d dialect) bind(query string) string {
+	if !d.positional {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// migrations는 순서대로 한 번씩만 적용되며, 이미 배포된 항목은 수정하지 않고 뒤에 추가만 함
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+		key        TEXT   PRIMARY KEY,
+		value      TEXT   NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS ` + tableName + `_expires_at_idx ON ` + tableName + ` (expires_at)`,
+	`CREATE TABLE IF NOT EXISTS ` + queueTableName + ` (
+		queue  TEXT   NOT NULL,
+		member TEXT   NOT NULL,
+		due_at BIGINT NOT NULL,
+		PRIMARY KEY (queue, member)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ` + queueTableName + `_due_at_idx ON ` + queueTableName + ` (queue, due_at)`,
+}
+
+func migrate(ctx context.Context, db *dbsql.DB, d dialect) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS mapae_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT  NOT NULL
+	)`); err != nil {
+		return err
+	}
+	for i, stmt := range migrations {
+		if err := applyMigration(ctx, db, d, i+1, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *dbsql.DB, d dialect, version int, stmt string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if d.migrationLock != "" {
+		if _, err := tx.ExecContext(ctx, d.migrationLock); err != nil {
+			return err
+		}
+	}
+	var applied int
+	if err := tx.QueryRowContext(ctx,
+		d.bind("SELECT COUNT(*) FROM mapae_schema_migrations WHERE version = ?"),
+		version,
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		d.bind("INSERT INTO mapae_schema_migrations (version, applied_at) VALUES (?, ?)"),
+		version, time.Now().Unix(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel은 PostgreSQL에서 모든 발행을 실어 나르는 단일 LISTEN 채널
+// 구독마다 LISTEN 커넥션을 열지 않도록 인스턴스당 하나의 리스너가 받아 지역 구독자에게 나눠줌
+const notifyChannel = "mapae_events"
+
+// startListener는 PostgreSQL LISTEN 커넥션을 열고 알림을 c.bus로 전달하는 루프를 시작
+func (c *Client) startListener(source string) error {
+	listener := pq.NewListener(source, 100*time.Millisecond, time.Minute, nil)
+	if err := listener.Listen(notifyChannel); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	c.listener = listener
+	c.listenerDone = make(chan struct{})
+	go c.notifyLoop()
+	return nil
+}
+
+func (c *Client) notifyLoop() {
+	defer close(c.listenerDone)
+	for n := range c.listener.Notify {
+		// 재연결 직후에는 nil이 전달되며, 끊긴 동안의 알림은 복구되지 않음
+		if n == nil {
+			continue
+		}
+		channel, message, ok := strings.Cut(n.Extra, "\n")
+		if !ok {
+			continue
+		}
+		c.bus.Publish(channel, message)
+	}
+}
+
+// Publish는 PostgreSQL이면 NOTIFY로 모든 인스턴스에, SQLite면 같은 프로세스의 구독자에게만 전달
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	if c.listener == nil {
+		c.bus.Publish(channel, message)
+		return nil
+	}
+	_, err := c.db.ExecContext(ctx, c.dialect.bind("SELECT pg_notify(?, ?)"), notifyChannel, channel+"\n"+message)
+	return err
+}
+
+func (c *Client) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	return c.bus.Subscribe(ctx, channel), nil
+}
+
+func (c *Client) closeListener() error {
+	if c.listener == nil {
+		return nil
+	}
+	err := c.listener.Close()
+	<-c.listenerDone
+	return err
+}
@@ -0,0 +1,165 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapae/internal/storage"
+	"mapae/internal/storage/storagetest"
+)
+
+// postgresDSNEnv는 PostgreSQL 테스트가 쓸 DB 주소. 비어 있으면 PostgreSQL 테스트를 건너뜀
+const postgresDSNEnv = "MAPAE_TEST_POSTGRES_DSN"
+
+// postgresSchemaDSN은 테스트마다 새 스키마를 만들고 search_path로 그 스키마를 쓰는 DSN
+// 스키마는 테스트가 끝나면 삭제
+func postgresSchemaDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	db, err := dbsql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	schema := fmt.Sprintf("mapae_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		_ = db.Close()
+		t.Fatalf("create schema error = %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		_ = db.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func newPostgresClient(t *testing.T, dsn string) *Client {
+	t.Helper()
+	c, err := New(dsn)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestPostgresConformance(t *testing.T) {
+	if os.Getenv(postgresDSNEnv) == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	storagetest.Run(t, func(t *testing.T) (storage.Store, func(time.Duration)) {
+		return newPostgresClient(t, postgresSchemaDSN(t)), nil
+	})
+}
+
+// 여러 인스턴스가 동시에 기동해도 advisory lock으로 마이그레이션이 한 번씩만 적용되어야 함
+func TestPostgresConcurrentMigration(t *testing.T) {
+	dsn := postgresSchemaDSN(t)
+
+	const instances = 8
+	clients := make([]*Client, instances)
+	errs := make([]error, instances)
+	var wg sync.WaitGroup
+	wg.Add(instances)
+	for i := 0; i < instances; i++ {
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = New(dsn)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("New() #%d error = %v", i, err)
+		}
+		c := clients[i]
+		t.Cleanup(func() { _ = c.Close() })
+	}
+
+	var versions int
+	if err := clients[0].db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM mapae_schema_migrations").Scan(&versions); err != nil {
+		t.Fatalf("count migrations error = %v", err)
+	}
+	if versions != len(migrations) {
+		t.Fatalf("applied migrations = %d, want %d", versions, len(migrations))
+	}
+}
+
+// DELETE ... RETURNING은 커넥션 풀이 다른 두 인스턴스 사이에서도 한 번만 값을 돌려줘야 함
+func TestPostgresTakeIsAtomicAcrossInstances(t *testing.T) {
+	dsn := postgresSchemaDSN(t)
+	a, b := newPostgresClient(t, dsn), newPostgresClient(t, dsn)
+	ctx := context.Background()
+	if err := a.SetEx(ctx, "nonce", "auth-id", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	const workers = 32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	var successCount int32
+	for i := 0; i < workers; i++ {
+		c := a
+		if i%2 == 1 {
+			c = b
+		}
+		go func() {
+			defer wg.Done()
+			_, ok, err := c.Take(ctx, "nonce")
+			if err != nil {
+				t.Errorf("Take() error = %v", err)
+				return
+			}
+			if ok {
+				atomic.AddInt32(&successCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&successCount); got != 1 {
+		t.Fatalf("successful Take count = %d, want 1", got)
+	}
+}
+
+// 한 인스턴스의 발행은 LISTEN/NOTIFY로 다른 인스턴스의 구독자에게 전달되어야 함
+func TestPostgresPublishAcrossInstances(t *testing.T) {
+	dsn := postgresSchemaDSN(t)
+	publisher, subscriber := newPostgresClient(t, dsn), newPostgresClient(t, dsn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	channel := fmt.Sprintf("auth:%d", time.Now().UnixNano())
+	messages, err := subscriber.Subscribe(ctx, channel)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := publisher.Publish(ctx, channel, "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "verified" {
+			t.Fatalf("message = %q, want verified", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("subscriber did not receive message")
+	}
+}
@@ -0,0 +1,823 @@
+// Package storagetest는 storage.Store 구현이 공통으로 지켜야 할 동작을 검증하는 테스트 모음
+//
+// 새 저장소는 자신의 테스트에서 Run을 호출해 기존 구현(memory, redis, sql)과 같은 의미를 갖는지 확인
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapae/internal/storage"
+)
+
+// Factory는 하위 테스트마다 비어 있는 새 저장소를 만듦(정리는 t.Cleanup으로 등록)
+//
+// advance는 저장소가 보는 시간을 d만큼 진행시키며, 시계를 조작할 수 없는 저장소는 nil을 반환하면 실제로 기다림
+type Factory func(t *testing.T) (store storage.Store, advance func(d time.Duration))
+
+// Run은 모든 적합성 테스트를 하위 테스트로 실행
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newStore Factory)
+	}{
+		{"SetExGetTake", testSetExGetTake},
+		{"SetExOverwrites", testSetExOverwrites},
+		{"TTLExpiry", testTTLExpiry},
+		{"NonPositiveTTL", testNonPositiveTTL},
+		{"MSetEx", testMSetEx},
+		{"AddEx", testAddEx},
+		{"AddExExactlyOnce", testAddExExactlyOnce},
+		{"IncrEx", testIncrEx},
+		{"IncrExConcurrent", testIncrExConcurrent},
+		{"SlidingIncrEx", testSlidingIncrEx},
+		{"SlidingIncrExConcurrent", testSlidingIncrExConcurrent},
+		{"TakeExactlyOnce", testTakeExactlyOnce},
+		{"TakeAndSetEx", testTakeAndSetEx},
+		{"TakeAndSetExExactlyOnce", testTakeAndSetExExactlyOnce},
+		{"LargeValue", testLargeValue},
+		{"CanceledContext", testCanceledContext},
+		{"PublishSubscribe", testPublishSubscribe},
+		{"Schedule", testSchedule},
+		{"ClaimDueExactlyOnce", testClaimDueExactlyOnce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore)
+		})
+	}
+}
+
+func open(t *testing.T, newStore Factory) (storage.Store, func(d time.Duration)) {
+	t.Helper()
+	store, advance := newStore(t)
+	if advance == nil {
+		advance = time.Sleep
+	}
+	return store, advance
+}
+
+func testSetExGetTake(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if _, ok, err := store.Get(ctx, "missing"); err != nil || ok {
+		t.Fatalf("Get(missing) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.TTL(ctx, "missing"); err != nil || ok {
+		t.Fatalf("TTL(missing) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.Take(ctx, "missing"); err != nil || ok {
+		t.Fatalf("Take(missing) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+
+	if err := store.SetEx(ctx, "auth:a", "v", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if got, ok, err := store.Get(ctx, "auth:a"); err != nil || !ok || got != "v" {
+		t.Fatalf("Get() = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+	// Get은 값을 지우지 않음
+	if got, ok, err := store.Get(ctx, "auth:a"); err != nil || !ok || got != "v" {
+		t.Fatalf("second Get() = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+	if got, ok, err := store.Take(ctx, "auth:a"); err != nil || !ok || got != "v" {
+		t.Fatalf("Take() = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "auth:a"); err != nil || ok {
+		t.Fatalf("Get() after Take = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.Take(ctx, "auth:a"); err != nil || ok {
+		t.Fatalf("second Take() = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func testSetExOverwrites(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "auth:a", "old", 5); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := store.SetEx(ctx, "auth:a", "new", 60); err != nil {
+		t.Fatalf("second SetEx() error = %v", err)
+	}
+	if got, ok, err := store.Get(ctx, "auth:a"); err != nil || !ok || got != "new" {
+		t.Fatalf("Get() = (%q,%t,%v), want (new,true,nil)", got, ok, err)
+	}
+	// 덮어쓰면 만료 시각도 새 TTL 기준으로 바뀜
+	if ttl, ok, err := store.TTL(ctx, "auth:a"); err != nil || !ok || ttl <= 5*time.Second || ttl > 60*time.Second {
+		t.Fatalf("TTL() = (%s,%t,%v), want (5s,60s]", ttl, ok, err)
+	}
+}
+
+func testTTLExpiry(t *testing.T, newStore Factory) {
+	store, advance := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "auth:short", "v", 1); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if err := store.SetEx(ctx, "auth:long", "v", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if ttl, ok, err := store.TTL(ctx, "auth:short"); err != nil || !ok || ttl <= 0 || ttl > time.Second {
+		t.Fatalf("TTL() = (%s,%t,%v), want (0s,1s]", ttl, ok, err)
+	}
+
+	advance(1100 * time.Millisecond)
+
+	if _, ok, err := store.Get(ctx, "auth:short"); err != nil || ok {
+		t.Fatalf("Get() after expiry = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.TTL(ctx, "auth:short"); err != nil || ok {
+		t.Fatalf("TTL() after expiry = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.Take(ctx, "auth:short"); err != nil || ok {
+		t.Fatalf("Take() after expiry = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if ok, err := store.TakeAndSetEx(ctx, "auth:short", "v", "auth:target", "v", 60); err != nil || ok {
+		t.Fatalf("TakeAndSetEx() after expiry = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if got, ok, err := store.Get(ctx, "auth:long"); err != nil || !ok || got != "v" {
+		t.Fatalf("Get() of unexpired key = (%q,%t,%v), want (v,true,nil)", got, ok, err)
+	}
+
+	// 만료된 키에 다시 쓰면 새 항목으로 취급
+	if err := store.SetEx(ctx, "auth:short", "again", 60); err != nil {
+		t.Fatalf("SetEx() after expiry error = %v", err)
+	}
+	if got, ok, err := store.Get(ctx, "auth:short"); err != nil || !ok || got != "again" {
+		t.Fatalf("Get() after rewrite = (%q,%t,%v), want (again,true,nil)", got, ok, err)
+	}
+}
+
+func testNonPositiveTTL(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "nonce:a", "auth-a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	for _, ttl := range []int{0, -1} {
+		if err := store.SetEx(ctx, "auth:a", "v", ttl); err == nil {
+			t.Fatalf("SetEx(ttl=%d) should fail", ttl)
+		}
+		if _, ok, err := store.Get(ctx, "auth:a"); err != nil || ok {
+			t.Fatalf("Get() after SetEx(ttl=%d) = (ok=%t, err=%v), want (false, nil)", ttl, ok, err)
+		}
+		// 실패한 TakeAndSetEx는 원본 키를 건드리지 않음
+		if _, err := store.TakeAndSetEx(ctx, "nonce:a", "auth-a", "verified:auth-a", "v", ttl); err == nil {
+			t.Fatalf("TakeAndSetEx(ttl=%d) should fail", ttl)
+		}
+		if got, ok, err := store.Get(ctx, "nonce:a"); err != nil || !ok || got != "auth-a" {
+			t.Fatalf("Get() after TakeAndSetEx(ttl=%d) = (%q,%t,%v), want (auth-a,true,nil)", ttl, got, ok, err)
+		}
+		if _, ok, err := store.Get(ctx, "verified:auth-a"); err != nil || ok {
+			t.Fatalf("target written by TakeAndSetEx(ttl=%d)", ttl)
+		}
+	}
+}
+
+func testMSetEx(t *testing.T, newStore Factory) {
+	store, advance := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.MSetEx(ctx); err != nil {
+		t.Fatalf("MSetEx() without entries error = %v", err)
+	}
+	err := store.MSetEx(ctx,
+		storage.Entry{Key: "auth:a", Value: "pending", TTLSeconds: 60},
+		storage.Entry{Key: "nonce:a", Value: "a", TTLSeconds: 1},
+		storage.Entry{Key: "auth:a", Value: "pending-2", TTLSeconds: 60},
+	)
+	if err != nil {
+		t.Fatalf("MSetEx() error = %v", err)
+	}
+	// 같은 키가 여러 번 있으면 마지막 값이 남음
+	if got, ok, err := store.Get(ctx, "auth:a"); err != nil || !ok || got != "pending-2" {
+		t.Fatalf("Get(auth:a) = (%q,%t,%v), want (pending-2,true,nil)", got, ok, err)
+	}
+	if got, ok, err := store.Get(ctx, "nonce:a"); err != nil || !ok || got != "a" {
+		t.Fatalf("Get(nonce:a) = (%q,%t,%v), want (a,true,nil)", got, ok, err)
+	}
+	// 키마다 자신의 TTL을 가짐
+	advance(1100 * time.Millisecond)
+	if _, ok, err := store.Get(ctx, "nonce:a"); err != nil || ok {
+		t.Fatalf("Get(nonce:a) after expiry = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "auth:a"); err != nil || !ok {
+		t.Fatalf("Get(auth:a) after short ttl = (ok=%t, err=%v), want (true, nil)", ok, err)
+	}
+
+	// 하나라도 잘못되면 아무것도 기록하지 않음
+	err = store.MSetEx(ctx,
+		storage.Entry{Key: "auth:b", Value: "pending", TTLSeconds: 60},
+		storage.Entry{Key: "nonce:b", Value: "b", TTLSeconds: 0},
+	)
+	if err == nil {
+		t.Fatalf("MSetEx() with non-positive ttl should fail")
+	}
+	if _, ok, err := store.Get(ctx, "auth:b"); err != nil || ok {
+		t.Fatalf("Get(auth:b) after failed MSetEx = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func testAddEx(t *testing.T, newStore Factory) {
+	store, advance := open(t, newStore)
+	ctx := context.Background()
+
+	if added, err := store.AddEx(ctx, "nonce:a", "auth-a", 1); err != nil || !added {
+		t.Fatalf("AddEx() = (%t,%v), want (true,nil)", added, err)
+	}
+	// 살아 있는 키는 값도 TTL도 바꾸지 않음
+	if added, err := store.AddEx(ctx, "nonce:a", "auth-b", 60); err != nil || added {
+		t.Fatalf("second AddEx() = (%t,%v), want (false,nil)", added, err)
+	}
+	if got, ok, err := store.Get(ctx, "nonce:a"); err != nil || !ok || got != "auth-a" {
+		t.Fatalf("Get() = (%q,%t,%v), want (auth-a,true,nil)", got, ok, err)
+	}
+	if ttl, ok, err := store.TTL(ctx, "nonce:a"); err != nil || !ok || ttl <= 0 || ttl > time.Second {
+		t.Fatalf("TTL() = (%s,%t,%v), want (0s,1s]", ttl, ok, err)
+	}
+
+	// 만료된 키는 없는 것으로 봄
+	advance(1100 * time.Millisecond)
+	if added, err := store.AddEx(ctx, "nonce:a", "auth-c", 60); err != nil || !added {
+		t.Fatalf("AddEx() after expiry = (%t,%v), want (true,nil)", added, err)
+	}
+	if got, ok, err := store.Get(ctx, "nonce:a"); err != nil || !ok || got != "auth-c" {
+		t.Fatalf("Get() after expiry = (%q,%t,%v), want (auth-c,true,nil)", got, ok, err)
+	}
+
+	for _, ttl := range []int{0, -1} {
+		if _, err := store.AddEx(ctx, "nonce:b", "v", ttl); err == nil {
+			t.Fatalf("AddEx(ttl=%d) should fail", ttl)
+		}
+	}
+	if _, ok, err := store.Get(ctx, "nonce:b"); err != nil || ok {
+		t.Fatalf("Get() after failed AddEx = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func testAddExExactlyOnce(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	const workers = 32
+	var added atomic.Int32
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, err := store.AddEx(ctx, "nonce:shared", fmt.Sprintf("auth-%d", w), 60)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ok {
+				added.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("AddEx() error = %v", err)
+	}
+	if n := added.Load(); n != 1 {
+		t.Fatalf("AddEx() succeeded %d times, want exactly once", n)
+	}
+}
+
+func testIncrEx(t *testing.T, newStore Factory) {
+	store, advance := open(t, newStore)
+	ctx := context.Background()
+
+	if n, err := store.IncrEx(ctx, "ratelimit:a", 1, 1); err != nil || n != 1 {
+		t.Fatalf("IncrEx() = (%d,%v), want (1,nil)", n, err)
+	}
+	// 이후 증가는 처음 정한 만료를 바꾸지 않음
+	if n, err := store.IncrEx(ctx, "ratelimit:a", 2, 60); err != nil || n != 3 {
+		t.Fatalf("second IncrEx() = (%d,%v), want (3,nil)", n, err)
+	}
+	if got, ok, err := store.Get(ctx, "ratelimit:a"); err != nil || !ok || got != "3" {
+		t.Fatalf("Get() = (%q,%t,%v), want (3,true,nil)", got, ok, err)
+	}
+	if ttl, ok, err := store.TTL(ctx, "ratelimit:a"); err != nil || !ok || ttl <= 0 || ttl > time.Second {
+		t.Fatalf("TTL() = (%s,%t,%v), want (0s,1s]", ttl, ok, err)
+	}
+	if n, err := store.IncrEx(ctx, "ratelimit:a", -1, 60); err != nil || n != 2 {
+		t.Fatalf("IncrEx(-1) = (%d,%v), want (2,nil)", n, err)
+	}
+
+	// 만료되면 0에서 다시 시작하고 새 TTL을 가짐
+	advance(1100 * time.Millisecond)
+	if n, err := store.IncrEx(ctx, "ratelimit:a", 1, 60); err != nil || n != 1 {
+		t.Fatalf("IncrEx() after expiry = (%d,%v), want (1,nil)", n, err)
+	}
+	if ttl, ok, err := store.TTL(ctx, "ratelimit:a"); err != nil || !ok || ttl <= time.Second || ttl > 60*time.Second {
+		t.Fatalf("TTL() after expiry = (%s,%t,%v), want (1s,60s]", ttl, ok, err)
+	}
+
+	for _, ttl := range []int{0, -1} {
+		if _, err := store.IncrEx(ctx, "ratelimit:b", 1, ttl); err == nil {
+			t.Fatalf("IncrEx(ttl=%d) should fail", ttl)
+		}
+	}
+	if _, ok, err := store.Get(ctx, "ratelimit:b"); err != nil || ok {
+		t.Fatalf("Get() after failed IncrEx = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func testIncrExConcurrent(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	const workers = 16
+	const perWorker = 25
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perWorker; i++ {
+				n, err := store.IncrEx(ctx, "ratelimit:shared", 1, 60)
+				if err != nil {
+					errs <- err
+					return
+				}
+				mu.Lock()
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("IncrEx() error = %v", err)
+	}
+	// 모든 증가가 서로 다른 결과를 받아야 함
+	if len(seen) != workers*perWorker {
+		t.Fatalf("IncrEx() returned %d distinct values, want %d", len(seen), workers*perWorker)
+	}
+	if got, ok, err := store.Get(ctx, "ratelimit:shared"); err != nil || !ok || got != fmt.Sprint(workers*perWorker) {
+		t.Fatalf("Get() = (%q,%t,%v), want (%d,true,nil)", got, ok, err, workers*perWorker)
+	}
+}
+
+func testSlidingIncrEx(t *testing.T, newStore Factory) {
+	store, advance := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "ratelimit:prev", "4", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	// 직전 윈도 4 * 0.5 = 2이므로 한도 5 안에 3개까지 더함
+	for want := int64(1); want <= 3; want++ {
+		current, previous, added, err := store.SlidingIncrEx(ctx, "ratelimit:cur", "ratelimit:prev", 0.5, 5, 1)
+		if err != nil || !added || current != want || previous != 4 {
+			t.Fatalf("SlidingIncrEx() #%d = (%d,%d,%t,%v), want (%d,4,true,nil)", want, current, previous, added, err, want)
+		}
+	}
+	current, previous, added, err := store.SlidingIncrEx(ctx, "ratelimit:cur", "ratelimit:prev", 0.5, 5, 60)
+	if err != nil || added || current != 3 || previous != 4 {
+		t.Fatalf("SlidingIncrEx() over the limit = (%d,%d,%t,%v), want (3,4,false,nil)", current, previous, added, err)
+	}
+	if got, ok, err := store.Get(ctx, "ratelimit:cur"); err != nil || !ok || got != "3" {
+		t.Fatalf("Get() = (%q,%t,%v), want (3,true,nil)", got, ok, err)
+	}
+	// 처음 정한 만료를 유지하므로 만료되면 0에서 다시 시작
+	advance(1100 * time.Millisecond)
+	if current, _, added, err := store.SlidingIncrEx(ctx, "ratelimit:cur", "ratelimit:prev", 0, 5, 60); err != nil || !added || current != 1 {
+		t.Fatalf("SlidingIncrEx() after expiry = (%d,%t,%v), want (1,true,nil)", current, added, err)
+	}
+
+	// 한도가 직전 윈도만으로 차 있으면 키를 만들지 않음
+	if _, _, added, err := store.SlidingIncrEx(ctx, "ratelimit:none", "ratelimit:prev", 1.5, 5, 60); err != nil || added {
+		t.Fatalf("SlidingIncrEx() with a full previous window = (added=%t, err=%v), want (false, nil)", added, err)
+	}
+	if _, ok, err := store.Get(ctx, "ratelimit:none"); err != nil || ok {
+		t.Fatalf("Get() after a rejected SlidingIncrEx = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, _, _, err := store.SlidingIncrEx(ctx, "ratelimit:none", "ratelimit:prev", 0, 5, 0); err == nil {
+		t.Fatal("SlidingIncrEx(ttl=0) should fail")
+	}
+}
+
+// 동시에 호출해도 한도를 넘겨 더하지 않아야 함
+func testSlidingIncrExConcurrent(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	const workers = 16
+	const perWorker = 10
+	const limit = 50
+	var added atomic.Int64
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perWorker; i++ {
+				_, _, ok, err := store.SlidingIncrEx(ctx, "ratelimit:shared", "ratelimit:shared-prev", 0.5, limit, 60)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if ok {
+					added.Add(1)
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("SlidingIncrEx() error = %v", err)
+	}
+	if n := added.Load(); n != limit {
+		t.Fatalf("SlidingIncrEx() added %d times, want %d", n, limit)
+	}
+	if got, ok, err := store.Get(ctx, "ratelimit:shared"); err != nil || !ok || got != fmt.Sprint(limit) {
+		t.Fatalf("Get() = (%q,%t,%v), want (%d,true,nil)", got, ok, err, limit)
+	}
+}
+
+func testTakeExactlyOnce(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	const keys = 20
+	const workers = 32
+	for i := 0; i < keys; i++ {
+		if err := store.SetEx(ctx, fmt.Sprintf("nonce:%02d", i), fmt.Sprintf("v%d", i), 60); err != nil {
+			t.Fatalf("SetEx() error = %v", err)
+		}
+	}
+
+	var taken [keys]atomic.Int32
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < keys; i++ {
+				value, ok, err := store.Take(ctx, fmt.Sprintf("nonce:%02d", i))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if ok {
+					if want := fmt.Sprintf("v%d", i); value != want {
+						errs <- fmt.Errorf("Take() = %q, want %q", value, want)
+						return
+					}
+					taken[i].Add(1)
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Take() error = %v", err)
+	}
+	for i := range taken {
+		if n := taken[i].Load(); n != 1 {
+			t.Fatalf("key %d taken %d times, want 1", i, n)
+		}
+	}
+}
+
+func testTakeAndSetEx(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	if ok, err := store.TakeAndSetEx(ctx, "nonce:missing", "auth-a", "verified:auth-a", "v", 60); err != nil || ok {
+		t.Fatalf("TakeAndSetEx(missing) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if err := store.SetEx(ctx, "nonce:a", "auth-a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	// 값이 expected와 다르면 아무것도 쓰지 않음
+	if ok, err := store.TakeAndSetEx(ctx, "nonce:a", "auth-b", "verified:auth-b", "payload", 30); err != nil || ok {
+		t.Fatalf("TakeAndSetEx(other value) = (ok=%t, err=%v), want (false, nil)", ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "verified:auth-b"); err != nil || ok {
+		t.Fatalf("target written by TakeAndSetEx(other value), ok=%t err=%v", ok, err)
+	}
+	if ok, err := store.TakeAndSetEx(ctx, "nonce:a", "auth-a", "verified:auth-a", "payload", 30); err != nil || !ok {
+		t.Fatalf("TakeAndSetEx() = (%t,%v), want (true,nil)", ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "nonce:a"); err != nil || ok {
+		t.Fatalf("source key should be removed, ok=%t err=%v", ok, err)
+	}
+	if got, ok, err := store.Get(ctx, "verified:auth-a"); err != nil || !ok || got != "payload" {
+		t.Fatalf("Get(target) = (%q,%t,%v), want (payload,true,nil)", got, ok, err)
+	}
+	if ttl, ok, err := store.TTL(ctx, "verified:auth-a"); err != nil || !ok || ttl <= 0 || ttl > 30*time.Second {
+		t.Fatalf("TTL(target) = (%s,%t,%v), want (0s,30s]", ttl, ok, err)
+	}
+}
+
+func testTakeAndSetExExactlyOnce(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	if err := store.SetEx(ctx, "nonce:a", "auth-a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	const workers = 32
+	var wins atomic.Int32
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			<-start
+			ok, err := store.TakeAndSetEx(ctx, "nonce:a", "auth-a", "verified:auth-a", fmt.Sprintf("worker-%d", w), 60)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ok {
+				wins.Add(1)
+			}
+		}(w)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("TakeAndSetEx() error = %v", err)
+	}
+	if n := wins.Load(); n != 1 {
+		t.Fatalf("TakeAndSetEx() succeeded %d times, want 1", n)
+	}
+	if got, ok, err := store.Get(ctx, "verified:auth-a"); err != nil || !ok || !strings.HasPrefix(got, "worker-") {
+		t.Fatalf("Get(target) = (%q,%t,%v), want a worker payload", got, ok, err)
+	}
+}
+
+func testLargeValue(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+
+	// 1 MiB, 바이트 단위로 보존되는지 확인하기 위해 반복되지 않는 패턴 사용
+	var b strings.Builder
+	for i := 0; b.Len() < 1<<20; i++ {
+		fmt.Fprintf(&b, "%08x", i)
+	}
+	large := b.String()
+
+	if err := store.SetEx(ctx, "auth:large", large, 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+	if got, ok, err := store.Get(ctx, "auth:large"); err != nil || !ok || got != large {
+		t.Fatalf("Get() = (len=%d,%t,%v), want (len=%d,true,nil)", len(got), ok, err, len(large))
+	}
+	if got, ok, err := store.Take(ctx, "auth:large"); err != nil || !ok || got != large {
+		t.Fatalf("Take() = (len=%d,%t,%v), want (len=%d,true,nil)", len(got), ok, err, len(large))
+	}
+}
+
+func testCanceledContext(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	if err := store.SetEx(context.Background(), "nonce:a", "auth-a", 60); err != nil {
+		t.Fatalf("SetEx() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checks := map[string]error{
+		"Ping":   store.Ping(ctx),
+		"SetEx":  store.SetEx(ctx, "auth:a", "v", 60),
+		"MSetEx": store.MSetEx(ctx, storage.Entry{Key: "auth:a", Value: "v", TTLSeconds: 60}),
+	}
+	_, _, checks["Get"] = store.Get(ctx, "nonce:a")
+	_, _, checks["TTL"] = store.TTL(ctx, "nonce:a")
+	_, _, checks["Take"] = store.Take(ctx, "nonce:a")
+	_, checks["AddEx"] = store.AddEx(ctx, "auth:a", "v", 60)
+	_, checks["IncrEx"] = store.IncrEx(ctx, "ratelimit:a", 1, 60)
+	_, checks["TakeAndSetEx"] = store.TakeAndSetEx(ctx, "nonce:a", "auth-a", "verified:auth-a", "v", 60)
+	checks["Schedule"] = store.Schedule(ctx, "queue:a", "m", time.Now())
+	_, checks["ClaimDue"] = store.ClaimDue(ctx, "queue:a", time.Now(), time.Minute, 10)
+	checks["Unschedule"] = store.Unschedule(ctx, "queue:a", "m")
+	for op, err := range checks {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s() with canceled context error = %v, want context.Canceled", op, err)
+		}
+	}
+
+	// 취소된 요청은 상태를 바꾸지 않음
+	ctx = context.Background()
+	if got, ok, err := store.Get(ctx, "nonce:a"); err != nil || !ok || got != "auth-a" {
+		t.Fatalf("Get() = (%q,%t,%v), want (auth-a,true,nil)", got, ok, err)
+	}
+	for _, key := range []string{"auth:a", "verified:auth-a"} {
+		if _, ok, err := store.Get(ctx, key); err != nil || ok {
+			t.Fatalf("Get(%s) = (ok=%t, err=%v), want (false, nil)", key, ok, err)
+		}
+	}
+	if members, err := store.ClaimDue(ctx, "queue:a", time.Now(), time.Minute, 10); err != nil || len(members) != 0 {
+		t.Fatalf("ClaimDue() = (%v, %v), want nothing scheduled", members, err)
+	}
+}
+
+func testPublishSubscribe(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := store.Subscribe(ctx, "auth:a")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	other, err := store.Subscribe(ctx, "auth:b")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := store.Publish(ctx, "auth:a", "verified"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "verified" {
+			t.Fatalf("message = %q, want verified", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("subscriber did not receive message")
+	}
+	select {
+	case msg := <-other:
+		t.Fatalf("subscriber of another channel received %q", msg)
+	default:
+	}
+
+	cancel()
+	for _, ch := range []<-chan string{messages, other} {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatalf("channel should be closed after cancel")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("channel was not closed after cancel")
+		}
+	}
+}
+
+func testSchedule(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+	now := time.Now()
+
+	claim := func(at time.Time, limit int) []string {
+		t.Helper()
+		members, err := store.ClaimDue(ctx, "queue:a", at, 30*time.Second, limit)
+		if err != nil {
+			t.Fatalf("ClaimDue() error = %v", err)
+		}
+		sort.Strings(members)
+		return members
+	}
+
+	if got := claim(now, 10); len(got) != 0 {
+		t.Fatalf("ClaimDue() on empty queue = %v", got)
+	}
+	for member, at := range map[string]time.Time{"a": now.Add(-2 * time.Second), "b": now.Add(-time.Second), "c": now.Add(time.Hour)} {
+		if err := store.Schedule(ctx, "queue:a", member, at); err != nil {
+			t.Fatalf("Schedule(%s) error = %v", member, err)
+		}
+	}
+	if err := store.Schedule(ctx, "queue:b", "a", now.Add(-time.Second)); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	// 가장 이른 항목부터 가져옴
+	if got := claim(now, 1); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("ClaimDue(limit=1) = %v, want [a]", got)
+	}
+	if got := claim(now, 10); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("ClaimDue() = %v, want [b]", got)
+	}
+	// 가져간 항목은 lease 동안 다시 나오지 않음
+	if got := claim(now, 10); len(got) != 0 {
+		t.Fatalf("ClaimDue() during lease = %v, want nothing", got)
+	}
+	if got := claim(now.Add(31*time.Second), 10); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("ClaimDue() after lease = %v, want [a b]", got)
+	}
+
+	// 다시 넣으면 처리 시각만 바뀜
+	if err := store.Schedule(ctx, "queue:a", "c", now); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if err := store.Unschedule(ctx, "queue:a", "a"); err != nil {
+		t.Fatalf("Unschedule() error = %v", err)
+	}
+	if err := store.Unschedule(ctx, "queue:a", "missing"); err != nil {
+		t.Fatalf("Unschedule(missing) error = %v", err)
+	}
+	if got := claim(now, 10); !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("ClaimDue() after reschedule = %v, want [c]", got)
+	}
+	if got := claim(now.Add(2*time.Hour), 10); !slices.Equal(got, []string{"b", "c"}) {
+		t.Fatalf("ClaimDue() after unschedule = %v, want [b c]", got)
+	}
+
+	// 다른 queue는 영향받지 않음
+	members, err := store.ClaimDue(ctx, "queue:b", now, 30*time.Second, 10)
+	if err != nil || !slices.Equal(members, []string{"a"}) {
+		t.Fatalf("ClaimDue(queue:b) = (%v, %v), want [a]", members, err)
+	}
+}
+
+func testClaimDueExactlyOnce(t *testing.T, newStore Factory) {
+	store, _ := open(t, newStore)
+	ctx := context.Background()
+	now := time.Now()
+
+	const members = 40
+	const workers = 16
+	for i := 0; i < members; i++ {
+		if err := store.Schedule(ctx, "queue:shared", fmt.Sprintf("m%02d", i), now.Add(-time.Second)); err != nil {
+			t.Fatalf("Schedule() error = %v", err)
+		}
+	}
+
+	var claimed [members]atomic.Int32
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for {
+				got, err := store.ClaimDue(ctx, "queue:shared", now, time.Minute, 3)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(got) == 0 {
+					return
+				}
+				for _, member := range got {
+					var i int
+					if _, err := fmt.Sscanf(member, "m%02d", &i); err != nil {
+						errs <- fmt.Errorf("ClaimDue() returned %q", member)
+						return
+					}
+					claimed[i].Add(1)
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("ClaimDue() error = %v", err)
+	}
+	for i := range claimed {
+		if n := claimed[i].Load(); n != 1 {
+			t.Fatalf("member %d claimed %d times, want 1", i, n)
+		}
+	}
+}
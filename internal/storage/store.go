@@ -1,10 +1,60 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidArgument는 저장소에 닿기 전에 거부한 잘못된 인자(양수가 아닌 TTL 등)
+// 호출자의 잘못이므로 차단기가 저장소 장애로 세지 않음
+var ErrInvalidArgument = errors.New("invalid storage argument")
+
+// InvalidTTL은 ttlSeconds가 양수가 아닐 때 반환하는 ErrInvalidArgument 오류
+func InvalidTTL(ttlSeconds int) error {
+	return fmt.Errorf("%w: ttl must be positive: %d", ErrInvalidArgument, ttlSeconds)
+}
+
+// Entry는 MSetEx로 기록할 키와 값, 만료 시간(초)
+type Entry struct {
+	Key        string
+	Value      string
+	TTLSeconds int
+}
 
 type Store interface {
 	Ping(ctx context.Context) error
 	Get(ctx context.Context, key string) (string, bool, error)
+	// TTL은 key가 만료되기까지 남은 시간을 반환하며, key가 없으면 ok=false
+	TTL(ctx context.Context, key string) (time.Duration, bool, error)
 	Take(ctx context.Context, key string) (string, bool, error)
 	SetEx(ctx context.Context, key, value string, ttlSeconds int) error
+	// MSetEx는 entries를 모두 기록하거나 하나도 기록하지 않으며, 가능한 한 저장소 왕복 1회로 처리
+	// 같은 키가 여러 번 있으면 마지막 값이 남음
+	MSetEx(ctx context.Context, entries ...Entry) error
+	// AddEx는 key가 없거나 만료되었을 때만 기록하며, 기록했으면 true
+	AddEx(ctx context.Context, key, value string, ttlSeconds int) (bool, error)
+	// IncrEx는 key의 정수 값에 delta를 더한 결과를 반환
+	// key가 없거나 만료되었으면 0에서 시작해 ttlSeconds 뒤에 만료되도록 만들며, 이미 있으면 남은 TTL을 유지
+	IncrEx(ctx context.Context, key string, delta int64, ttlSeconds int) (int64, error)
+	// SlidingIncrEx는 key 값 + 1 + prev 값 * prevWeight가 limit 이하일 때만 key에 1을 더하는 작업을 한 번에 수행하며, 더했으면 added=true
+	// key 값(더했으면 더한 뒤)과 prev 값을 반환하며, key의 만료는 IncrEx와 같이 처리
+	SlidingIncrEx(ctx context.Context, key, prev string, prevWeight float64, limit int64, ttlSeconds int) (current, previous int64, added bool, err error)
+	// TakeAndSetEx는 key의 값이 expected이면 key를 삭제하고 target에 value를 기록하는 작업을 한 번에 수행
+	// key가 없거나 값이 다르면 아무것도 쓰지 않고 false, 기록에 실패하면 key는 그대로 남음
+	TakeAndSetEx(ctx context.Context, key, expected, target, value string, ttlSeconds int) (bool, error)
+	// Publish는 channel을 구독 중인 모든 인스턴스에 message를 보냄(전달 보장 없음)
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe는 ctx가 끝날 때까지 channel로 발행된 메시지를 받는 채널을 반환하며, ctx가 끝나면 채널을 닫음
+	// 반환 시점 이후에 발행된 메시지만 받으며, 수신이 밀리면 메시지가 버려질 수 있음
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
+	// Schedule은 queue에 member를 at에 처리할 항목으로 넣으며, 이미 있으면 처리 시각만 바꿈
+	// queue 항목은 만료되지 않으므로 처리를 마치면 Unschedule로 지워야 함(시각은 밀리초 단위로 저장)
+	Schedule(ctx context.Context, queue, member string, at time.Time) error
+	// ClaimDue는 queue에서 처리 시각이 now 이전인 항목을 이른 것부터 limit개까지 가져오고, 그 처리 시각을 now+lease로 미룸
+	// 동시에 호출해도 한 항목은 한 호출에만 돌아가며, 가져간 쪽이 Unschedule하지 않으면 lease 뒤 다시 나옴(반환 순서는 정하지 않음)
+	ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]string, error)
+	// Unschedule은 queue에서 member를 지우며, 없으면 아무것도 하지 않음
+	Unschedule(ctx context.Context, queue, member string) error
 }
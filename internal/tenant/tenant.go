@@ -0,0 +1,168 @@
+// Package tenant는 MAPAE를 함께 쓰는 등록된 클라이언트(테넌트)와 API 키
+package tenant
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"mapae/internal/config"
+)
+
+// Client는 등록된 클라이언트. 0 또는 빈 값인 설정은 전역 설정을 따름
+type Client struct {
+	ID string `json:"id"`
+	// APIKeyHashes는 API 키의 SHA-256(16진수). 키를 교체하는 동안에는 여러 개를 둠
+	APIKeyHashes []string `json:"api_key_hashes"`
+
+	JWTIssuer          string   `json:"jwt_issuer,omitempty"`
+	JWTAudience        string   `json:"jwt_audience,omitempty"`
+	JWTTTLSeconds      int      `json:"jwt_ttl_seconds,omitempty"`
+	AuthTTLSeconds     int      `json:"auth_ttl_seconds,omitempty"`
+	VerifiedTTLSeconds int      `json:"verified_ttl_seconds,omitempty"`
+	CORSAllowOrigins   []string `json:"cors_allow_origins,omitempty"`
+	// WebhookURL은 /auth/init에서 webhook_url을 주지 않은 세션의 결과를 받을 주소
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// WebhookSecrets는 이 클라이언트의 웹훅 서명 키. 없으면 이 클라이언트의 세션은 웹훅을 보내지 않음
+	WebhookSecrets   []string `json:"webhook_secrets,omitempty"`
+	SMSTemplateDir   string   `json:"sms_template_dir,omitempty"`
+	SMSDefaultLocale string   `json:"sms_default_locale,omitempty"`
+}
+
+// Settings는 base에 c의 설정을 덮어쓴 사본
+// 웹훅 주소와 서명 키는 auth 서비스가 클라이언트별로 직접 다루므로 덮어쓰지 않음
+func (c *Client) Settings(base *config.Settings) *config.Settings {
+	settings := *base
+	if c.JWTIssuer != "" {
+		settings.JWTIssuer = c.JWTIssuer
+	}
+	if c.JWTAudience != "" {
+		settings.JWTAudience = c.JWTAudience
+	}
+	if c.JWTTTLSeconds > 0 {
+		settings.JWTTTLSeconds = c.JWTTTLSeconds
+	}
+	if c.AuthTTLSeconds > 0 {
+		settings.AuthTTLSeconds = c.AuthTTLSeconds
+	}
+	if c.VerifiedTTLSeconds > 0 {
+		settings.VerifiedTTLSeconds = c.VerifiedTTLSeconds
+	}
+	if len(c.CORSAllowOrigins) > 0 {
+		settings.CORSAllowOrigins = c.CORSAllowOrigins
+	}
+	if c.SMSTemplateDir != "" {
+		settings.SMSTemplateDir = c.SMSTemplateDir
+	}
+	if c.SMSDefaultLocale != "" {
+		settings.SMSDefaultLocale = c.SMSDefaultLocale
+	}
+	return &settings
+}
+
+var (
+	idRe      = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	keyHashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Registry는 등록된 클라이언트와 API 키 해시로 찾는 색인
+type Registry struct {
+	clients []*Client
+	byHash  map[string]*Client
+}
+
+// clientsFile은 CLIENTS_FILE의 형식
+type clientsFile struct {
+	Clients []Client `json:"clients"`
+}
+
+// Load는 CLIENTS_FILE(JSON)을 읽으며, 모르는 필드는 거부
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file clientsFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return New(file.Clients)
+}
+
+// New는 clients를 확인해 Registry를 만듦. ID나 API 키 해시가 겹치면 오류
+func New(clients []Client) (*Registry, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("no clients registered")
+	}
+	r := &Registry{byHash: make(map[string]*Client)}
+	ids := make(map[string]bool, len(clients))
+	for i := range clients {
+		client := clients[i]
+		if !idRe.MatchString(client.ID) {
+			return nil, fmt.Errorf("client id %q must be 1-64 letters, digits, '_' or '-'", client.ID)
+		}
+		if ids[client.ID] {
+			return nil, fmt.Errorf("duplicate client id %q", client.ID)
+		}
+		ids[client.ID] = true
+		if len(client.APIKeyHashes) == 0 {
+			return nil, fmt.Errorf("client %s: no api_key_hashes", client.ID)
+		}
+		for _, hash := range client.APIKeyHashes {
+			hash = strings.ToLower(strings.TrimSpace(hash))
+			if !keyHashRe.MatchString(hash) {
+				return nil, fmt.Errorf("client %s: api key hash must be 64 hex characters (SHA-256)", client.ID)
+			}
+			if other, ok := r.byHash[hash]; ok {
+				return nil, fmt.Errorf("client %s: api key hash is also registered for client %s", client.ID, other.ID)
+			}
+			r.byHash[hash] = &client
+		}
+		for _, secret := range client.WebhookSecrets {
+			if secret == "" {
+				return nil, fmt.Errorf("client %s: webhook secret is empty", client.ID)
+			}
+		}
+		r.clients = append(r.clients, &client)
+	}
+	return r, nil
+}
+
+// HashAPIKey는 CLIENTS_FILE에 적을 API 키의 해시
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate는 apiKey의 해시로 클라이언트를 찾음
+func (r *Registry) Authenticate(apiKey string) (*Client, bool) {
+	if apiKey == "" {
+		return nil, false
+	}
+	client, ok := r.byHash[HashAPIKey(apiKey)]
+	return client, ok
+}
+
+// Clients는 등록 순서의 클라이언트 목록
+func (r *Registry) Clients() []*Client {
+	return r.clients
+}
+
+// WebhookSecrets는 웹훅 서명 키가 있는 클라이언트의 ID별 키
+func (r *Registry) WebhookSecrets() map[string][]string {
+	secrets := make(map[string][]string)
+	for _, client := range r.clients {
+		if len(client.WebhookSecrets) > 0 {
+			secrets[client.ID] = client.WebhookSecrets
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,94 @@
+package tenant
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mapae/internal/config"
+)
+
+func TestLoadAndAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.json")
+	data := `{"clients": [
+		{"id": "shop", "api_key_hashes": ["` + HashAPIKey("shop-key-new") + `", "` + strings.ToUpper(HashAPIKey("shop-key-old")) + `"], "jwt_audience": "shop", "webhook_secrets": ["shop-secret"]},
+		{"id": "bank", "api_key_hashes": ["` + HashAPIKey("bank-key") + `"]}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	registry, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for key, want := range map[string]string{"shop-key-new": "shop", "shop-key-old": "shop", "bank-key": "bank"} {
+		if client, ok := registry.Authenticate(key); !ok || client.ID != want {
+			t.Fatalf("Authenticate(%q) = (%v, %t), want %s", key, client, ok, want)
+		}
+	}
+	for _, key := range []string{"", "shop", HashAPIKey("shop-key-new")} {
+		if client, ok := registry.Authenticate(key); ok {
+			t.Fatalf("Authenticate(%q) = %s, want no client", key, client.ID)
+		}
+	}
+	if got := len(registry.Clients()); got != 2 {
+		t.Fatalf("len(Clients()) = %d, want 2", got)
+	}
+	if got := registry.WebhookSecrets(); len(got) != 1 || len(got["shop"]) != 1 || got["shop"][0] != "shop-secret" {
+		t.Fatalf("WebhookSecrets() = %v, want only the shop secret", got)
+	}
+}
+
+func TestLoadRejectsInvalidClients(t *testing.T) {
+	hash := HashAPIKey("key")
+	for name, data := range map[string]string{
+		"unknown field":  `{"clients": [{"id": "a", "api_key_hashes": ["` + hash + `"], "jwt_issuers": "x"}]}`,
+		"no clients":     `{"clients": []}`,
+		"invalid id":     `{"clients": [{"id": "a b", "api_key_hashes": ["` + hash + `"]}]}`,
+		"duplicate id":   `{"clients": [{"id": "a", "api_key_hashes": ["` + hash + `"]}, {"id": "a", "api_key_hashes": ["` + HashAPIKey("other") + `"]}]}`,
+		"no keys":        `{"clients": [{"id": "a"}]}`,
+		"plain key":      `{"clients": [{"id": "a", "api_key_hashes": ["key"]}]}`,
+		"shared api key": `{"clients": [{"id": "a", "api_key_hashes": ["` + hash + `"]}, {"id": "b", "api_key_hashes": ["` + hash + `"]}]}`,
+		"empty secret":   `{"clients": [{"id": "a", "api_key_hashes": ["` + hash + `"], "webhook_secrets": [""]}]}`,
+	} {
+		path := filepath.Join(t.TempDir(), "clients.json")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("Load(%s) error = nil", name)
+		}
+	}
+}
+
+func TestClientSettingsOverrideBase(t *testing.T) {
+	base := &config.Settings{
+		JWTIssuer:          "https://issuer.example",
+		JWTTTLSeconds:      3600,
+		AuthTTLSeconds:     600,
+		VerifiedTTLSeconds: 300,
+		CORSAllowOrigins:   []string{"*"},
+		WebhookURL:         "https://global.example/hooks/mapae",
+		SMSDefaultLocale:   "ko",
+	}
+	client := &Client{
+		ID:               "shop",
+		JWTAudience:      "shop",
+		AuthTTLSeconds:   120,
+		CORSAllowOrigins: []string{"https://shop.example"},
+		WebhookURL:       "https://shop.example/hooks/mapae",
+		SMSDefaultLocale: "en",
+	}
+	got := client.Settings(base)
+	if got.JWTIssuer != "https://issuer.example" || got.JWTAudience != "shop" || got.JWTTTLSeconds != 3600 ||
+		got.AuthTTLSeconds != 120 || got.VerifiedTTLSeconds != 300 ||
+		!reflect.DeepEqual(got.CORSAllowOrigins, []string{"https://shop.example"}) ||
+		got.WebhookURL != base.WebhookURL || got.SMSDefaultLocale != "en" {
+		t.Fatalf("Settings() = %#v", got)
+	}
+	if base.AuthTTLSeconds != 600 || base.JWTAudience != "" {
+		t.Fatalf("Settings() modified the base settings: %#v", base)
+	}
+}
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"mapae/internal/auth"
+	"mapae/internal/tenant"
+)
+
+// apiKeyHeader는 클라이언트 API 키를 싣는 헤더
+// CORS에서 Authorization은 Access-Control-Allow-Headers: *로 허용되지 않으므로 별도 헤더를 씀
+const apiKeyHeader = "X-API-Key"
+
+// 요청 처리 중 클라이언트 정보를 담는 echo.Context 키
+const (
+	tenantContextKey  = "mapae.tenant"
+	serviceContextKey = "mapae.auth"
+)
+
+// RequireClients는 /auth/init, 상태 조회, 취소, 웹훅 기록에 registry에 등록된 클라이언트의 API 키를 요구
+func (s *Server) RequireClients(registry *tenant.Registry) {
+	s.clients = registry
+}
+
+// requireClient는 X-API-Key의 클라이언트 서비스로 요청을 처리하게 함
+func (s *Server) requireClient(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.clients == nil {
+			return next(c)
+		}
+		client, ok := s.clients.Authenticate(c.Request().Header.Get(apiKeyHeader))
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, ErrorResponse{Detail: "API 키가 올바르지 않습니다"})
+		}
+		c.Set(tenantContextKey, client.ID)
+		if origin := c.Request().Header.Get("Origin"); origin != "" && !originAllowed(s.clientOrigins(client), origin) {
+			return c.JSON(http.StatusForbidden, ErrorResponse{Detail: "허용되지 않은 Origin 입니다"})
+		}
+		svc, err := s.auth.ForTenant(client.ID)
+		if err != nil {
+			s.logger.Printf("client %s error: %v", client.ID, err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
+		}
+		c.Set(serviceContextKey, svc)
+		return next(c)
+	}
+}
+
+// optionalClient는 X-API-Key가 있을 때만 requireClient처럼 클라이언트를 확인함
+// 헤더를 보낼 수 없는 EventSource를 위한 것으로, 키 없는 요청은 keyless로 처리
+func (s *Server) optionalClient(next echo.HandlerFunc) echo.HandlerFunc {
+	scoped := s.requireClient(next)
+	return func(c echo.Context) error {
+		if s.clients != nil && c.Request().Header.Get(apiKeyHeader) != "" {
+			return scoped(c)
+		}
+		return next(c)
+	}
+}
+
+// keyless는 클라이언트를 등록했는데 API 키 없이 들어온 요청인지 여부
+func (s *Server) keyless(c echo.Context) bool {
+	_, ok := c.Get(tenantContextKey).(string)
+	return s.clients != nil && !ok
+}
+
+// authFor는 요청을 처리할 서비스. 클라이언트를 등록했으면 API 키의 클라이언트 서비스
+func (s *Server) authFor(c echo.Context) *auth.Service {
+	if svc, ok := c.Get(serviceContextKey).(*auth.Service); ok {
+		return svc
+	}
+	return s.auth
+}
+
+// clientOrigins는 client가 CORS를 허용하는 Origin이며, 정하지 않았으면 전역 설정
+func (s *Server) clientOrigins(client *tenant.Client) []string {
+	if len(client.CORSAllowOrigins) > 0 {
+		return client.CORSAllowOrigins
+	}
+	return s.settings.CORSAllowOrigins
+}
+
+// isAllowedOrigin은 origin에 CORS 헤더를 붙일지 여부. 키가 없는 요청(사전 요청 등)은 어느 클라이언트든 허용한 Origin이면 허용
+func (s *Server) isAllowedOrigin(c echo.Context, origin string) bool {
+	if s.clients == nil {
+		return originAllowed(s.settings.CORSAllowOrigins, origin)
+	}
+	if client, ok := s.clients.Authenticate(c.Request().Header.Get(apiKeyHeader)); ok {
+		return originAllowed(s.clientOrigins(client), origin)
+	}
+	if originAllowed(s.settings.CORSAllowOrigins, origin) {
+		return true
+	}
+	for _, client := range s.clients.Clients() {
+		if originAllowed(client.CORSAllowOrigins, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func originAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
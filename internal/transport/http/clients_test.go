@@ -0,0 +1,176 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"mapae/internal/auth"
+	"mapae/internal/tenant"
+)
+
+// makeClientsServer는 shop, bank 두 클라이언트를 등록한 서버. API 키는 "<id>-key"
+func makeClientsServer(t *testing.T) (*Server, *auth.Service) {
+	t.Helper()
+	s, authSvc := makeHTTPServer(t, true)
+	registry, err := tenant.New([]tenant.Client{
+		{ID: "shop", APIKeyHashes: []string{tenant.HashAPIKey("shop-key")}, CORSAllowOrigins: []string{"https://shop.example"}, AuthTTLSeconds: 120},
+		{ID: "bank", APIKeyHashes: []string{tenant.HashAPIKey("bank-key")}},
+	})
+	if err != nil {
+		t.Fatalf("tenant.New() error = %v", err)
+	}
+	if err := authSvc.UseTenants(registry); err != nil {
+		t.Fatalf("UseTenants() error = %v", err)
+	}
+	s.RequireClients(registry)
+	return s, authSvc
+}
+
+func clientRequest(t *testing.T, h http.Handler, method, path, apiKey, origin string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if apiKey != "" {
+		req.Header.Set(apiKeyHeader, apiKey)
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestClientsRequireAPIKey(t *testing.T) {
+	s, authSvc := makeClientsServer(t)
+	h := s.Handler()
+
+	for _, key := range []string{"", "wrong-key"} {
+		if rec := clientRequest(t, h, http.MethodPost, "/auth/init", key, ""); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("POST /auth/init with key %q = %d, want 401", key, rec.Code)
+		}
+	}
+	rec := clientRequest(t, h, http.MethodPost, "/auth/init", "shop-key", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/init = %d, want 200", rec.Code)
+	}
+	var initBody auth.AuthInitResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &initBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if initBody.TTLSeconds != 120 {
+		t.Fatalf("ttl_seconds = %d, want the shop TTL 120", initBody.TTLSeconds)
+	}
+	authID := initBody.AuthID
+
+	if rec := clientRequest(t, h, http.MethodGet, "/auth/check/"+authID, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /auth/check without a key = %d, want 401", rec.Code)
+	}
+	if rec := clientRequest(t, h, http.MethodGet, "/auth/check/"+authID, "shop-key", ""); rec.Code != http.StatusOK {
+		t.Fatalf("GET /auth/check as shop = %d, want 200", rec.Code)
+	}
+	// 다른 클라이언트의 auth_id는 발급한 적 없는 것으로 응답
+	for _, path := range []string{"/auth/check/", "/auth/check-signed/"} {
+		if rec := clientRequest(t, h, http.MethodGet, path+authID, "bank-key", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("GET %s as bank = %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := clientRequest(t, h, http.MethodPost, "/auth/cancel/"+authID, "bank-key", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("POST /auth/cancel as bank = %d, want 404", rec.Code)
+	}
+
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initBody.SMSBody)[1]
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := authSvc.VerifyByNonce(context.Background(), nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	rec = clientRequest(t, h, http.MethodGet, "/auth/check-signed/"+authID, "shop-key", "")
+	var signed auth.AuthCheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &signed); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if rec.Code != http.StatusOK || signed.Status != auth.StatusVerified || signed.Token == "" {
+		t.Fatalf("GET /auth/check-signed as shop = %d %+v", rec.Code, signed)
+	}
+}
+
+func TestClientsCORS(t *testing.T) {
+	s, _ := makeClientsServer(t)
+	h := s.Handler()
+
+	// 사전 요청에는 API 키가 없으므로 어느 클라이언트든 허용한 Origin이면 허용
+	for origin, want := range map[string]string{
+		"https://shop.example":    "https://shop.example",
+		"https://allowed.example": "https://allowed.example",
+		"https://evil.example":    "",
+	} {
+		rec := clientRequest(t, h, http.MethodOptions, "/auth/init", "", origin)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Fatalf("OPTIONS from %s: Access-Control-Allow-Origin = %q, want %q", origin, got, want)
+		}
+	}
+
+	rec := clientRequest(t, h, http.MethodPost, "/auth/init", "shop-key", "https://shop.example")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://shop.example" {
+		t.Fatalf("POST /auth/init from the shop origin = %d, Access-Control-Allow-Origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	// shop은 전역 설정의 Origin을 덮어썼으므로 허용하지 않음
+	rec = clientRequest(t, h, http.MethodPost, "/auth/init", "shop-key", "https://allowed.example")
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("POST /auth/init from another origin = %d, Access-Control-Allow-Origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	// bank는 Origin을 정하지 않았으므로 전역 설정을 따름
+	if rec := clientRequest(t, h, http.MethodPost, "/auth/init", "bank-key", "https://allowed.example"); rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/init as bank from the global origin = %d, want 200", rec.Code)
+	}
+}
+
+func TestClientsEventsScope(t *testing.T) {
+	s, authSvc := makeClientsServer(t)
+	h := s.Handler()
+	rec := clientRequest(t, h, http.MethodPost, "/auth/init", "shop-key", "")
+	var initBody auth.AuthInitResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &initBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	authID := initBody.AuthID
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initBody.SMSBody)[1]
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := authSvc.VerifyByNonce(context.Background(), nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+
+	// 인증을 마친 세션은 상태 하나를 보내고 바로 닫으므로 본문에서 data를 읽음
+	status := func(apiKey string) auth.AuthCheckResponse {
+		t.Helper()
+		rec := clientRequest(t, h, http.MethodGet, "/auth/events/"+authID, apiKey, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /auth/events with key %q = %d, want 200", apiKey, rec.Code)
+		}
+		var resp auth.AuthCheckResponse
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &resp); err != nil {
+					t.Fatalf("json.Unmarshal() error = %v", err)
+				}
+			}
+		}
+		return resp
+	}
+	if got := status(""); got.Status != auth.StatusVerified || got.Phone != "" || got.Carrier != "" {
+		t.Fatalf("keyless event = %+v, want the status only", got)
+	}
+	if got := status("shop-key"); got.Status != auth.StatusVerified || got.Phone != phone {
+		t.Fatalf("shop event = %+v, want the full response", got)
+	}
+	if rec := clientRequest(t, h, http.MethodGet, "/auth/events/"+authID, "bank-key", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /auth/events as bank = %d, want 404", rec.Code)
+	}
+	if rec := clientRequest(t, h, http.MethodGet, "/auth/events/"+authID, "wrong-key", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /auth/events with a wrong key = %d, want 401", rec.Code)
+	}
+}
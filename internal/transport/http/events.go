@@ -0,0 +1,142 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"mapae/internal/auth"
+	"mapae/internal/storage"
+)
+
+const (
+	// defaultEventsHeartbeat는 연결을 유지하는 주석을 보내는 간격. 알림이 유실되어도 이 간격으로 상태를 다시 확인함
+	defaultEventsHeartbeat = 10 * time.Second
+	// eventsWriteTimeout은 이벤트 하나를 쓰는 제한 시간. 서버의 WriteTimeout 대신 쓸 때마다 다시 설정함
+	eventsWriteTimeout = 10 * time.Second
+	// eventsRetryMillis는 연결이 끊겼을 때 브라우저가 다시 연결하기까지 기다리는 시간
+	eventsRetryMillis = 3000
+)
+
+// AuthEventsHandler godoc
+// @Summary      인증 상태 스트림
+// @Description  인증 상태를 Server-Sent Events로 전달. 연결하면 현재 상태를 보내고, 바뀔 때마다 event: status로 보냄
+// @Description  waiting 외의 상태를 보내거나 요청이 만료되면 연결을 닫음. 이벤트 ID는 상태 값이며 Last-Event-ID와 같으면 다시 보내지 않음
+// @Description  다시 연결해도 보낼 상태가 없으면 204(브라우저가 다시 연결하지 않음)
+// @Description  클라이언트를 등록했으면 X-API-Key가 있을 때만 그 클라이언트의 세션 전체 응답을, 없으면 상태와 만료 시각만 보냄
+// @Tags         auth
+// @Produce      text/event-stream
+// @Param        auth_id        path      string  true   "인증 ID"
+// @Param        X-API-Key      header    string  false  "클라이언트 API 키"
+// @Param        Last-Event-ID  header    string  false  "마지막으로 받은 이벤트 ID"
+// @Success      200            {object}  auth.AuthCheckResponse
+// @Success      204            "보낼 상태 없음"
+// @Failure      400            {object}  ErrorResponse
+// @Failure      401            {object}  ErrorResponse
+// @Failure      404            {object}  auth.AuthCheckResponse
+// @Failure      500            {object}  ErrorResponse
+// @Failure      503            {object}  ErrorResponse
+// @Router       /auth/events/{auth_id} [get]
+func (s *Server) authEventsHandler(c echo.Context) error {
+	authID := strings.TrimSpace(c.Param("auth_id"))
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	keyless := s.keyless(c)
+	watch, resp, err := watchAuth(ctx, s.authFor(c), authID)
+	if err != nil {
+		return s.eventsError(c, err)
+	}
+	if resp.Status == auth.StatusUnknown {
+		return c.JSON(http.StatusNotFound, resp)
+	}
+	lastID := strings.TrimSpace(c.Request().Header.Get("Last-Event-ID"))
+	if resp.Status == lastID && resp.Status != auth.StatusWaiting {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	w := c.Response()
+	rc := http.NewResponseController(w)
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// 프록시(nginx)가 응답을 모아 두지 않도록 함
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := writeEvent(rc, w, fmt.Sprintf("retry: %d\n\n", eventsRetryMillis)); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(s.eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		if resp.Status != lastID {
+			payload := resp
+			if keyless {
+				payload = statusOnly(resp)
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return err
+			}
+			if err := writeEvent(rc, w, fmt.Sprintf("id: %s\nevent: status\ndata: %s\n\n", resp.Status, data)); err != nil {
+				return nil
+			}
+			lastID = resp.Status
+		}
+		if resp.Status != auth.StatusWaiting {
+			return nil
+		}
+
+		switch watch.wait(ctx, expiryRecheck(resp), heartbeat.C) {
+		case watchDone, watchClosed:
+			// 구독이 끊기면 닫아 브라우저가 Last-Event-ID로 다시 연결하게 함
+			return nil
+		case watchTick:
+			if err := writeEvent(rc, w, ": ping\n\n"); err != nil {
+				return nil
+			}
+		}
+		if resp, err = watch.check(ctx); err != nil {
+			if ctx.Err() == nil {
+				s.logger.Printf("auth events error: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// statusOnly는 API 키 없이 구독한 스트림에 보내는 응답으로, 번호와 클라이언트 정보를 뺀 상태와 만료 시각
+func statusOnly(resp *auth.AuthCheckResponse) *auth.AuthCheckResponse {
+	return &auth.AuthCheckResponse{Status: resp.Status, Reason: resp.Reason, ExpiresIn: resp.ExpiresIn, ExpiresAt: resp.ExpiresAt}
+}
+
+// writeEvent는 쓰기 제한 시간을 새로 설정한 뒤 event를 쓰고 바로 내보냄
+// 응답이 제한 시간을 지원하지 않으면(테스트 기록기 등) 제한 없이 씀
+func writeEvent(rc *http.ResponseController, w http.ResponseWriter, event string) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := w.Write([]byte(event)); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// eventsError는 스트림을 시작하기 전의 오류 응답
+func (s *Server) eventsError(c echo.Context, err error) error {
+	if err == auth.ErrInvalidAuthID {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
+	}
+	if errors.Is(err, storage.ErrCircuitOpen) {
+		return s.storageUnavailable(c)
+	}
+	s.logger.Printf("auth events error: %v", err)
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
+}
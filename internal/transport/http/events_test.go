@@ -0,0 +1,217 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"mapae/internal/auth"
+	"mapae/internal/config"
+	"mapae/internal/logging"
+	"mapae/internal/storage/memory"
+)
+
+// sseEvent는 스트림에서 읽은 이벤트 하나
+type sseEvent struct {
+	id    string
+	event string
+	data  auth.AuthCheckResponse
+}
+
+// newEventsCluster는 같은 저장소를 쓰는 두 인스턴스를 만들고, 첫 인스턴스를 짧은 서버 제한 시간으로 띄움
+// 스트림은 첫 인스턴스에서 받고, 인증은 두 번째 인스턴스(SMTP를 받은 노드)에서 처리하는 상황을 재현
+func newEventsCluster(t *testing.T, authTTL int) (*httptest.Server, *auth.Service, *auth.Service) {
+	t.Helper()
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	newSettings := func() *config.Settings {
+		return &config.Settings{AuthTTLSeconds: authTTL, VerifiedTTLSeconds: 30, SessionTombstoneTTLSeconds: 3600, SMSInboundAddress: "verify@example.com"}
+	}
+	streaming, err := auth.New(store, newSettings())
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	verifying, err := auth.New(store, newSettings())
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	s := NewServer(newSettings(), streaming, logging.New("test: ", false))
+	s.eventsHeartbeat = 50 * time.Millisecond
+
+	server := httptest.NewUnstartedServer(s.Handler())
+	// 스트림은 서버의 제한 시간보다 오래 열려 있어야 함
+	server.Config.ReadTimeout = 300 * time.Millisecond
+	server.Config.WriteTimeout = 300 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, streaming, verifying
+}
+
+func openEvents(t *testing.T, server *httptest.Server, authID, lastEventID string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/auth/events/"+authID, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /auth/events error = %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var current sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if current.event != "" {
+					events <- current
+				}
+				current = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				current.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				current.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.data); err != nil {
+					t.Errorf("Unmarshal(%q) error = %v", line, err)
+				}
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed before the next event")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+func expectClosed(t *testing.T, events <-chan sseEvent) {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Fatalf("unexpected event %+v, want stream closed", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not closed")
+	}
+}
+
+func TestAuthEventsAcrossInstances(t *testing.T) {
+	server, streaming, verifying := newEventsCluster(t, 60)
+	ctx := context.Background()
+	initResp, err := streaming.InitAuthWithOptions(ctx, auth.InitOptions{Client: &auth.ClientData{State: "s-1"}})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+
+	resp, events := openEvents(t, server, initResp.AuthID, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /auth/events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if ev := nextEvent(t, events); ev.id != auth.StatusWaiting || ev.event != "status" || ev.data.State != "s-1" {
+		t.Fatalf("first event = %+v, want waiting", ev)
+	}
+
+	// 서버 제한 시간이 지난 뒤에도 스트림이 이어지는지 확인
+	time.Sleep(700 * time.Millisecond)
+	nonce := regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(initResp.SMSBody)[1]
+	phone, carrier := "01012345678", "KT"
+	if _, ok, err := verifying.VerifyByNonce(ctx, nonce, &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+	}
+	if ev := nextEvent(t, events); ev.id != auth.StatusVerified || ev.data.Phone != phone || ev.data.Token != "" {
+		t.Fatalf("second event = %+v, want verified", ev)
+	}
+	expectClosed(t, events)
+
+	// 결과를 받은 뒤 다시 연결하면 보낼 것이 없으므로 204
+	resp, _ = openEvents(t, server, initResp.AuthID, auth.StatusVerified)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("GET /auth/events with Last-Event-ID = %d, want 204", resp.StatusCode)
+	}
+	// Last-Event-ID가 waiting이면 그 뒤의 결과를 보냄
+	_, events = openEvents(t, server, initResp.AuthID, auth.StatusWaiting)
+	if ev := nextEvent(t, events); ev.id != auth.StatusVerified {
+		t.Fatalf("resumed event = %+v, want verified", ev)
+	}
+	expectClosed(t, events)
+}
+
+func TestAuthEventsResumeWhileWaiting(t *testing.T) {
+	server, streaming, _ := newEventsCluster(t, 60)
+	ctx := context.Background()
+	initResp, err := streaming.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	_, events := openEvents(t, server, initResp.AuthID, auth.StatusWaiting)
+	if _, err := streaming.CancelAuth(ctx, initResp.AuthID); err != nil {
+		t.Fatalf("CancelAuth() error = %v", err)
+	}
+	// 이미 받은 waiting은 다시 보내지 않음
+	if ev := nextEvent(t, events); ev.id != auth.StatusCancelled {
+		t.Fatalf("first event = %+v, want cancelled", ev)
+	}
+	expectClosed(t, events)
+}
+
+func TestAuthEventsExpire(t *testing.T) {
+	server, streaming, _ := newEventsCluster(t, 1)
+	initResp, err := streaming.InitAuth(context.Background())
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	_, events := openEvents(t, server, initResp.AuthID, "")
+	if ev := nextEvent(t, events); ev.id != auth.StatusWaiting {
+		t.Fatalf("first event = %+v, want waiting", ev)
+	}
+	if ev := nextEvent(t, events); ev.id != auth.StatusExpired {
+		t.Fatalf("second event = %+v, want expired", ev)
+	}
+	expectClosed(t, events)
+}
+
+func TestAuthEventsRejectsUnknownAndInvalid(t *testing.T) {
+	server, _, _ := newEventsCluster(t, 60)
+	for path, want := range map[string]int{
+		"/auth/events/" + strings.Repeat("a", 32): http.StatusNotFound,
+		"/auth/events/not-an-id":                  http.StatusBadRequest,
+	} {
+		resp, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
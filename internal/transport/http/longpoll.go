@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"mapae/internal/auth"
+)
+
+const (
+	// MaxCheckWait는 상태 조회의 wait 상한. 응답을 쓰는 시간까지 HTTP 서버의 WriteTimeout(15초) 안에 들어가야 함
+	MaxCheckWait = 10 * time.Second
+	// longPollRecheck는 기다리는 동안 알림과 별개로 상태를 다시 조회하는 간격. 알림이 유실되어도 이 간격 안에 응답함
+	longPollRecheck = 2 * time.Second
+)
+
+var errInvalidWait = errors.New("wait must be a non-negative number of seconds")
+
+// parseWait는 wait 쿼리 파라미터(초)를 읽으며, 없으면 0이고 MaxCheckWait보다 크면 MaxCheckWait
+func parseWait(c echo.Context) (time.Duration, error) {
+	raw := c.QueryParam("wait")
+	if raw == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, errInvalidWait
+	}
+	return min(time.Duration(seconds)*time.Second, MaxCheckWait), nil
+}
+
+// checkETag는 상태 조회 응답의 ETag
+// 남은 시간(expires_in, expires_at)은 조회마다 바뀌고 token은 발급마다 바뀌므로 빼고 상태만으로 만듦
+func checkETag(resp *auth.AuthCheckResponse) string {
+	state := *resp
+	state.ExpiresIn, state.ExpiresAt, state.Token = 0, "", ""
+	data, _ := json.Marshal(state)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches는 If-None-Match 값이 etag를 포함하는지 여부. 약한 비교(W/ 무시)이며 "*"는 모두 일치
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// waitCheck는 상태가 기준 상태에서 바뀌거나 wait가 지날 때까지 기다린 뒤 현재 상태를 반환
+// 기준은 If-None-Match가 있으면 그 ETag, 없으면 대기 중일 때의 현재 상태이며, 이미 결과가 나왔으면 바로 반환
+// wait가 0이면 기다리지 않음
+func waitCheck(ctx context.Context, svc *auth.Service, authID string, wait time.Duration, ifNoneMatch string) (*auth.AuthCheckResponse, error) {
+	if wait <= 0 {
+		return svc.CheckAuth(ctx, authID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	watch, resp, err := watchAuth(ctx, svc, authID)
+	if err != nil {
+		return nil, err
+	}
+	baseline := ifNoneMatch
+	if baseline == "" {
+		if resp.Status != auth.StatusWaiting {
+			return resp, nil
+		}
+		baseline = checkETag(resp)
+	}
+	for resp.Status != auth.StatusUnknown && etagMatches(baseline, checkETag(resp)) {
+		recheck := longPollRecheck
+		if resp.ExpiresIn > 0 {
+			recheck = min(recheck, expiryRecheck(resp))
+		}
+		// 구독이 끊겨도 남은 시간 동안은 주기적으로 조회
+		if watch.wait(ctx, recheck, nil) == watchDone {
+			return resp, nil
+		}
+		next, err := watch.check(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return resp, nil
+			}
+			return nil, err
+		}
+		resp = next
+	}
+	return resp, nil
+}
+
+// writeCheck는 상태 조회 응답에 ETag를 붙여 쓰며, If-None-Match와 같으면 본문 없이 304
+func writeCheck(c echo.Context, resp *auth.AuthCheckResponse) error {
+	etag := checkETag(resp)
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set(echo.HeaderCacheControl, "no-cache")
+	if resp.Status != auth.StatusUnknown && etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(checkStatusCode(resp), resp)
+}
@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"mapae/internal/auth"
+)
+
+func checkRequest(t *testing.T, h http.Handler, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func initForCheck(t *testing.T, authSvc *auth.Service) (string, string) {
+	t.Helper()
+	resp, err := authSvc.InitAuth(context.Background())
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	return resp.AuthID, regexp.MustCompile(`\[MAPAE:([0-9a-fA-F]{64})\]`).FindStringSubmatch(resp.SMSBody)[1]
+}
+
+// verifyLater는 delay 뒤에 다른 고루틴에서 인증을 완료함
+func verifyLater(t *testing.T, authSvc *auth.Service, nonce string, delay time.Duration) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(delay)
+		phone, carrier := "01012345678", "KT"
+		if _, ok, err := authSvc.VerifyByNonce(context.Background(), nonce, &phone, &carrier); err != nil || !ok {
+			t.Errorf("VerifyByNonce() = (ok=%t, err=%v)", ok, err)
+		}
+	}()
+	t.Cleanup(func() { <-done })
+}
+
+func TestCheckETagAndNotModified(t *testing.T) {
+	s, authSvc := makeHTTPServer(t, false)
+	h := s.Handler()
+	authID, _ := initForCheck(t, authSvc)
+
+	first := checkRequest(t, h, "/auth/check/"+authID, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /auth/check = %d, ETag %q", first.Code, etag)
+	}
+	// 남은 시간이 바뀌어도 상태가 같으면 ETag는 같음
+	time.Sleep(1100 * time.Millisecond)
+	second := checkRequest(t, h, "/auth/check/"+authID, etag)
+	if second.Code != http.StatusNotModified || second.Header().Get("ETag") != etag || second.Body.Len() != 0 {
+		t.Fatalf("GET /auth/check with If-None-Match = %d, ETag %q, body %q", second.Code, second.Header().Get("ETag"), second.Body.String())
+	}
+	if rec := checkRequest(t, h, "/auth/check/"+authID, `W/"other", `+etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("GET /auth/check with an ETag list = %d, want 304", rec.Code)
+	}
+	if rec := checkRequest(t, h, "/auth/check/"+authID, `"other"`); rec.Code != http.StatusOK {
+		t.Fatalf("GET /auth/check with another ETag = %d, want 200", rec.Code)
+	}
+}
+
+func TestCheckLongPollReturnsOnChange(t *testing.T) {
+	s, authSvc := makeHTTPServer(t, false)
+	h := s.Handler()
+	authID, nonce := initForCheck(t, authSvc)
+	etag := checkRequest(t, h, "/auth/check/"+authID, "").Header().Get("ETag")
+
+	verifyLater(t, authSvc, nonce, 200*time.Millisecond)
+	start := time.Now()
+	rec := checkRequest(t, h, "/auth/check/"+authID+"?wait=10", etag)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("long poll returned after %s", elapsed)
+	}
+	var body auth.AuthCheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if rec.Code != http.StatusOK || body.Status != auth.StatusVerified || rec.Header().Get("ETag") == etag {
+		t.Fatalf("GET /auth/check?wait=10 = %d %+v", rec.Code, body)
+	}
+
+	// 이미 결과가 나왔으면 기다리지 않음
+	start = time.Now()
+	if rec := checkRequest(t, h, "/auth/check/"+authID+"?wait=10", ""); rec.Code != http.StatusOK || time.Since(start) > time.Second {
+		t.Fatalf("GET /auth/check?wait=10 after verify = %d in %s", rec.Code, time.Since(start))
+	}
+}
+
+func TestCheckLongPollTimesOut(t *testing.T) {
+	s, authSvc := makeHTTPServer(t, false)
+	h := s.Handler()
+	authID, _ := initForCheck(t, authSvc)
+	etag := checkRequest(t, h, "/auth/check/"+authID, "").Header().Get("ETag")
+
+	start := time.Now()
+	rec := checkRequest(t, h, "/auth/check/"+authID+"?wait=1", etag)
+	if elapsed := time.Since(start); rec.Code != http.StatusNotModified || elapsed < 900*time.Millisecond {
+		t.Fatalf("GET /auth/check?wait=1 with If-None-Match = %d after %s, want 304 after 1s", rec.Code, elapsed)
+	}
+	rec = checkRequest(t, h, "/auth/check/"+authID+"?wait=1", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag {
+		t.Fatalf("GET /auth/check?wait=1 = %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestCheckRejectsInvalidWait(t *testing.T) {
+	s, authSvc := makeHTTPServer(t, true)
+	h := s.Handler()
+	authID, _ := initForCheck(t, authSvc)
+	for _, path := range []string{"/auth/check/", "/auth/check-signed/"} {
+		for _, wait := range []string{"-1", "abc", "1.5"} {
+			if rec := checkRequest(t, h, path+authID+"?wait="+wait, ""); rec.Code != http.StatusBadRequest {
+				t.Fatalf("GET %s?wait=%s = %d, want 400", path, wait, rec.Code)
+			}
+		}
+	}
+}
+
+func TestCheckSignedLongPoll(t *testing.T) {
+	s, authSvc := makeHTTPServer(t, true)
+	h := s.Handler()
+	authID, nonce := initForCheck(t, authSvc)
+
+	waiting := checkRequest(t, h, "/auth/check-signed/"+authID, "")
+	etag := waiting.Header().Get("ETag")
+	if rec := checkRequest(t, h, "/auth/check-signed/"+authID, etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("GET /auth/check-signed with If-None-Match = %d, want 304", rec.Code)
+	}
+
+	verifyLater(t, authSvc, nonce, 200*time.Millisecond)
+	rec := checkRequest(t, h, "/auth/check-signed/"+authID+"?wait=10", etag)
+	var body auth.AuthCheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if rec.Code != http.StatusOK || body.Status != auth.StatusVerified || body.Token == "" {
+		t.Fatalf("GET /auth/check-signed?wait=10 = %d %+v", rec.Code, body)
+	}
+	// 토큰은 ETag에 들어가지 않으므로 같은 결과를 다시 조회하면 304
+	if again := checkRequest(t, h, "/auth/check-signed/"+authID, rec.Header().Get("ETag")); again.Code != http.StatusNotModified {
+		t.Fatalf("GET /auth/check-signed with the verified ETag = %d, want 304", again.Code)
+	}
+}
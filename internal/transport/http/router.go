@@ -2,8 +2,14 @@ package httpapi
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,36 +19,69 @@ import (
 	"mapae/internal/auth"
 	"mapae/internal/config"
 	"mapae/internal/logging"
+	"mapae/internal/metrics"
+	"mapae/internal/ratelimit"
+	"mapae/internal/storage"
+	"mapae/internal/tenant"
+	"mapae/internal/webhook"
 )
 
 type Server struct {
-	settings *config.Settings
-	auth     *auth.Service
-	logger   *logging.Logger
-	e        *echo.Echo
+	settings    *config.Settings
+	auth        *auth.Service
+	logger      *logging.Logger
+	e           *echo.Echo
+	initLimiter ratelimit.Limiter
+	// eventsHeartbeat는 /auth/events의 연결 유지 간격
+	eventsHeartbeat time.Duration
+	// clients는 API 키를 확인할 등록된 클라이언트이며, nil이면 키 없이 전역 설정으로 처리
+	clients *tenant.Registry
 }
 
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Storage string `json:"storage"`
+	Breaker string `json:"breaker,omitempty"`
 }
 
 type ErrorResponse struct {
 	Detail string `json:"detail"`
 }
 
+// AuthInitRequest는 /auth/init의 선택 본문
+type AuthInitRequest struct {
+	auth.ClientData
+	// ExpectedPhone/ExpectedPhoneHash는 인증할 수 있는 번호 또는 그 해시(둘 중 하나만)
+	ExpectedPhone     string `json:"expected_phone,omitempty"`
+	ExpectedPhoneHash string `json:"expected_phone_hash,omitempty"`
+	// WebhookURL은 이 요청의 결과를 받을 주소. WEBHOOK_ALLOWED_URL_PREFIXES 중 하나의 경로 아래여야 함
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// WebhookLogResponse는 auth_id의 웹훅 전송 기록
+type WebhookLogResponse struct {
+	Attempts []webhook.Attempt `json:"attempts"`
+}
+
+// maxInitBodyBytes는 /auth/init 본문 크기 한도. 클라이언트 정보 한도를 모두 채워도 넘지 않는 크기
+const maxInitBodyBytes = 16 << 10
+
 func NewServer(settings *config.Settings, authService *auth.Service, logger *logging.Logger) *Server {
 	e := echo.New()
 	e.HideBanner = true
+	// 헤더는 누구나 보낼 수 있으므로 TrustProxies로 프록시를 정하기 전에는 접속한 주소만 믿음
+	e.IPExtractor = echo.ExtractIPDirect()
+	server := &Server{settings: settings, auth: authService, logger: logger, e: e, eventsHeartbeat: defaultEventsHeartbeat}
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			origin := c.Request().Header.Get("Origin")
-			if origin != "" && isAllowedOrigin(settings, origin) {
+			if origin != "" && server.isAllowedOrigin(c, origin) {
 				res := c.Response()
 				res.Header().Set("Access-Control-Allow-Origin", origin)
 				res.Header().Set("Vary", "Origin")
 				res.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
 				res.Header().Set("Access-Control-Allow-Headers", "*")
+				res.Header().Set("Access-Control-Expose-Headers", "ETag")
 			}
 			if c.Request().Method == http.MethodOptions {
 				return c.NoContent(http.StatusNoContent)
@@ -51,7 +90,6 @@ func NewServer(settings *config.Settings, authService *auth.Service, logger *log
 		}
 	})
 
-	server := &Server{settings: settings, auth: authService, logger: logger, e: e}
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogMethod:   true,
 		LogURI:      true,
@@ -59,25 +97,61 @@ func NewServer(settings *config.Settings, authService *auth.Service, logger *log
 		LogLatency:  true,
 		LogRemoteIP: true,
 		LogProtocol: true,
-		LogValuesFunc: func(_ echo.Context, v middleware.RequestLoggerValues) error {
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			tenantField := ""
+			if id, ok := c.Get(tenantContextKey).(string); ok {
+				tenantField = " tenant=" + id
+			}
 			server.logger.Printf(
-				"INFO:     %s - %q %d %dms",
+				"INFO:     %s - %q %d %dms%s",
 				v.RemoteIP,
 				fmt.Sprintf("%s %s %s", v.Method, v.URI, v.Protocol),
 				v.Status,
 				v.Latency.Milliseconds(),
+				tenantField,
 			)
 			return nil
 		},
 	}))
 	e.GET("/health", server.healthHandler)
-	e.POST("/auth/init", server.authInitHandler)
-	e.GET("/auth/check/:auth_id", server.authCheckHandler)
-	e.GET("/auth/check-signed/:auth_id", server.authCheckSignedHandler)
+	e.POST("/auth/init", server.authInitHandler, server.requireClient)
+	e.GET("/auth/check/:auth_id", server.authCheckHandler, server.requireClient)
+	e.GET("/auth/check-signed/:auth_id", server.authCheckSignedHandler, server.requireClient)
+	e.POST("/auth/cancel/:auth_id", server.authCancelHandler, server.requireClient)
+	e.GET("/auth/webhooks/:auth_id", server.webhookLogHandler, server.requireClient)
+	e.GET("/auth/events/:auth_id", server.authEventsHandler, server.optionalClient)
 	e.GET("/.well-known/jwks.json", server.jwksHandler)
 	return server
 }
 
+// MetricsHandler는 registry를 Prometheus 텍스트 형식으로 제공하는 GET /metrics만 있는 핸들러
+// 공개 API와 분리된 리스너(METRICS_ADDR)에서 제공
+func MetricsHandler(registry *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	return mux
+}
+
+// TrustProxies는 cidrs에서 접속한 요청이면 X-Forwarded-For에서 그 프록시들을 건너뛴 주소를 클라이언트 IP로 씀
+// 요청 제한과 로그가 이 IP를 쓰므로, 실제로 앞에 둔 프록시만 적어야 함
+func (s *Server) TrustProxies(cidrs []string) error {
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	s.e.IPExtractor = echo.ExtractIPFromXFFHeader(options...)
+	return nil
+}
+
+// LimitInit은 /auth/init 요청을 클라이언트 IP별로 limiter에 따라 제한
+func (s *Server) LimitInit(limiter ratelimit.Limiter) {
+	s.initLimiter = limiter
+}
+
 func (s *Server) Handler() http.Handler {
 	return s.e
 }
@@ -93,23 +167,68 @@ func (s *Server) Handler() http.Handler {
 func (s *Server) healthHandler(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(c.Request().Context(), 2*time.Second)
 	defer cancel()
-	if err := s.auth.Ping(ctx); err != nil {
-		return c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unhealthy", Storage: "down"})
+	err := s.auth.Ping(ctx)
+	// Ping 결과가 차단기에 반영된 뒤의 상태를 보고
+	breaker := string(s.auth.StorageBreakerState())
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unhealthy", Storage: "down", Breaker: breaker})
 	}
-	return c.JSON(http.StatusOK, HealthResponse{Status: "ok", Storage: "up"})
+	return c.JSON(http.StatusOK, HealthResponse{Status: "ok", Storage: "up", Breaker: breaker})
 }
 
 // AuthInitHandler godoc
 // @Summary      인증 시작
-// @Description  인증 요청 생성
+// @Description  인증 요청 생성. SMS 본문 언어는 locale 파라미터, 없으면 Accept-Language 헤더로 고름
+// @Description  본문의 클라이언트 정보(state, client_reference, metadata)는 상태 조회 응답과 JWT에 그대로 돌려줌
+// @Description  expected_phone(또는 expected_phone_hash)을 주면 다른 번호에서 온 문자는 failed(phone_mismatch)로 기록
+// @Description  webhook_url을 주면 기본 웹훅 주소 대신 그 주소로 verified/failed/expired를 알림
 // @Tags         auth
+// @Security     ApiKeyAuth
+// @Accept       json
 // @Produce      json
-// @Success      200  {object}  auth.AuthInitResponse
-// @Failure      500  {object}  ErrorResponse
+// @Param        locale           query     string           false  "SMS 본문 언어 (예: ko, en)"
+// @Param        Accept-Language  header    string           false  "locale이 없을 때 사용할 언어 선호"
+// @Param        body             body      AuthInitRequest  false  "클라이언트 정보, 예상 번호, 웹훅 주소"
+// @Success      200              {object}  auth.AuthInitResponse
+// @Failure      400              {object}  ErrorResponse
+// @Failure      401              {object}  ErrorResponse
+// @Failure      403              {object}  ErrorResponse
+// @Failure      429              {object}  ErrorResponse
+// @Failure      500              {object}  ErrorResponse
+// @Failure      503              {object}  ErrorResponse
 // @Router       /auth/init [post]
 func (s *Server) authInitHandler(c echo.Context) error {
-	resp, err := s.auth.InitAuth(c.Request().Context())
+	if !s.allowInit(c) {
+		return c.JSON(http.StatusTooManyRequests, ErrorResponse{Detail: "요청이 너무 많습니다. 잠시 후 다시 시도해 주세요"})
+	}
+	body, err := s.readInitRequest(c)
 	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "요청 본문이 올바르지 않습니다: " + err.Error()})
+	}
+	locale := c.QueryParam("locale")
+	if locale == "" {
+		locale = c.Request().Header.Get("Accept-Language")
+	}
+	resp, err := s.authFor(c).InitAuthWithOptions(c.Request().Context(), auth.InitOptions{
+		Locale:            locale,
+		Client:            &body.ClientData,
+		ExpectedPhone:     body.ExpectedPhone,
+		ExpectedPhoneHash: body.ExpectedPhoneHash,
+		WebhookURL:        body.WebhookURL,
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClientData) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "클라이언트 정보가 올바르지 않습니다: " + err.Error()})
+		}
+		if errors.Is(err, auth.ErrInvalidExpectedPhone) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "예상 번호가 올바르지 않습니다: " + err.Error()})
+		}
+		if errors.Is(err, auth.ErrInvalidWebhookURL) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "웹훅 주소가 올바르지 않습니다: " + err.Error()})
+		}
+		if errors.Is(err, storage.ErrCircuitOpen) {
+			return s.storageUnavailable(c)
+		}
 		s.logger.Printf("auth init error: %v", err)
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
 	}
@@ -118,38 +237,63 @@ func (s *Server) authInitHandler(c echo.Context) error {
 
 // AuthCheckHandler godoc
 // @Summary      인증 상태 조회
-// @Description  인증 완료 여부 조회
+// @Description  인증 상태 조회 (waiting, verified, failed, cancelled, consumed, expired). 발급한 적 없는 auth_id는 404와 unknown
+// @Description  wait(초, 최대 10)를 주면 상태가 바뀌거나 wait가 지날 때까지 응답을 미룸. 기준 상태는 If-None-Match, 없으면 waiting
+// @Description  응답의 ETag는 상태가 같으면 같으며, If-None-Match와 같으면 304
 // @Tags         auth
+// @Security     ApiKeyAuth
 // @Produce      json
-// @Param        auth_id   path      string  true  "인증 ID"
-// @Success      200       {object}  auth.AuthCheckResponse
-// @Failure      400       {object}  ErrorResponse
+// @Param        auth_id        path      string   true   "인증 ID"
+// @Param        wait           query     integer  false  "상태가 바뀔 때까지 기다릴 시간(초)"
+// @Param        If-None-Match  header    string   false  "이전 응답의 ETag"
+// @Success      200            {object}  auth.AuthCheckResponse
+// @Success      304            "상태가 바뀌지 않음"
+// @Failure      400            {object}  ErrorResponse
+// @Failure      401            {object}  ErrorResponse
+// @Failure      403            {object}  ErrorResponse
+// @Failure      404       {object}  auth.AuthCheckResponse
 // @Failure      500       {object}  ErrorResponse
+// @Failure      503       {object}  ErrorResponse
 // @Router       /auth/check/{auth_id} [get]
 func (s *Server) authCheckHandler(c echo.Context) error {
 	authID := strings.TrimSpace(c.Param("auth_id"))
 	if authID == "" {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
 	}
-	resp, err := s.auth.CheckAuth(c.Request().Context(), authID)
+	wait, err := parseWait(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "wait 값이 올바르지 않습니다: " + err.Error()})
+	}
+	resp, err := waitCheck(c.Request().Context(), s.authFor(c), authID, wait, c.Request().Header.Get("If-None-Match"))
 	if err != nil {
 		if err == auth.ErrInvalidAuthID {
 			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
 		}
+		if errors.Is(err, storage.ErrCircuitOpen) {
+			return s.storageUnavailable(c)
+		}
 		s.logger.Printf("auth check error: %v", err)
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
 	}
-	return c.JSON(http.StatusOK, resp)
+	return writeCheck(c, resp)
 }
 
 // AuthCheckSignedHandler godoc
 // @Summary      Check Signed Result
-// @Description  인증 완료시 JWT가 포함된 상태 조회 (기존 응답 + token)
+// @Description  인증 완료시 JWT가 포함된 상태 조회 (기존 응답 + token). SIGNED_RESULT_SINGLE_USE면 처음 발급한 뒤로는 consumed
+// @Description  wait와 If-None-Match는 /auth/check와 같으며, 304에는 토큰을 발급하지 않음(ETag에는 token이 들어가지 않음)
 // @Tags         auth
+// @Security     ApiKeyAuth
 // @Produce      json
-// @Param        auth_id   path      string  true  "인증 ID"
-// @Success      200       {object}  auth.AuthCheckResponse
-// @Failure      400       {object}  ErrorResponse
+// @Param        auth_id        path      string   true   "인증 ID"
+// @Param        wait           query     integer  false  "상태가 바뀔 때까지 기다릴 시간(초)"
+// @Param        If-None-Match  header    string   false  "이전 응답의 ETag"
+// @Success      200            {object}  auth.AuthCheckResponse
+// @Success      304            "상태가 바뀌지 않음"
+// @Failure      400            {object}  ErrorResponse
+// @Failure      401            {object}  ErrorResponse
+// @Failure      403            {object}  ErrorResponse
+// @Failure      404       {object}  auth.AuthCheckResponse
 // @Failure      500       {object}  ErrorResponse
 // @Failure      503       {object}  ErrorResponse
 // @Router       /auth/check-signed/{auth_id} [get]
@@ -158,7 +302,21 @@ func (s *Server) authCheckSignedHandler(c echo.Context) error {
 	if authID == "" {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
 	}
-	resp, err := s.auth.CheckSigned(c.Request().Context(), authID)
+	wait, err := parseWait(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "wait 값이 올바르지 않습니다: " + err.Error()})
+	}
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	if wait > 0 || ifNoneMatch != "" {
+		// 토큰 발급(단일 사용이면 결과 소비) 전에 상태를 확인해, 바뀌지 않았으면 발급하지 않고 304
+		current, err := waitCheck(c.Request().Context(), s.authFor(c), authID, wait, ifNoneMatch)
+		if err == nil && current.Status != auth.StatusUnknown && etagMatches(ifNoneMatch, checkETag(current)) {
+			c.Response().Header().Set("ETag", checkETag(current))
+			c.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+	resp, err := s.authFor(c).CheckSigned(c.Request().Context(), authID)
 	if err != nil {
 		if err == auth.ErrInvalidAuthID {
 			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
@@ -166,12 +324,94 @@ func (s *Server) authCheckSignedHandler(c echo.Context) error {
 		if err == auth.ErrJWKSUnavailable {
 			return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Detail: "JWT signer unavailable"})
 		}
+		if errors.Is(err, storage.ErrCircuitOpen) {
+			return s.storageUnavailable(c)
+		}
 		s.logger.Printf("auth result error: %v", err)
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
 	}
+	return writeCheck(c, resp)
+}
+
+// AuthCancelHandler godoc
+// @Summary      인증 취소
+// @Description  대기 중인 인증 요청을 취소. 이미 끝난 요청은 409와 현재 상태
+// @Tags         auth
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        auth_id   path      string  true  "인증 ID"
+// @Success      200       {object}  auth.AuthCheckResponse
+// @Failure      400       {object}  ErrorResponse
+// @Failure      401       {object}  ErrorResponse
+// @Failure      403       {object}  ErrorResponse
+// @Failure      404       {object}  auth.AuthCheckResponse
+// @Failure      409       {object}  auth.AuthCheckResponse
+// @Failure      500       {object}  ErrorResponse
+// @Failure      503       {object}  ErrorResponse
+// @Router       /auth/cancel/{auth_id} [post]
+func (s *Server) authCancelHandler(c echo.Context) error {
+	authID := strings.TrimSpace(c.Param("auth_id"))
+	resp, err := s.authFor(c).CancelAuth(c.Request().Context(), authID)
+	if err != nil {
+		if errors.Is(err, auth.ErrNotCancellable) {
+			if resp.Status == auth.StatusUnknown {
+				return c.JSON(http.StatusNotFound, resp)
+			}
+			return c.JSON(http.StatusConflict, resp)
+		}
+		if err == auth.ErrInvalidAuthID {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
+		}
+		if errors.Is(err, storage.ErrCircuitOpen) {
+			return s.storageUnavailable(c)
+		}
+		s.logger.Printf("auth cancel error: %v", err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
+	}
 	return c.JSON(http.StatusOK, resp)
 }
 
+// WebhookLogHandler godoc
+// @Summary      웹훅 전송 기록
+// @Description  auth_id의 웹훅 전송 시도와 결과(delivered, retrying, failed). 수신 주소와 본문은 포함하지 않음
+// @Tags         auth
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        auth_id   path      string  true  "인증 ID"
+// @Success      200       {object}  WebhookLogResponse
+// @Failure      400       {object}  ErrorResponse
+// @Failure      401       {object}  ErrorResponse
+// @Failure      403       {object}  ErrorResponse
+// @Failure      500       {object}  ErrorResponse
+// @Failure      503       {object}  ErrorResponse
+// @Router       /auth/webhooks/{auth_id} [get]
+func (s *Server) webhookLogHandler(c echo.Context) error {
+	authID := strings.TrimSpace(c.Param("auth_id"))
+	attempts, err := s.authFor(c).WebhookLog(c.Request().Context(), authID)
+	if err != nil {
+		if err == auth.ErrInvalidAuthID {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "유효하지 않은 auth_id 입니다"})
+		}
+		if errors.Is(err, storage.ErrCircuitOpen) {
+			return s.storageUnavailable(c)
+		}
+		s.logger.Printf("webhook log error: %v", err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: "서버 오류가 발생했습니다"})
+	}
+	if attempts == nil {
+		attempts = []webhook.Attempt{}
+	}
+	return c.JSON(http.StatusOK, WebhookLogResponse{Attempts: attempts})
+}
+
+// checkStatusCode는 상태 조회 응답의 HTTP 상태 코드. 발급한 적 없는 auth_id만 404
+func checkStatusCode(resp *auth.AuthCheckResponse) int {
+	if resp.Status == auth.StatusUnknown {
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
+
 // JWKSHandler serves the public key set for JWT verification
 // @Summary      JWKS
 // @Description  공개용 JWK Set 제공
@@ -189,11 +429,43 @@ func (s *Server) jwksHandler(c echo.Context) error {
 	return c.Blob(http.StatusOK, "application/json", data)
 }
 
-func isAllowedOrigin(settings *config.Settings, origin string) bool {
-	for _, allowed := range settings.CORSAllowOrigins {
-		if allowed == "*" || allowed == origin {
-			return true
-		}
+// readInitRequest는 /auth/init의 JSON 본문을 읽으며, 본문이 없으면 빈 요청. 모르는 필드는 거부
+func (s *Server) readInitRequest(c echo.Context) (*AuthInitRequest, error) {
+	var body AuthInitRequest
+	req := c.Request()
+	if req.Body == nil || req.ContentLength == 0 {
+		return &body, nil
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(c.Response(), req.Body, maxInitBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// allowInit은 요청 제한 정보를 헤더에 싣고 허용 여부를 반환
+// 제한기(저장소) 오류로 정상 요청까지 막지 않도록 오류가 나면 허용
+func (s *Server) allowInit(c echo.Context) bool {
+	if s.initLimiter == nil {
+		return true
 	}
-	return false
+	d, err := s.initLimiter.Allow(c.Request().Context(), c.RealIP())
+	if err != nil {
+		s.logger.Printf("rate limit error: %v", err)
+		return true
+	}
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+	}
+	return d.Allowed
+}
+
+// storageUnavailable은 저장소 차단기가 열려 있을 때 재시도 시점을 알려주는 503 응답
+func (s *Server) storageUnavailable(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(s.settings.StoreBreakerOpenSeconds, 1)))
+	return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Detail: "저장소를 일시적으로 사용할 수 없습니다"})
 }
@@ -7,15 +7,20 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"mapae/internal/auth"
 	"mapae/internal/config"
 	"mapae/internal/logging"
+	"mapae/internal/metrics"
+	"mapae/internal/ratelimit"
+	"mapae/internal/storage"
 	"mapae/internal/storage/memory"
 )
 
@@ -94,6 +99,110 @@ func TestHealthAndCORS(t *testing.T) {
 	}
 }
 
+type downStore struct{}
+
+var errStoreDown = errors.New("connection refused")
+
+func (downStore) Ping(context.Context) error { return errStoreDown }
+func (downStore) Get(context.Context, string) (string, bool, error) {
+	return "", false, errStoreDown
+}
+func (downStore) TTL(context.Context, string) (time.Duration, bool, error) {
+	return 0, false, errStoreDown
+}
+func (downStore) Take(context.Context, string) (string, bool, error) {
+	return "", false, errStoreDown
+}
+func (downStore) SetEx(context.Context, string, string, int) error { return errStoreDown }
+func (downStore) MSetEx(context.Context, ...storage.Entry) error   { return errStoreDown }
+func (downStore) AddEx(context.Context, string, string, int) (bool, error) {
+	return false, errStoreDown
+}
+func (downStore) SlidingIncrEx(context.Context, string, string, float64, int64, int) (int64, int64, bool, error) {
+	return 0, 0, false, errStoreDown
+}
+func (downStore) IncrEx(context.Context, string, int64, int) (int64, error) {
+	return 0, errStoreDown
+}
+func (downStore) TakeAndSetEx(context.Context, string, string, string, string, int) (bool, error) {
+	return false, errStoreDown
+}
+func (downStore) Schedule(context.Context, string, string, time.Time) error { return errStoreDown }
+func (downStore) ClaimDue(context.Context, string, time.Time, time.Duration, int) ([]string, error) {
+	return nil, errStoreDown
+}
+func (downStore) Unschedule(context.Context, string, string) error { return errStoreDown }
+
+func (downStore) Publish(context.Context, string, string) error { return errStoreDown }
+func (downStore) Subscribe(context.Context, string) (<-chan string, error) {
+	return nil, errStoreDown
+}
+
+func TestBreakerOpenDegradesToServiceUnavailable(t *testing.T) {
+	settings := &config.Settings{AuthTTLSeconds: 60, VerifiedTTLSeconds: 30, StoreBreakerOpenSeconds: 30}
+	store := storage.Resilient(downStore{}, storage.ResilientOptions{
+		RetryAttempts:    1,
+		FailureThreshold: 1,
+		OpenTimeout:      time.Minute,
+	})
+	authSvc, err := auth.New(store, settings)
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	h := NewServer(settings, authSvc, logging.New("test: ", false)).Handler()
+
+	health := request(t, h, http.MethodGet, "/health", "")
+	if health.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /health status = %d, want 503", health.Code)
+	}
+	var body HealthResponse
+	if err := json.Unmarshal(health.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	// 실패한 Ping 한 번으로 차단기가 열리므로 응답에 열린 상태가 보여야 함
+	if body.Storage != "down" || body.Breaker != string(storage.BreakerOpen) {
+		t.Fatalf("unexpected health response after the failed ping: %#v", body)
+	}
+
+	rec := request(t, h, http.MethodPost, "/auth/init", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST /auth/init status = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("Retry-After = %q, want 30", got)
+	}
+
+	health = request(t, h, http.MethodGet, "/health", "")
+	if err := json.Unmarshal(health.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if body.Breaker != string(storage.BreakerOpen) {
+		t.Fatalf("breaker = %q, want open", body.Breaker)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	if rec := request(t, s.Handler(), http.MethodGet, "/metrics", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /metrics on the API listener status = %d, want 404", rec.Code)
+	}
+
+	registry := metrics.NewRegistry()
+	registry.NewCounterVec("mapae_test_total", "Test counter.").Inc()
+	h := MetricsHandler(registry)
+	if rec := request(t, h, http.MethodGet, "/health", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /health on the metrics listener status = %d, want 404", rec.Code)
+	}
+
+	rec := request(t, h, http.MethodGet, "/metrics", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "mapae_test_total 1") {
+		t.Fatalf("unexpected metrics body: %s", rec.Body.String())
+	}
+}
+
 func TestAuthEndpointsWithoutSigner(t *testing.T) {
 	s, authSvc := makeHTTPServer(t, false)
 	h := s.Handler()
@@ -129,17 +238,14 @@ func TestAuthEndpointsWithoutSigner(t *testing.T) {
 	if len(match) < 2 {
 		t.Fatalf("failed to parse nonce from %q", initBody.SMSBody)
 	}
-	consumedAuthID, ok, err := authSvc.ConsumeAuthIDByNonce(context.Background(), match[1])
-	if err != nil {
-		t.Fatalf("ConsumeAuthIDByNonce() error = %v", err)
-	}
-	if !ok || consumedAuthID != initBody.AuthID {
-		t.Fatalf("consume mismatch: authID=%q ok=%t", consumedAuthID, ok)
-	}
 	phone := "01012345678"
 	carrier := "KT"
-	if err := authSvc.StoreVerified(context.Background(), initBody.AuthID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
+	finished, ok, err := authSvc.VerifyByNonce(context.Background(), match[1], &phone, &carrier)
+	if err != nil {
+		t.Fatalf("VerifyByNonce() error = %v", err)
+	}
+	if !ok || finished.AuthID != initBody.AuthID {
+		t.Fatalf("verify mismatch: authID=%q ok=%t", finished.AuthID, ok)
 	}
 
 	verified := request(t, h, http.MethodGet, "/auth/check/"+initBody.AuthID, "")
@@ -181,11 +287,10 @@ func TestSignedEndpointAndJWKSWithSigner(t *testing.T) {
 	if len(match) < 2 {
 		t.Fatalf("failed to parse nonce from %q", initBody.SMSBody)
 	}
-	_, _, _ = authSvc.ConsumeAuthIDByNonce(context.Background(), match[1])
 	phone := "01088887777"
 	carrier := "LGU+"
-	if err := authSvc.StoreVerified(context.Background(), initBody.AuthID, &phone, &carrier); err != nil {
-		t.Fatalf("StoreVerified() error = %v", err)
+	if _, ok, err := authSvc.VerifyByNonce(context.Background(), match[1], &phone, &carrier); err != nil || !ok {
+		t.Fatalf("VerifyByNonce() = (ok=%t, err=%v), want (true, nil)", ok, err)
 	}
 
 	signed := request(t, h, http.MethodGet, "/auth/check-signed/"+initBody.AuthID, "")
@@ -211,3 +316,221 @@ func TestSignedEndpointAndJWKSWithSigner(t *testing.T) {
 		t.Fatalf("unexpected jwks response: %s", jwks.Body.String())
 	}
 }
+
+func TestInitRateLimitPerClientIP(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	limiter, err := ratelimit.New(store, ratelimit.Options{Name: "init", Algorithm: ratelimit.Fixed, Limit: 2, Window: time.Hour})
+	if err != nil {
+		t.Fatalf("ratelimit.New() error = %v", err)
+	}
+	s.LimitInit(limiter)
+	h := s.Handler()
+
+	initFrom := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/init", nil)
+		req.RemoteAddr = ip + ":5000"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	for i, wantRemaining := range []string{"1", "0"} {
+		rec := initFrom("192.0.2.1")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != wantRemaining {
+			t.Fatalf("request %d = %d remaining=%q, want 200 remaining=%s", i+1, rec.Code, rec.Header().Get("X-RateLimit-Remaining"), wantRemaining)
+		}
+	}
+	limited := initFrom("192.0.2.1")
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request status = %d, want 429", limited.Code)
+	}
+	if limited.Header().Get("Retry-After") == "" || limited.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("rate limit headers = %v", limited.Header())
+	}
+	if other := initFrom("192.0.2.2"); other.Code != http.StatusOK {
+		t.Fatalf("other client status = %d, want 200", other.Code)
+	}
+}
+
+// X-Forwarded-For는 TrustProxies로 정한 프록시에서 온 요청일 때만 믿어야 함
+func TestInitRateLimitTrustsOnlyConfiguredProxies(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	limiter, err := ratelimit.New(store, ratelimit.Options{Name: "init", Algorithm: ratelimit.Fixed, Limit: 1, Window: time.Hour})
+	if err != nil {
+		t.Fatalf("ratelimit.New() error = %v", err)
+	}
+	s.LimitInit(limiter)
+	h := s.Handler()
+
+	initFrom := func(remote, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/init", nil)
+		req.RemoteAddr = remote + ":5000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// 기본값은 접속한 주소이므로 헤더를 바꿔 보내도 같은 클라이언트
+	if code := initFrom("192.0.2.1", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	if code := initFrom("192.0.2.1", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("request with a spoofed X-Forwarded-For = %d, want 429", code)
+	}
+
+	if err := s.TrustProxies([]string{"not-a-cidr"}); err == nil {
+		t.Fatal("TrustProxies() with an invalid CIDR error = nil")
+	}
+	if err := s.TrustProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("TrustProxies() error = %v", err)
+	}
+	// 프록시를 거친 요청은 프록시가 붙인 클라이언트 주소로 셈
+	if code := initFrom("10.0.0.5", "198.51.100.3"); code != http.StatusOK {
+		t.Fatalf("request through the proxy = %d, want 200", code)
+	}
+	if code := initFrom("10.0.0.6", "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request for the same client through the proxy = %d, want 429", code)
+	}
+	// 프록시가 아닌 곳에서 온 헤더는 여전히 무시
+	if code := initFrom("192.0.2.1", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Fatalf("direct request with X-Forwarded-For = %d, want 429", code)
+	}
+}
+
+func TestInitSelectsSMSLocale(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	h := s.Handler()
+
+	cases := []struct {
+		path, acceptLanguage, want string
+	}{
+		{"/auth/init", "", "ko"},
+		{"/auth/init", "en-US,en;q=0.9", "en"},
+		// 파라미터가 헤더보다 우선
+		{"/auth/init?locale=ko", "en-US,en;q=0.9", "ko"},
+		{"/auth/init?locale=en", "", "en"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		if tc.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", tc.acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s status = %d, want 200", tc.path, rec.Code)
+		}
+		var body auth.AuthInitResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if body.Locale != tc.want || !strings.Contains(body.SMSBody, "[MAPAE:") {
+			t.Fatalf("POST %s (Accept-Language %q) = %s %q, want %s", tc.path, tc.acceptLanguage, body.Locale, body.SMSBody, tc.want)
+		}
+	}
+}
+
+func TestInitAcceptsClientData(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	h := s.Handler()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/init", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"state":"xyz","client_reference":"user-42","metadata":{"plan":"pro"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/init status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var initBody auth.AuthInitResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &initBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	check := request(t, h, http.MethodGet, "/auth/check/"+initBody.AuthID, "")
+	var checkBody auth.AuthCheckResponse
+	if err := json.Unmarshal(check.Body.Bytes(), &checkBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if checkBody.State != "xyz" || checkBody.ClientReference != "user-42" || checkBody.Metadata["plan"] != "pro" {
+		t.Fatalf("check response = %s, want client data echoed", check.Body.String())
+	}
+	if log := request(t, h, http.MethodGet, "/auth/webhooks/"+initBody.AuthID, ""); log.Code != http.StatusOK || strings.TrimSpace(log.Body.String()) != `{"attempts":[]}` {
+		t.Fatalf("GET /auth/webhooks = %d %s, want 200 with no attempts", log.Code, log.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"state":`,
+		`{"clientReference":"user-42"}`,
+		`{"metadata":{"plan":1}}`,
+		`{"state":"` + strings.Repeat("s", auth.MaxStateLength+1) + `"}`,
+		`{"metadata":{"note":"` + strings.Repeat("n", maxInitBodyBytes) + `"}}`,
+		`{"expected_phone":"12"}`,
+		`{"expected_phone":"01012345678","expected_phone_hash":"` + auth.PhoneHash("01012345678") + `"}`,
+		// 웹훅을 설정하지 않았으면 세션별 주소도 받지 않음
+		`{"webhook_url":"https://api.example/hook"}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("POST /auth/init with %.40q status = %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := post(`{"expected_phone":"010-1234-5678","state":"xyz"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/init with expected_phone status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(""); rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/init without body status = %d, want 200", rec.Code)
+	}
+}
+
+func TestCancelAndUnknownStatusCodes(t *testing.T) {
+	s, _ := makeHTTPServer(t, false)
+	s.settings.SessionTombstoneTTLSeconds = 3600
+	h := s.Handler()
+
+	initResp := request(t, h, http.MethodPost, "/auth/init", "")
+	var initBody auth.AuthInitResponse
+	if err := json.Unmarshal(initResp.Body.Bytes(), &initBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	cancel := request(t, h, http.MethodPost, "/auth/cancel/"+initBody.AuthID, "")
+	var cancelBody auth.AuthCheckResponse
+	if err := json.Unmarshal(cancel.Body.Bytes(), &cancelBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if cancel.Code != http.StatusOK || cancelBody.Status != auth.StatusCancelled {
+		t.Fatalf("POST /auth/cancel = %d %s, want 200 cancelled", cancel.Code, cancel.Body.String())
+	}
+	if again := request(t, h, http.MethodPost, "/auth/cancel/"+initBody.AuthID, ""); again.Code != http.StatusConflict {
+		t.Fatalf("second POST /auth/cancel status = %d, want 409", again.Code)
+	}
+	check := request(t, h, http.MethodGet, "/auth/check/"+initBody.AuthID, "")
+	if check.Code != http.StatusOK || !strings.Contains(check.Body.String(), `"status":"cancelled"`) {
+		t.Fatalf("GET /auth/check after cancel = %d %s", check.Code, check.Body.String())
+	}
+
+	unknownID := strings.Repeat("e", 32)
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/auth/check/" + unknownID},
+		{http.MethodGet, "/auth/check-signed/" + unknownID},
+		{http.MethodPost, "/auth/cancel/" + unknownID},
+	} {
+		rec := request(t, h, tc.method, tc.path, "")
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"status":"unknown"`) {
+			t.Fatalf("%s %s = %d %s, want 404 unknown", tc.method, tc.path, rec.Code, rec.Body.String())
+		}
+	}
+	if bad := request(t, h, http.MethodPost, "/auth/cancel/not-valid", ""); bad.Code != http.StatusBadRequest {
+		t.Fatalf("POST /auth/cancel/not-valid status = %d, want 400", bad.Code)
+	}
+}
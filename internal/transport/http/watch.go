@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"mapae/internal/auth"
+)
+
+// authWatch는 상태 변경 알림을 받으며 auth_id의 상태를 다시 조회. 상태 스트림과 긴 폴링이 함께 씀
+type authWatch struct {
+	svc     *auth.Service
+	authID  string
+	updates <-chan string
+}
+
+// watchEvent는 authWatch.wait가 돌아온 이유
+type watchEvent int
+
+const (
+	watchChanged watchEvent = iota
+	watchTick
+	// watchClosed 뒤의 wait는 다시 조회할 시각만 기다림
+	watchClosed
+	watchDone
+)
+
+// watchAuth는 auth_id를 구독한 뒤 현재 상태를 조회
+// 조회와 구독 사이에 바뀐 상태를 놓치지 않도록 구독을 먼저 함
+func watchAuth(ctx context.Context, svc *auth.Service, authID string) (*authWatch, *auth.AuthCheckResponse, error) {
+	updates, err := svc.SubscribeAuth(ctx, authID)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := svc.CheckAuth(ctx, authID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &authWatch{svc: svc, authID: authID, updates: updates}, resp, nil
+}
+
+// wait는 알림이나 recheck 경과(watchChanged), tick, 구독 끊김, ctx 종료 중 먼저 일어난 것을 반환
+// 알림은 신호일 뿐이므로 실제 상태는 check로 다시 조회
+func (w *authWatch) wait(ctx context.Context, recheck time.Duration, tick <-chan time.Time) watchEvent {
+	timer := time.NewTimer(recheck)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return watchDone
+	case _, ok := <-w.updates:
+		if !ok {
+			w.updates = nil
+			return watchClosed
+		}
+		return watchChanged
+	case <-tick:
+		return watchTick
+	case <-timer.C:
+		return watchChanged
+	}
+}
+
+func (w *authWatch) check(ctx context.Context) (*auth.AuthCheckResponse, error) {
+	return w.svc.CheckAuth(ctx, w.authID)
+}
+
+// expiryRecheck는 resp가 만료된 직후까지의 시간. 이때 다시 조회하면 expired를 받음
+func expiryRecheck(resp *auth.AuthCheckResponse) time.Duration {
+	return time.Duration(resp.ExpiresIn)*time.Second + 500*time.Millisecond
+}
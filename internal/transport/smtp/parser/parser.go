@@ -3,14 +3,13 @@ package parser
 import (
 	"bytes"
 	"encoding/base64"
-	"fmt"
 	"io"
 	"mime/quotedprintable"
 	"regexp"
 	"strings"
-)
 
-const nonceHexLength = 64
+	"mapae/internal/nonce"
+)
 
 var (
 	carrierDomains = map[string]string{
@@ -18,24 +17,9 @@ var (
 		"mmsmail.uplus.co.kr": "LGU+",
 		"mms.kt.co.kr":        "KT",
 	}
-	nonceRe = regexp.MustCompile(fmt.Sprintf(`(?i)\[MAPAE:([0-9a-f]{%d})\]`, nonceHexLength))
 	phoneRe = regexp.MustCompile(`([0-9-]{9,13})@([A-Za-z0-9.-]+)`)
 )
 
-func IsValidNonce(value string) bool {
-	if len(value) != nonceHexLength {
-		return false
-	}
-	for i := 0; i < len(value); i++ {
-		b := value[i]
-		if (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F') {
-			continue
-		}
-		return false
-	}
-	return true
-}
-
 func normalizeDigits(value string) string {
 	var b strings.Builder
 	for _, r := range value {
@@ -106,35 +90,28 @@ func ExtractHeaderFromRaw(raw []byte) string {
 	return ""
 }
 
-func findNonce(text string) string {
+func findNonce(format *nonce.Format, text string) string {
 	if strings.TrimSpace(text) == "" {
 		return ""
 	}
-	match := nonceRe.FindStringSubmatch(text)
-	if len(match) < 2 {
-		return ""
-	}
-	if !IsValidNonce(match[1]) {
-		return ""
-	}
-	return match[1]
+	return format.Find(text)
 }
 
-func FindNonceWithFallback(bodyText string, body []byte) string {
-	if nonce := findNonce(bodyText); nonce != "" {
-		return nonce
+func FindNonceWithFallback(format *nonce.Format, bodyText string, body []byte) string {
+	if code := findNonce(format, bodyText); code != "" {
+		return code
 	}
-	if nonce := findNonce(decodeASCII(body)); nonce != "" {
-		return nonce
+	if code := findNonce(format, decodeASCII(body)); code != "" {
+		return code
 	}
 	if decoded := decodeQuotedPrintable(body); len(decoded) > 0 {
-		if nonce := findNonce(decodeASCII(decoded)); nonce != "" {
-			return nonce
+		if code := findNonce(format, decodeASCII(decoded)); code != "" {
+			return code
 		}
 	}
 	if decoded := decodeBase64(body); len(decoded) > 0 {
-		if nonce := findNonce(decodeASCII(decoded)); nonce != "" {
-			return nonce
+		if code := findNonce(format, decodeASCII(decoded)); code != "" {
+			return code
 		}
 	}
 	return ""
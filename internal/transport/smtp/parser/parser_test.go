@@ -4,18 +4,59 @@ import (
 	"encoding/base64"
 	"strings"
 	"testing"
+
+	"mapae/internal/nonce"
 )
 
-func TestIsValidNonce(t *testing.T) {
-	good := strings.Repeat("a", nonceHexLength)
-	if !IsValidNonce(good) {
-		t.Fatalf("expected valid nonce")
+// hexNonceLength는 기본 형식(hex64) 코드 길이
+const hexNonceLength = 64
+
+type nonceCase struct {
+	name   string
+	format *nonce.Format
+	body   string
+	want   string
+}
+
+// nonceCases는 버퍼 파서와 스트리밍 파서가 똑같이 처리해야 하는 본문
+func nonceCases(t *testing.T) []nonceCase {
+	t.Helper()
+	otpHex, err := nonce.New(nonce.Hex64, "OTP", 0)
+	if err != nil {
+		t.Fatalf("nonce.New() error = %v", err)
+	}
+	otpBase32, err := nonce.New(nonce.Base32, "OTP", 8)
+	if err != nil {
+		t.Fatalf("nonce.New() error = %v", err)
 	}
-	if IsValidNonce(good+"0") {
-		t.Fatalf("nonce with invalid length should fail")
+	code, err := otpBase32.Codec.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
 	}
-	if IsValidNonce(good[:63] + "z") {
-		t.Fatalf("nonce with non-hex char should fail")
+	badCheck := code[:8] + "0"
+	if code[8] == '0' {
+		badCheck = code[:8] + "1"
+	}
+	hexCode := strings.Repeat("ab", hexNonceLength/2)
+
+	return []nonceCase{
+		{"hex upper case", nonce.Default(), "hello [mapae:" + strings.ToUpper(hexCode) + "] world", hexCode},
+		{"hex wrong length", nonce.Default(), "[MAPAE:" + hexCode[:63] + "]", ""},
+		{"hex too long", nonce.Default(), "[MAPAE:" + hexCode + "0]", ""},
+		{"custom tag", otpHex, "[OTP:" + hexCode + "]", hexCode},
+		{"other tag", otpHex, "[MAPAE:" + hexCode + "]", ""},
+		{"base32 typed", otpBase32, "code [otp:" + strings.ToLower(code[:4]) + "-" + strings.ToLower(code[4:]) + "]", code},
+		{"base32 bad check then good", otpBase32, "[OTP:" + badCheck + "] [OTP:" + code + "]", code},
+		{"base32 split by space", otpBase32, "[OTP:" + code[:4] + " " + code[4:] + "]", ""},
+		{"nested bracket", otpBase32, "[[OTP:" + code + "]", code},
+	}
+}
+
+func TestFindNonceFormats(t *testing.T) {
+	for _, tc := range nonceCases(t) {
+		if got := FindNonceWithFallback(tc.format, tc.body, nil); got != tc.want {
+			t.Fatalf("%s: FindNonceWithFallback() = %q, want %q", tc.name, got, tc.want)
+		}
 	}
 }
 
@@ -43,8 +84,8 @@ func TestExtractPhoneAndCarrier(t *testing.T) {
 }
 
 func TestParseBodyMultipartBase64(t *testing.T) {
-	nonce := strings.Repeat("a", nonceHexLength)
-	text := "hello [MAPAE:" + nonce + "] world"
+	code := strings.Repeat("a", hexNonceLength)
+	text := "hello [MAPAE:" + code + "] world"
 	enc := base64.StdEncoding.EncodeToString([]byte(text))
 	raw := strings.Join([]string{
 		"From: 010-1234-5678@mms.kt.co.kr",
@@ -69,15 +110,15 @@ func TestParseBodyMultipartBase64(t *testing.T) {
 }
 
 func TestFindNonceWithFallback(t *testing.T) {
-	nonce := strings.Repeat("b", nonceHexLength)
-	encoded := base64.StdEncoding.EncodeToString([]byte("prefix [MAPAE:" + nonce + "] suffix"))
+	code := strings.Repeat("b", hexNonceLength)
+	encoded := base64.StdEncoding.EncodeToString([]byte("prefix [MAPAE:" + code + "] suffix"))
 
-	got := FindNonceWithFallback("no nonce here", []byte(encoded))
-	if got != nonce {
-		t.Fatalf("FindNonceWithFallback = %q, want %q", got, nonce)
+	got := FindNonceWithFallback(nonce.Default(), "no code here", []byte(encoded))
+	if got != code {
+		t.Fatalf("FindNonceWithFallback = %q, want %q", got, code)
 	}
 
-	if got := FindNonceWithFallback("", []byte("nothing")); got != "" {
+	if got := FindNonceWithFallback(nonce.Default(), "", []byte("nothing")); got != "" {
 		t.Fatalf("FindNonceWithFallback should return empty when absent, got %q", got)
 	}
 }
@@ -10,6 +10,8 @@ import (
 	"mime/quotedprintable"
 	"net/textproto"
 	"strings"
+
+	"mapae/internal/nonce"
 )
 
 var ErrMessageTooLarge = errors.New("message_too_large")
@@ -38,14 +40,23 @@ func (l *countingLimitReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// nonceScanner는 바이트를 하나씩 받아 "[<태그>:<코드>]"를 찾음(태그는 대소문자 구분 없음)
+// ']' 전까지 코덱이 허용하는 문자만 수집하고, 코덱이 정규형으로 바꿀 수 있을 때만 nonce로 인정
 type nonceScanner struct {
-	state  int
-	digits []byte
-	found  string
+	format *nonce.Format
+	// prefix는 "[<태그>:", matched는 지금까지 일치한 길이
+	prefix  string
+	matched int
+	code    []byte
+	found   string
 }
 
-func newNonceScanner() *nonceScanner {
-	return &nonceScanner{digits: make([]byte, 0, nonceHexLength)}
+func newNonceScanner(format *nonce.Format) *nonceScanner {
+	return &nonceScanner{
+		format: format,
+		prefix: "[" + format.Tag + ":",
+		code:   make([]byte, 0, format.Codec.MaxLen()),
+	}
 }
 
 func (s *nonceScanner) Found() bool { return s.found != "" }
@@ -54,15 +65,15 @@ func (s *nonceScanner) Nonce() string {
 }
 
 func (s *nonceScanner) reset() {
-	s.state = 0
-	s.digits = s.digits[:0]
+	s.matched = 0
+	s.code = s.code[:0]
 }
 
 func (s *nonceScanner) resetAndMaybeStart(b byte) {
 	s.reset()
-	// 현재 바이트가 '['이면 시작 상태로 재진입
+	// 현재 바이트가 '['이면 시작 상태로 재진입(태그에는 '['가 없으므로 다른 위치에서 다시 시작할 필요 없음)
 	if b == '[' {
-		s.state = 1
+		s.matched = 1
 	}
 }
 
@@ -71,72 +82,35 @@ func (s *nonceScanner) scanByte(b byte) {
 		return
 	}
 
-	// 대소문자 구분 없이 "[MAPAE:" 패턴을 찾고, ']' 전까지 HEX 수집
-	// 정확히 64자리 HEX일 때만 nonce로 인정
-	switch s.state {
-	case 0:
-		if b == '[' {
-			s.state = 1
-		}
-	case 1:
-		if b == 'M' || b == 'm' {
-			s.state = 2
-		} else if b == '[' {
-			s.state = 1
-		} else {
-			s.state = 0
-		}
-	case 2:
-		if b == 'A' || b == 'a' {
-			s.state = 3
-		} else {
-			s.resetAndMaybeStart(b)
-		}
-	case 3:
-		if b == 'P' || b == 'p' {
-			s.state = 4
-		} else {
-			s.resetAndMaybeStart(b)
-		}
-	case 4:
-		if b == 'A' || b == 'a' {
-			s.state = 5
-		} else {
-			s.resetAndMaybeStart(b)
-		}
-	case 5:
-		if b == 'E' || b == 'e' {
-			s.state = 6
+	if s.matched < len(s.prefix) {
+		if lowerASCII(b) == lowerASCII(s.prefix[s.matched]) {
+			s.matched++
 		} else {
 			s.resetAndMaybeStart(b)
 		}
-	case 6:
-		if b == ':' {
-			s.state = 7
-			s.digits = s.digits[:0]
-		} else {
-			s.resetAndMaybeStart(b)
-		}
-	case 7:
-		switch {
-		case b == ']':
-			if len(s.digits) == nonceHexLength {
-				s.found = string(s.digits)
-				return
-			}
-			s.reset()
-		case b == ' ' || b == '\r' || b == '\n' || b == '\t':
-			s.reset()
-		case (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F'):
-			if len(s.digits) >= nonceHexLength {
-				s.reset()
-				return
-			}
-			s.digits = append(s.digits, b)
-		default:
-			s.resetAndMaybeStart(b)
+		return
+	}
+
+	switch {
+	case b == ']':
+		if code, ok := s.format.Codec.Normalize(string(s.code)); ok {
+			s.found = code
+			return
 		}
+		s.reset()
+	case s.format.Codec.IsCodeByte(b) && len(s.code) < s.format.Codec.MaxLen():
+		s.code = append(s.code, b)
+	default:
+		// 공백, 허용하지 않는 문자, 최대 길이 초과
+		s.resetAndMaybeStart(b)
+	}
+}
+
+func lowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
 	}
+	return b
 }
 
 func (s *nonceScanner) Scan(p []byte) {
@@ -298,12 +272,13 @@ func scanEntity(body io.Reader, header textproto.MIMEHeader, sc *nonceScanner, d
 	return scanLeafBody(body, cte, sc)
 }
 
-// StreamExtractHeaderFromAndNonce는 MIME 헤더를 파싱하고, 메시지를 스트리밍으로 읽으며 MAPAE nonce(논스)를 찾음
+// StreamExtractHeaderFromAndNonce는 MIME 헤더를 파싱하고, 메시지를 스트리밍으로 읽으며 format 형식의 nonce(논스)를 찾음
 // nonce(논스)를 찾았더라도 SMTP 세션이 꼬이지 않도록 본문은 끝까지 drain
 //
+// - 반환하는 nonce는 코덱의 정규형
 // - limit > 0 이고 메시지가 이를 초과하면 ErrMessageTooLarge 반환
 // - From 헤더가 없거나 파싱 불가하면 headerFrom은 빈 문자열일 수 있음
-func StreamExtractHeaderFromAndNonce(r io.Reader, limit int) (headerFrom string, nonce string, bytesRead int, err error) {
+func StreamExtractHeaderFromAndNonce(r io.Reader, format *nonce.Format, limit int) (headerFrom string, nonce string, bytesRead int, err error) {
 	lr := &countingLimitReader{r: r, limit: limit}
 	br := bufio.NewReader(lr)
 	tr := textproto.NewReader(br)
@@ -322,7 +297,7 @@ func StreamExtractHeaderFromAndNonce(r io.Reader, limit int) (headerFrom string,
 
 	headerFrom = strings.TrimSpace(hdr.Get("From"))
 
-	sc := newNonceScanner()
+	sc := newNonceScanner(format)
 	// bufio.Reader를 그대로 본문 스트림으로 사용(이미 읽혀 버퍼에 남은 바이트 포함)
 	if err := scanEntity(br, hdr, sc, 0); err != nil {
 		return headerFrom, "", lr.n, err
@@ -6,21 +6,23 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+
+	"mapae/internal/nonce"
 )
 
 func TestStreamExtractHeaderFromAndNoncePlain(t *testing.T) {
-	nonce := strings.Repeat("c", nonceHexLength)
-	msg := fmt.Sprintf("From: 01012345678@mms.kt.co.kr\r\nContent-Type: text/plain\r\n\r\nhello [MAPAE:%s]", nonce)
+	code := strings.Repeat("c", hexNonceLength)
+	msg := fmt.Sprintf("From: 01012345678@mms.kt.co.kr\r\nContent-Type: text/plain\r\n\r\nhello [MAPAE:%s]", code)
 
-	from, gotNonce, n, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), 0)
+	from, gotNonce, n, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), nonce.Default(), 0)
 	if err != nil {
 		t.Fatalf("StreamExtractHeaderFromAndNonce() error = %v", err)
 	}
 	if from != "01012345678@mms.kt.co.kr" {
 		t.Fatalf("from = %q", from)
 	}
-	if gotNonce != nonce {
-		t.Fatalf("nonce = %q, want %q", gotNonce, nonce)
+	if gotNonce != code {
+		t.Fatalf("nonce = %q, want %q", gotNonce, code)
 	}
 	if n <= 0 {
 		t.Fatalf("bytesRead = %d, want > 0", n)
@@ -28,27 +30,27 @@ func TestStreamExtractHeaderFromAndNoncePlain(t *testing.T) {
 }
 
 func TestStreamExtractHeaderFromAndNonceBase64(t *testing.T) {
-	nonce := strings.Repeat("d", nonceHexLength)
-	body := base64.StdEncoding.EncodeToString([]byte("[MAPAE:" + nonce + "]"))
+	code := strings.Repeat("d", hexNonceLength)
+	body := base64.StdEncoding.EncodeToString([]byte("[MAPAE:" + code + "]"))
 	msg := "From: user@example.com\r\n" +
 		"Content-Type: text/plain\r\n" +
 		"Content-Transfer-Encoding: base64\r\n\r\n" +
 		"  " + body + "\r\n"
 
-	_, gotNonce, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), 0)
+	_, gotNonce, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), nonce.Default(), 0)
 	if err != nil {
 		t.Fatalf("StreamExtractHeaderFromAndNonce() error = %v", err)
 	}
-	if gotNonce != nonce {
-		t.Fatalf("nonce = %q, want %q", gotNonce, nonce)
+	if gotNonce != code {
+		t.Fatalf("nonce = %q, want %q", gotNonce, code)
 	}
 }
 
 func TestStreamExtractHeaderFromAndNonceMessageTooLarge(t *testing.T) {
-	nonce := strings.Repeat("e", nonceHexLength)
-	msg := fmt.Sprintf("From: user@example.com\r\n\r\n[MAPAE:%s]", nonce)
+	code := strings.Repeat("e", hexNonceLength)
+	msg := fmt.Sprintf("From: user@example.com\r\n\r\n[MAPAE:%s]", code)
 
-	_, _, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), 10)
+	_, _, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), nonce.Default(), 10)
 	if !errors.Is(err, ErrMessageTooLarge) {
 		t.Fatalf("error = %v, want ErrMessageTooLarge", err)
 	}
@@ -56,14 +58,27 @@ func TestStreamExtractHeaderFromAndNonceMessageTooLarge(t *testing.T) {
 
 func TestStreamExtractHeaderFromAndNonceNoNonce(t *testing.T) {
 	msg := "From: user@example.com\r\n\r\nhello"
-	from, nonce, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), 0)
+	from, code, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), nonce.Default(), 0)
 	if err != nil {
 		t.Fatalf("StreamExtractHeaderFromAndNonce() error = %v", err)
 	}
 	if from != "user@example.com" {
 		t.Fatalf("from = %q", from)
 	}
-	if nonce != "" {
-		t.Fatalf("nonce should be empty, got %q", nonce)
+	if code != "" {
+		t.Fatalf("nonce should be empty, got %q", code)
+	}
+}
+
+func TestStreamExtractHeaderFromAndNonceFormats(t *testing.T) {
+	for _, tc := range nonceCases(t) {
+		msg := "From: user@example.com\r\nContent-Type: text/plain\r\n\r\n" + tc.body
+		_, got, _, err := StreamExtractHeaderFromAndNonce(strings.NewReader(msg), tc.format, 0)
+		if err != nil {
+			t.Fatalf("%s: StreamExtractHeaderFromAndNonce() error = %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: nonce = %q, want %q", tc.name, got, tc.want)
+		}
 	}
 }
@@ -16,15 +16,17 @@ import (
 	"mapae/internal/auth"
 	"mapae/internal/config"
 	"mapae/internal/logging"
+	"mapae/internal/ratelimit"
 	"mapae/internal/transport/smtp/parser"
 )
 
 type Server struct {
-	settings *config.Settings
-	auth     *auth.Service
-	logger   *logging.Logger
-	server   *smtpserver.Server
-	baseCtx  context.Context
+	settings      *config.Settings
+	auth          *auth.Service
+	logger        *logging.Logger
+	server        *smtpserver.Server
+	baseCtx       context.Context
+	senderLimiter ratelimit.Limiter
 }
 
 type backend struct {
@@ -48,6 +50,12 @@ func NewServer(settings *config.Settings, authService *auth.Service, logger *log
 	}
 }
 
+// LimitSenders는 봉투 발신자(MAIL FROM)별 메시지 수를 limiter에 따라 제한
+// 통신사 게이트웨이는 소수의 IP로 모든 메시지를 보내므로 IP가 아닌 발신 번호 단위로 셈
+func (s *Server) LimitSenders(limiter ratelimit.Limiter) {
+	s.senderLimiter = limiter
+}
+
 func (s *Server) Run(ctx context.Context) error {
 	be := &backend{server: s}
 	server := smtpserver.NewServer(be)
@@ -83,6 +91,30 @@ func (b *backend) NewSession(c *smtpserver.Conn) (smtpserver.Session, error) {
 
 func (s *session) Mail(from string, _ *smtpserver.MailOptions) error {
 	s.mailFrom = strings.TrimSpace(from)
+	return s.server.allowSender(s.ctx, s.mailFrom)
+}
+
+// allowSender는 한도를 넘은 발신자에게 일시 오류(450)를 돌려 통신사가 나중에 재전송하게 함
+// 제한기(저장소) 오류로 정상 메시지까지 막지 않도록 오류가 나면 허용
+func (s *Server) allowSender(ctx context.Context, mailFrom string) error {
+	sender := strings.ToLower(sanitizeSender(mailFrom))
+	if s.senderLimiter == nil || sender == "" {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	d, err := s.senderLimiter.Allow(ctx, sender)
+	if err != nil {
+		s.logger.Printf("rate limit error: %v", err)
+		return nil
+	}
+	if !d.Allowed {
+		s.logger.Printf("Rate limit exceeded: mail_from=%s retry_after=%s", maskEmailLocalPart(mailFrom), d.RetryAfter.Round(time.Second))
+		return &smtpserver.SMTPError{Code: 450, Message: "Rate limit exceeded, try again later"}
+	}
 	return nil
 }
 
@@ -106,7 +138,7 @@ func (s *session) Data(r io.Reader) error {
 
 	// DumpInbound가 꺼져 있으면, 본문 전체를 메모리에 올리지 않고 스트리밍으로 nonce(논스)만 추출한다.
 	if !s.server.settings.DumpInbound {
-		headerFrom, nonce, _, err := parser.StreamExtractHeaderFromAndNonce(r, s.server.settings.DataSizeLimitBytes)
+		headerFrom, nonce, _, err := parser.StreamExtractHeaderFromAndNonce(r, s.server.auth.NonceFormat(), s.server.settings.DataSizeLimitBytes)
 		if err != nil {
 			if errors.Is(err, parser.ErrMessageTooLarge) {
 				s.server.logger.Printf("Message too large (limit=%d bytes)", s.server.settings.DataSizeLimitBytes)
@@ -150,7 +182,7 @@ func (s *Server) handleData(ctx context.Context, sess *session, raw []byte) erro
 		headerFrom = parser.ExtractHeaderFromRaw(raw)
 	}
 
-	nonce := parser.FindNonceWithFallback(bodyText, bodyBytes)
+	nonce := parser.FindNonceWithFallback(s.auth.NonceFormat(), bodyText, bodyBytes)
 	return s.handleParsed(ctx, sess, headerFrom, nonce, len(raw), bodyText)
 }
 
@@ -218,6 +250,7 @@ func (s *Server) handleParsed(ctx context.Context, sess *session, headerFrom, no
 				return &smtpserver.SMTPError{Code: 451, Message: "SPF temperror"}
 			}
 			s.logger.Printf("SPF fail: ip=%s mail_from=%s header_from=%s", peerIP.String(), mailFrom, headerFrom)
+			s.recordFailure(ctx, nonce, auth.FailureSPF)
 			return &smtpserver.SMTPError{Code: 550, Message: "SPF fail"}
 		}
 	}
@@ -231,6 +264,7 @@ func (s *Server) handleParsed(ctx context.Context, sess *session, headerFrom, no
 	}
 	if carrier == nil {
 		s.logger.Printf("Carrier domain not recognized")
+		s.recordFailure(ctx, nonce, auth.FailureUnknownCarrier)
 		return &smtpserver.SMTPError{Code: 550, Message: "Invalid carrier domain"}
 	}
 
@@ -247,31 +281,61 @@ func (s *Server) handleParsed(ctx context.Context, sess *session, headerFrom, no
 		}
 	}
 
-	if !parser.IsValidNonce(nonce) {
+	// 파서는 형식과 검사 문자가 맞는 nonce만 반환
+	if nonce == "" {
 		s.logger.Printf("Invalid nonce format")
 		return &smtpserver.SMTPError{Code: 550, Message: "Invalid nonce"}
 	}
 
-	authID, ok, err := s.auth.ConsumeAuthIDByNonce(ctx, nonce)
+	// nonce 소비와 인증 완료 기록을 한 번에 처리하므로, 실패 시 nonce가 남아 있어 통신사 재전송으로 복구됨
+	finished, ok, err := s.auth.VerifyByNonce(ctx, nonce, phone, carrier)
+	authID = finished.AuthID
+	if errors.Is(err, auth.ErrPhoneMismatch) {
+		// nonce는 소비되고 mismatch가 기록되었으므로 재전송하지 않도록 영구 오류로 응답
+		s.logger.Printf("Phone number does not match the expected phone for auth_id %s%s", authID, tenantField(finished))
+		stored = true
+		result = "mismatch"
+		return &smtpserver.SMTPError{Code: 550, Message: "Phone number mismatch"}
+	}
 	if err != nil {
-		s.logger.Printf("Store error while consuming nonce: %v", err)
+		s.logger.Printf("Failed to store verification: %v", err)
 		return &smtpserver.SMTPError{Code: 451, Message: "Temporary server error"}
 	}
 	if !ok {
 		s.logger.Printf("Nonce not found or expired: %s", nonce)
 		return &smtpserver.SMTPError{Code: 550, Message: "Invalid nonce"}
 	}
-	if err := s.auth.StoreVerified(ctx, authID, phone, carrier); err != nil {
-		s.logger.Printf("Failed to store verification: %v", err)
-		return &smtpserver.SMTPError{Code: 451, Message: "Temporary server error"}
-	}
 
-	s.logger.Printf("Stored verification for auth_id %s", authID)
+	s.logger.Printf("Stored verification for auth_id %s%s", authID, tenantField(finished))
 	stored = true
 	result = "pass"
 	return nil
 }
 
+// recordFailure는 거부한 문자의 nonce로 세션을 찾을 수 있으면 실패 사유를 기록해 사용자가 만료까지 기다리지 않게 함
+// 응답은 이미 거부로 정해졌으므로 기록에 실패해도 로그만 남김
+func (s *Server) recordFailure(ctx context.Context, nonce string, reason auth.FailureReason) {
+	if nonce == "" {
+		return
+	}
+	finished, ok, err := s.auth.FailByNonce(ctx, nonce, reason)
+	if err != nil {
+		s.logger.Printf("Failed to record %s failure: %v", reason, err)
+		return
+	}
+	if ok {
+		s.logger.Printf("Recorded %s failure for auth_id %s%s", reason, finished.AuthID, tenantField(finished))
+	}
+}
+
+// tenantField는 로그에 덧붙일 세션의 클라이언트이며, 클라이언트를 등록하지 않았으면 빈 문자열
+func tenantField(finished auth.NonceResult) string {
+	if finished.Tenant != "" {
+		return " tenant=" + finished.Tenant
+	}
+	return ""
+}
+
 func readData(r io.Reader, limit int) ([]byte, bool, error) {
 	if limit <= 0 {
 		data, err := io.ReadAll(r)
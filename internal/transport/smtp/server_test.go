@@ -1,12 +1,23 @@
 package smtp
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"mime/quotedprintable"
 	"strings"
 	"testing"
+	"time"
 
 	smtpserver "github.com/emersion/go-smtp"
+	"golang.org/x/text/encoding/korean"
 
+	"mapae/internal/auth"
 	"mapae/internal/config"
+	"mapae/internal/logging"
+	"mapae/internal/ratelimit"
+	"mapae/internal/storage/memory"
 )
 
 func TestReadData(t *testing.T) {
@@ -93,3 +104,157 @@ func TestSessionRcpt(t *testing.T) {
 		t.Fatalf("SMTP error code = %d, want 550", smtpErr.Code)
 	}
 }
+
+func TestSessionMailRateLimitPerSender(t *testing.T) {
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	limiter, err := ratelimit.New(store, ratelimit.Options{Name: "smtp", Algorithm: ratelimit.Fixed, Limit: 1, Window: time.Hour})
+	if err != nil {
+		t.Fatalf("ratelimit.New() error = %v", err)
+	}
+	server := &Server{settings: &config.Settings{}, logger: logging.New("test: ", false)}
+	server.LimitSenders(limiter)
+	sess := &session{server: server}
+
+	if err := sess.Mail("01012345678@ktfmms.magicn.com", nil); err != nil {
+		t.Fatalf("first Mail() error = %v", err)
+	}
+	// 대소문자만 다른 주소도 같은 발신자로 셈
+	err = sess.Mail("<01012345678@KTFMMS.magicn.com>", nil)
+	smtpErr, ok := err.(*smtpserver.SMTPError)
+	if !ok || smtpErr.Code != 450 {
+		t.Fatalf("second Mail() error = %v, want 450", err)
+	}
+	if err := sess.Mail("01099998888@ktfmms.magicn.com", nil); err != nil {
+		t.Fatalf("Mail() from other sender error = %v", err)
+	}
+	// 빈 발신자(바운스)는 제한하지 않음
+	for i := 0; i < 2; i++ {
+		if err := sess.Mail("<>", nil); err != nil {
+			t.Fatalf("Mail(<>) error = %v", err)
+		}
+	}
+}
+
+// 통신사 게이트웨이가 본문을 보내는 여러 방식
+var inboundEncodings = map[string]func(t *testing.T, body string) string{
+	"utf-8 8bit": func(t *testing.T, body string) string {
+		return "Content-Type: text/plain; charset=utf-8\r\n\r\n" + body
+	},
+	"utf-8 base64": func(t *testing.T, body string) string {
+		return "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(body))
+	},
+	"utf-8 quoted-printable": func(t *testing.T, body string) string {
+		var buf bytes.Buffer
+		w := quotedprintable.NewWriter(&buf)
+		_, _ = w.Write([]byte(body))
+		_ = w.Close()
+		return "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" + buf.String()
+	},
+	"euc-kr base64": func(t *testing.T, body string) string {
+		encoded, err := korean.EUCKR.NewEncoder().String(body)
+		if err != nil {
+			t.Fatalf("EUC-KR encode error = %v", err)
+		}
+		return "Content-Type: text/plain; charset=euc-kr\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(encoded))
+	},
+}
+
+func TestDataVerifiesEveryRenderedTemplate(t *testing.T) {
+	settings := &config.Settings{AuthTTLSeconds: 60, VerifiedTTLSeconds: 30, NonceFormat: "base32", SMSBodyLimit: "sms"}
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	authSvc, err := auth.New(store, settings)
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	server := &Server{settings: settings, auth: authSvc, logger: logging.New("test: ", false)}
+	ctx := context.Background()
+
+	// 스트리밍 파서(DumpInbound=false)와 버퍼 파서(DumpInbound=true) 모두 확인
+	for _, dump := range []bool{false, true} {
+		settings.DumpInbound = dump
+		for _, locale := range []string{"ko", "en"} {
+			for name, encode := range inboundEncodings {
+				init, err := authSvc.InitAuthWithOptions(ctx, auth.InitOptions{Locale: locale})
+				if err != nil {
+					t.Fatalf("InitAuthWithOptions() error = %v", err)
+				}
+				msg := "From: 01012345678@mms.kt.co.kr\r\n" + encode(t, init.SMSBody)
+				sess := &session{server: server, mailFrom: "01012345678@mms.kt.co.kr", ctx: ctx}
+				if err := sess.Data(strings.NewReader(msg)); err != nil {
+					t.Fatalf("dump=%t %s %s: Data() error = %v", dump, locale, name, err)
+				}
+				check, err := authSvc.CheckAuth(ctx, init.AuthID)
+				if err != nil || check.Status != "verified" {
+					t.Fatalf("dump=%t %s %s: CheckAuth() = (%#v, %v), want verified", dump, locale, name, check, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDataRejectsUnexpectedPhone(t *testing.T) {
+	settings := &config.Settings{AuthTTLSeconds: 60, VerifiedTTLSeconds: 30}
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	authSvc, err := auth.New(store, settings)
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	server := &Server{settings: settings, auth: authSvc, logger: logging.New("test: ", false)}
+	ctx := context.Background()
+
+	init, err := authSvc.InitAuthWithOptions(ctx, auth.InitOptions{ExpectedPhone: "010-9999-8888"})
+	if err != nil {
+		t.Fatalf("InitAuthWithOptions() error = %v", err)
+	}
+	msg := "From: 01012345678@mms.kt.co.kr\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" + init.SMSBody
+	sess := &session{server: server, mailFrom: "01012345678@mms.kt.co.kr", ctx: ctx}
+	err = sess.Data(strings.NewReader(msg))
+	var smtpErr *smtpserver.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 550 {
+		t.Fatalf("Data() error = %v, want 550", err)
+	}
+	check, err := authSvc.CheckAuth(ctx, init.AuthID)
+	if err != nil || check.Status != auth.StatusFailed || check.Reason != string(auth.FailurePhoneMismatch) || check.Phone != "" {
+		t.Fatalf("CheckAuth() = (%#v, %v), want failed phone_mismatch without phone", check, err)
+	}
+}
+
+func TestDataRecordsFailureReason(t *testing.T) {
+	settings := &config.Settings{AuthTTLSeconds: 60, VerifiedTTLSeconds: 30}
+	store, err := memory.New()
+	if err != nil {
+		t.Fatalf("memory.New() error = %v", err)
+	}
+	authSvc, err := auth.New(store, settings)
+	if err != nil {
+		t.Fatalf("auth.New() error = %v", err)
+	}
+	server := &Server{settings: settings, auth: authSvc, logger: logging.New("test: ", false)}
+	ctx := context.Background()
+
+	init, err := authSvc.InitAuth(ctx)
+	if err != nil {
+		t.Fatalf("InitAuth() error = %v", err)
+	}
+	msg := "From: 01012345678@mail.example\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" + init.SMSBody
+	sess := &session{server: server, mailFrom: "01012345678@mail.example", ctx: ctx}
+	var smtpErr *smtpserver.SMTPError
+	if err := sess.Data(strings.NewReader(msg)); !errors.As(err, &smtpErr) || smtpErr.Code != 550 {
+		t.Fatalf("Data() error = %v, want 550", err)
+	}
+	check, err := authSvc.CheckAuth(ctx, init.AuthID)
+	if err != nil || check.Status != auth.StatusFailed || check.Reason != string(auth.FailureUnknownCarrier) {
+		t.Fatalf("CheckAuth() = (%#v, %v), want failed unknown_carrier", check, err)
+	}
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 요청 헤더. 수신 측은 Verify로 서명과 시각을 확인하고, 같은 ID를 두 번 처리하지 않아야 함
+const (
+	HeaderID        = "Mapae-Webhook-Id"
+	HeaderTimestamp = "Mapae-Webhook-Timestamp"
+	HeaderSignature = "Mapae-Webhook-Signature"
+
+	// DefaultTolerance는 Verify가 허용하는 발송 시각과 수신 시각의 차이
+	DefaultTolerance = 5 * time.Minute
+
+	signatureVersion = "v1"
+)
+
+var (
+	ErrMissingHeaders   = errors.New("webhook: missing signature headers")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrTimestampOutOfRange는 요청 시각이 허용 범위를 벗어났을 때 반환. 가로챈 요청을 나중에 다시 보내는 공격을 막음
+	ErrTimestampOutOfRange = errors.New("webhook: timestamp outside tolerance")
+)
+
+// Sign은 "<id>.<unix 초>.<본문>"의 HMAC-SHA256을 "v1=<16진수>" 형식으로 반환
+// ID를 서명에 포함하므로 ID를 바꿔 중복 제거를 우회할 수 없음
+func Sign(secret, id string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureHeader는 모든 비밀 키로 서명한 값을 ","로 이음
+// 키를 교체하는 동안 수신 측이 새 키와 이전 키 중 하나만 알고 있어도 확인할 수 있음
+func signatureHeader(secrets []string, id string, timestamp int64, body []byte) string {
+	signatures := make([]string, len(secrets))
+	for i, secret := range secrets {
+		signatures[i] = Sign(secret, id, timestamp, body)
+	}
+	return strings.Join(signatures, ",")
+}
+
+// Verify는 수신한 요청의 서명과 시각을 확인하고 이벤트 ID를 반환
+// secrets 중 하나로 만든 서명이 있으면 통과하며, tolerance가 0이면 DefaultTolerance를 사용
+func Verify(secrets []string, header http.Header, body []byte, now time.Time, tolerance time.Duration) (string, error) {
+	id := header.Get(HeaderID)
+	rawTimestamp := header.Get(HeaderTimestamp)
+	rawSignatures := header.Get(HeaderSignature)
+	if id == "" || rawTimestamp == "" || rawSignatures == "" {
+		return "", ErrMissingHeaders
+	}
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return "", ErrMissingHeaders
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if diff := now.Sub(time.Unix(timestamp, 0)); diff > tolerance || diff < -tolerance {
+		return "", ErrTimestampOutOfRange
+	}
+	for _, secret := range secrets {
+		expected := []byte(Sign(secret, id, timestamp, body))
+		for _, signature := range strings.Split(rawSignatures, ",") {
+			if hmac.Equal([]byte(strings.TrimSpace(signature)), expected) {
+				return id, nil
+			}
+		}
+	}
+	return "", ErrInvalidSignature
+}
@@ -0,0 +1,574 @@
+// Package webhook는 인증 이벤트를 클라이언트 서버에 알리는 서명된 웹훅
+//
+// 보낼 이벤트를 storage.Store의 기록과 queue(outbox)에 먼저 남기고 Run이 꺼내 보내므로,
+// 인스턴스가 재시작하거나 수신 서버가 잠시 응답하지 않아도 전송을 이어가며 같은 저장소를 쓰는 인스턴스가 나눠 처리함
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mapae/internal/logging"
+	"mapae/internal/storage"
+)
+
+// 이벤트 종류
+const (
+	EventVerified = "auth.verified"
+	EventFailed   = "auth.failed"
+	EventExpired  = "auth.expired"
+)
+
+// 전송 결과
+const (
+	OutcomeDelivered = "delivered"
+	OutcomeRetrying  = "retrying"
+	OutcomeFailed    = "failed"
+)
+
+const (
+	dueQueue          = "webhook:due"
+	deliveryKeyPrefix = "webhook:delivery:"
+	logKeyPrefix      = "webhook:log:"
+
+	// maxLogEntries는 대상 하나에 남기는 전송 기록 수. 넘으면 오래된 것부터 버림
+	maxLogEntries = 50
+	// maxResponseBytes는 연결을 재사용하기 위해 읽고 버리는 응답 본문 크기
+	maxResponseBytes = 64 << 10
+	// claimSlack은 전송 제한 시간에 더해 항목을 다른 인스턴스에 넘기지 않는 여유 시간
+	claimSlack = 30 * time.Second
+	userAgent  = "mapae-webhook/1"
+)
+
+var (
+	ErrNoURL = errors.New("webhook: no target URL")
+	// ErrNoSecret은 이벤트의 클라이언트(또는 기본 설정)에 서명 키가 없을 때 반환
+	ErrNoSecret = errors.New("webhook: no signing secret")
+	// ErrURLNotAllowed는 세션별 URL이 허용 접두사 중 어느 것으로도 시작하지 않을 때 반환
+	ErrURLNotAllowed = errors.New("webhook: URL is not allowed")
+)
+
+// Codec은 저장소에 쓰는 전송 기록을 암호화. 이벤트 본문에 휴대폰 번호가 들어가므로 평문으로 남기지 않기 위한 용도
+// key는 값을 저장하는 키이며, 다른 키의 값과 바꿔치기할 수 없도록 암호문에 묶는 데 씀
+type Codec interface {
+	Seal(key, value string) (string, error)
+	Open(key, value string) (string, error)
+}
+
+type Options struct {
+	// URL은 클라이언트가 없는 세션에 URL이 없을 때 쓰는 기본 수신 주소. 비어 있으면 URL을 지정한 세션만 알림
+	URL string
+	// AllowedURLPrefixes는 세션별 URL을 허용하는 주소(scheme, host:port가 같고 경로가 그 아래). 비어 있으면 세션별 URL을 받지 않음
+	AllowedURLPrefixes []string
+	// Secrets는 서명 키이며 모든 키로 서명함. 새 키를 추가하고 수신 측이 바꾼 뒤 이전 키를 지우는 방식으로 교체
+	Secrets []string
+	// ClientSecrets는 클라이언트 ID별 서명 키. Delivery.Client가 있는 이벤트는 그 클라이언트의 키로만 서명함
+	ClientSecrets map[string][]string
+	// Timeout은 전송 1회의 제한 시간(기본 10초)
+	Timeout time.Duration
+	// MaxAttempts는 첫 전송을 포함한 최대 시도 횟수(기본 8)
+	MaxAttempts int
+	// RetryBase와 RetryMax는 재시도 간격. n번째 실패 뒤 min(RetryBase*2^(n-1), RetryMax)의 절반~전체만큼 기다림(기본 10초, 1시간)
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// LogTTL은 전송 기록을 남기는 시간(기본 24시간)
+	LogTTL time.Duration
+	// PollInterval은 처리할 항목을 확인하는 간격(기본 1초). 같은 인스턴스에서 넣은 항목은 바로 확인함
+	PollInterval time.Duration
+	// BatchSize는 한 번에 가져와 동시에 보내는 항목 수(기본 16)
+	BatchSize int
+	Codec     Codec
+}
+
+// Event는 수신 서버에 보내는 본문. ID는 재시도해도 바뀌지 않으므로 수신 측은 ID로 중복을 걸러야 함
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// CreatedAt은 이벤트가 발생한 시각(unix 초)
+	CreatedAt int64 `json:"created_at"`
+	Data      any   `json:"data"`
+}
+
+// Delivery는 Enqueue로 넣을 이벤트
+type Delivery struct {
+	// ID는 이벤트 ID이자 Cancel에 쓰는 값. 같은 ID로 다시 넣으면 이전 항목을 덮어씀
+	ID string
+	// URL이 비어 있으면 Options.URL로 보냄(Client가 있으면 보내지 않음)
+	URL string
+	// Client는 이벤트를 받을 클라이언트 ID이며, 비어 있으면 Options.Secrets로 서명
+	Client string
+	// Subject는 전송 기록을 묶는 값(예: auth_id)
+	Subject string
+	Type    string
+	Data    any
+}
+
+// Attempt는 전송 1회의 기록
+type Attempt struct {
+	EventID string `json:"event_id"`
+	Type    string `json:"type"`
+	Attempt int    `json:"attempt"`
+	// At은 전송한 시각(unix 초)
+	At         int64  `json:"at"`
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	// NextAttemptAt은 재시도할 시각(unix 초)
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+}
+
+// record는 저장소에 남기는 전송 대기 항목
+type record struct {
+	URL      string `json:"url"`
+	Client   string `json:"client,omitempty"`
+	Subject  string `json:"subject"`
+	Type     string `json:"type"`
+	Body     string `json:"body"`
+	Attempts int    `json:"attempts"`
+}
+
+type Dispatcher struct {
+	store  storage.Store
+	opts   Options
+	logger *logging.Logger
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+	// allowed는 해석해 둔 AllowedURLPrefixes
+	allowed []*url.URL
+}
+
+func New(store storage.Store, opts Options, logger *logging.Logger) (*Dispatcher, error) {
+	if len(opts.Secrets) == 0 && len(opts.ClientSecrets) == 0 {
+		return nil, errors.New("webhook secret is required")
+	}
+	for i, secret := range opts.Secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("webhook secret #%d is empty", i+1)
+		}
+	}
+	for client, secrets := range opts.ClientSecrets {
+		for i, secret := range secrets {
+			if secret == "" {
+				return nil, fmt.Errorf("client %s: webhook secret #%d is empty", client, i+1)
+			}
+		}
+	}
+	if opts.URL != "" {
+		if len(opts.Secrets) == 0 {
+			return nil, errors.New("webhook URL requires a webhook secret")
+		}
+		if _, err := parseURL(opts.URL); err != nil {
+			return nil, err
+		}
+	}
+	allowed := make([]*url.URL, 0, len(opts.AllowedURLPrefixes))
+	for _, prefix := range opts.AllowedURLPrefixes {
+		u, err := parseURL(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("webhook allowed URL prefix: %w", err)
+		}
+		allowed = append(allowed, u)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = 10 * time.Second
+	}
+	if opts.RetryMax < opts.RetryBase {
+		opts.RetryMax = max(time.Hour, opts.RetryBase)
+	}
+	if opts.LogTTL <= 0 {
+		opts.LogTTL = 24 * time.Hour
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 16
+	}
+	return &Dispatcher{
+		store:  store,
+		opts:   opts,
+		logger: logger,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// 리디렉션을 따라가면 허용하지 않은 주소로 보낼 수 있으므로 3xx는 실패로 처리
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+		allowed: allowed,
+	}, nil
+}
+
+// parseURL은 사용자 정보가 없는 http(s) 절대 주소만 해석
+func parseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return nil, fmt.Errorf("webhook URL must be an absolute http(s) URL without userinfo: %q", raw)
+	}
+	return u, nil
+}
+
+// ValidateURL은 세션별 URL이 허용 접두사 중 하나와 scheme, host:port가 같고 그 경로 아래에 있는지 확인
+// 클라이언트가 임의의 내부 주소로 요청을 보내게 할 수 없도록 허용 목록이 없으면 모두 거부
+func (d *Dispatcher) ValidateURL(raw string) error {
+	u, err := parseURL(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+	for _, prefix := range d.allowed {
+		if urlUnder(u, prefix) {
+			return nil
+		}
+	}
+	return ErrURLNotAllowed
+}
+
+// urlUnder는 u가 prefix와 같은 scheme, host:port이고 경로가 prefix 경로와 같거나 그 하위 세그먼트인지 여부
+// 경로의 "."이나 ".." 세그먼트는 수신 서버가 접두사 밖으로 해석할 수 있으므로 거부
+func urlUnder(u, prefix *url.URL) bool {
+	if !strings.EqualFold(u.Scheme, prefix.Scheme) || hostPort(u) != hostPort(prefix) {
+		return false
+	}
+	path := u.EscapedPath()
+	for _, segment := range strings.Split(path, "/") {
+		if decoded, err := url.PathUnescape(segment); err != nil || decoded == "." || decoded == ".." {
+			return false
+		}
+	}
+	base := strings.TrimSuffix(prefix.EscapedPath(), "/")
+	return base == "" || path == base || strings.HasPrefix(path, base+"/")
+}
+
+// hostPort는 소문자 host와 포트이며, 포트가 없으면 scheme의 기본 포트
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return strings.ToLower(u.Hostname()) + ":" + port
+}
+
+// Target은 client의 이벤트를 보낼 주소. 세션별 URL이 없으면 클라이언트가 없을 때만 기본 URL을 쓰며,
+// 보낼 수 없으면(주소나 서명 키가 없음) 빈 문자열
+func (d *Dispatcher) Target(client, sessionURL string) string {
+	if len(d.secrets(client)) == 0 {
+		return ""
+	}
+	if sessionURL != "" || client != "" {
+		return sessionURL
+	}
+	return d.opts.URL
+}
+
+// secrets는 client의 이벤트에 서명할 키
+func (d *Dispatcher) secrets(client string) []string {
+	if client != "" {
+		return d.opts.ClientSecrets[client]
+	}
+	return d.opts.Secrets
+}
+
+// Enqueue는 이벤트를 저장소에 기록하고 at에 보내도록 queue에 넣음
+// CreatedAt은 at과 현재 시각 중 늦은 쪽이며, 미리 넣어 두는 만료 이벤트도 실제 발생 시각을 가짐
+// 호출하는 쪽이 오류를 무시해도 남도록 실패는 로그에도 기록
+func (d *Dispatcher) Enqueue(ctx context.Context, delivery Delivery, at time.Time) error {
+	if err := d.enqueue(ctx, delivery, at); err != nil {
+		d.logger.Printf("Webhook enqueue error: id=%s err=%v", delivery.ID, err)
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, delivery Delivery, at time.Time) error {
+	if len(d.secrets(delivery.Client)) == 0 {
+		return ErrNoSecret
+	}
+	target := d.Target(delivery.Client, delivery.URL)
+	if target == "" {
+		return ErrNoURL
+	}
+	now := d.now()
+	createdAt := now
+	if at.After(now) {
+		createdAt = at
+	}
+	body, err := json.Marshal(Event{ID: delivery.ID, Type: delivery.Type, CreatedAt: createdAt.Unix(), Data: delivery.Data})
+	if err != nil {
+		return err
+	}
+	rec := record{URL: target, Client: delivery.Client, Subject: delivery.Subject, Type: delivery.Type, Body: string(body)}
+	if err := d.save(ctx, delivery.ID, rec, at.Sub(now)); err != nil {
+		return err
+	}
+	if err := d.store.Schedule(ctx, dueQueue, delivery.ID, at); err != nil {
+		return err
+	}
+	if !at.After(now) {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Cancel은 아직 보내지 않은 이벤트를 지우며, 없으면 아무것도 하지 않음
+func (d *Dispatcher) Cancel(ctx context.Context, id string) error {
+	_, _, err := d.store.Take(ctx, deliveryKey(id))
+	if err == nil {
+		err = d.store.Unschedule(ctx, dueQueue, id)
+	}
+	if err != nil {
+		d.logger.Printf("Webhook cancel error: id=%s err=%v", id, err)
+	}
+	return err
+}
+
+// Log는 subject의 전송 기록을 오래된 것부터 반환
+func (d *Dispatcher) Log(ctx context.Context, subject string) ([]Attempt, error) {
+	value, ok, err := d.store.Get(ctx, logKey(subject))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var attempts []Attempt
+	if err := json.Unmarshal([]byte(value), &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// Run은 ctx가 끝날 때까지 처리 시각이 된 항목을 보냄. 여러 인스턴스에서 동시에 실행해도 한 항목은 한 곳에서만 보냄
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// poll은 가져올 항목이 없을 때까지 BatchSize개씩 가져와 동시에 보냄
+func (d *Dispatcher) poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		ids, err := d.store.ClaimDue(ctx, dueQueue, d.now(), d.opts.Timeout+claimSlack, d.opts.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Printf("Webhook queue error: %v", err)
+			}
+			return
+		}
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, id)
+			}()
+		}
+		wg.Wait()
+		if len(ids) < d.opts.BatchSize {
+			return
+		}
+	}
+}
+
+// deliver는 항목 하나를 보내고 결과에 따라 지우거나 다시 예약함
+// 저장소 오류로 결과를 남기지 못하면 lease가 끝난 뒤 다시 보내므로, 수신 측은 같은 이벤트를 두 번 받을 수 있음
+func (d *Dispatcher) deliver(ctx context.Context, id string) {
+	value, ok, err := d.store.Get(ctx, deliveryKey(id))
+	if err != nil {
+		d.logger.Printf("Webhook load error: id=%s err=%v", id, err)
+		return
+	}
+	if !ok {
+		// 만료되었거나 취소된 항목
+		d.unschedule(ctx, id)
+		return
+	}
+	rec, err := d.decode(id, value)
+	if err != nil {
+		d.logger.Printf("Webhook decode error: id=%s err=%v", id, err)
+		d.finish(ctx, id)
+		return
+	}
+
+	rec.Attempts++
+	started := d.now()
+	status, err := d.post(ctx, id, rec, started)
+	attempt := Attempt{
+		EventID:    id,
+		Type:       rec.Type,
+		Attempt:    rec.Attempts,
+		At:         started.Unix(),
+		StatusCode: status,
+		DurationMS: d.now().Sub(started).Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		attempt.Outcome = OutcomeDelivered
+		d.finish(ctx, id)
+	case retryable(status, err) && rec.Attempts < d.opts.MaxAttempts:
+		delay := d.backoff(rec.Attempts)
+		next := d.now().Add(delay)
+		attempt.Outcome = OutcomeRetrying
+		attempt.NextAttemptAt = next.Unix()
+		if err := d.save(ctx, id, rec, delay); err != nil {
+			d.logger.Printf("Webhook save error: id=%s err=%v", id, err)
+		} else if err := d.store.Schedule(ctx, dueQueue, id, next); err != nil {
+			d.logger.Printf("Webhook schedule error: id=%s err=%v", id, err)
+		}
+	default:
+		attempt.Outcome = OutcomeFailed
+		d.finish(ctx, id)
+	}
+	d.logger.Printf("Webhook %s: id=%s type=%s attempt=%d status=%d err=%s dur=%dms", attempt.Outcome, id, rec.Type, attempt.Attempt, status, attempt.Error, attempt.DurationMS)
+	if err := d.appendLog(ctx, rec.Subject, attempt); err != nil {
+		d.logger.Printf("Webhook log error: id=%s err=%v", id, err)
+	}
+}
+
+// post는 본문에 서명해 보내고 응답 상태 코드를 반환. 타임스탬프는 시도마다 새로 찍음
+func (d *Dispatcher) post(ctx context.Context, id string, rec record, now time.Time) (int, error) {
+	secrets := d.secrets(rec.Client)
+	if len(secrets) == 0 {
+		// 넣은 뒤 클라이언트의 서명 키를 지운 경우. 다시 시도해도 보낼 수 없음
+		return 0, ErrNoSecret
+	}
+	body := []byte(rec.Body)
+	timestamp := now.Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rec.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, signatureHeader(secrets, id, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+	return resp.StatusCode, nil
+}
+
+// retryable은 수신 서버가 일시적으로 처리하지 못한 경우인지 여부. 그 밖의 4xx는 다시 보내도 같으므로 실패로 끝냄
+func retryable(status int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrNoSecret)
+	}
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff는 attempts번 실패한 뒤 기다릴 시간. 여러 항목이 한꺼번에 재시도하지 않도록 절반은 무작위로 정함
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.RetryMax
+	if shift := attempts - 1; shift < 32 && d.opts.RetryBase<<shift < d.opts.RetryMax {
+		delay = d.opts.RetryBase << shift
+	}
+	return delay/2 + time.Duration(rand.Int64N(int64(delay/2)+1))
+}
+
+// save는 항목을 기록하며, 보낼 시각이 지나도 LogTTL 동안은 남겨 둠
+func (d *Dispatcher) save(ctx context.Context, id string, rec record, until time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	value := string(data)
+	if d.opts.Codec != nil {
+		if value, err = d.opts.Codec.Seal(deliveryKey(id), value); err != nil {
+			return err
+		}
+	}
+	return d.store.SetEx(ctx, deliveryKey(id), value, ttlSeconds(d.opts.LogTTL+max(until, 0)))
+}
+
+func (d *Dispatcher) decode(id, value string) (record, error) {
+	var rec record
+	if d.opts.Codec != nil {
+		opened, err := d.opts.Codec.Open(deliveryKey(id), value)
+		if err != nil {
+			return rec, err
+		}
+		value = opened
+	}
+	err := json.Unmarshal([]byte(value), &rec)
+	return rec, err
+}
+
+// finish는 처리를 마친 항목을 지움
+func (d *Dispatcher) finish(ctx context.Context, id string) {
+	if _, _, err := d.store.Take(ctx, deliveryKey(id)); err != nil {
+		d.logger.Printf("Webhook delete error: id=%s err=%v", id, err)
+	}
+	d.unschedule(ctx, id)
+}
+
+func (d *Dispatcher) unschedule(ctx context.Context, id string) {
+	if err := d.store.Unschedule(ctx, dueQueue, id); err != nil {
+		d.logger.Printf("Webhook unschedule error: id=%s err=%v", id, err)
+	}
+}
+
+// appendLog는 subject의 전송 기록에 attempt를 더함
+// 한 세션의 이벤트는 하나씩 보내므로 읽고 쓰는 사이에 다른 기록이 끼어들 일은 드묾(끼어들면 하나가 빠질 수 있음)
+func (d *Dispatcher) appendLog(ctx context.Context, subject string, attempt Attempt) error {
+	if subject == "" {
+		return nil
+	}
+	attempts, err := d.Log(ctx, subject)
+	if err != nil {
+		return err
+	}
+	attempts = append(attempts, attempt)
+	if len(attempts) > maxLogEntries {
+		attempts = attempts[len(attempts)-maxLogEntries:]
+	}
+	data, err := json.Marshal(attempts)
+	if err != nil {
+		return err
+	}
+	return d.store.SetEx(ctx, logKey(subject), string(data), ttlSeconds(d.opts.LogTTL))
+}
+
+func deliveryKey(id string) string { return deliveryKeyPrefix + id }
+
+func logKey(subject string) string { return logKeyPrefix + subject }
+
+// ttlSeconds는 d를 초 단위로 올림하며 최소 1초
+func ttlSeconds(d time.Duration) int {
+	return max(int((d+time.Second-1)/time.Second), 1)
+}